@@ -1,9 +1,21 @@
 package application
 
-import "github.com/fabric8-services/fabric8-env/environment"
+import (
+	"context"
+
+	"github.com/fabric8-services/fabric8-env/audit"
+	"github.com/fabric8-services/fabric8-env/environment"
+	"github.com/fabric8-services/fabric8-env/envtemplate"
+	"github.com/fabric8-services/fabric8-env/idempotency"
+	"github.com/fabric8-services/fabric8-env/quota"
+)
 
 type Application interface {
 	Environments() environment.Repository
+	Templates() envtemplate.Repository
+	AuditLogs() audit.Repository
+	SpaceQuotas() quota.Repository
+	IdempotencyKeys() idempotency.Repository
 }
 
 type Transaction interface {
@@ -14,5 +26,7 @@ type Transaction interface {
 
 type DB interface {
 	Application
-	BeginTransaction() (Transaction, error)
+	// BeginTransaction begins a transaction which is rolled back if ctx is done
+	// before it is committed.
+	BeginTransaction(ctx context.Context) (Transaction, error)
 }
@@ -0,0 +1,637 @@
+// Package apptest holds the conformance tests of the implementations of
+// application.DB, which are run against each of them so that they can't drift.
+package apptest
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/convert/ptr"
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/audit"
+	"github.com/fabric8-services/fabric8-env/environment"
+	"github.com/fabric8-services/fabric8-env/envtemplate"
+	"github.com/fabric8-services/fabric8-env/idempotency"
+	"github.com/fabric8-services/fabric8-env/quota"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunConformanceTests runs the conformance tests against the DB returned by
+// newDB. The tests do not clean up and pass with existing data: they use new
+// spaces and unique names.
+func RunConformanceTests(t *testing.T, newDB func() application.DB) {
+	t.Run("environments", func(t *testing.T) {
+		testEnvironments(t, newDB())
+	})
+	t.Run("environment queries", func(t *testing.T) {
+		testEnvironmentQueries(t, newDB())
+	})
+	t.Run("transactions", func(t *testing.T) {
+		testTransactions(t, newDB())
+	})
+	t.Run("templates", func(t *testing.T) {
+		testTemplates(t, newDB())
+	})
+	t.Run("audit logs", func(t *testing.T) {
+		testAuditLogs(t, newDB())
+	})
+	t.Run("space quotas", func(t *testing.T) {
+		testSpaceQuotas(t, newDB())
+	})
+	t.Run("idempotency keys", func(t *testing.T) {
+		testIdempotencyKeys(t, newDB())
+	})
+}
+
+func newEnvironment(name, envType, clusterURL string, spaceID uuid.UUID) *environment.Environment {
+	return &environment.Environment{
+		Name:       &name,
+		Type:       &envType,
+		SpaceID:    &spaceID,
+		ClusterURL: &clusterURL,
+	}
+}
+
+func requireNotFound(t *testing.T, err error) {
+	require.Error(t, err)
+	assert.IsType(t, errors.NotFoundError{}, errs.Cause(err))
+}
+
+func ids(envs []*environment.Environment) []uuid.UUID {
+	res := make([]uuid.UUID, len(envs))
+	for i, env := range envs {
+		res[i] = *env.ID
+	}
+	return res
+}
+
+func testEnvironments(t *testing.T, db application.DB) {
+	ctx := context.Background()
+	repo := db.Environments()
+	spaceID := uuid.NewV4()
+
+	env, err := repo.Create(ctx, newEnvironment("osio-stage", "stage", "cluster1.com", spaceID))
+	require.NoError(t, err)
+	require.NotNil(t, env.ID)
+	assert.False(t, env.CreatedAt.IsZero())
+
+	t.Run("load", func(t *testing.T) {
+		loaded, err := repo.Load(ctx, *env.ID)
+		require.NoError(t, err)
+		assert.Equal(t, *env.ID, *loaded.ID)
+		assert.Equal(t, "osio-stage", *loaded.Name)
+		assert.Equal(t, spaceID, *loaded.SpaceID)
+		assert.Nil(t, loaded.ExpiresAt)
+		assert.False(t, loaded.Protected)
+
+		_, err = repo.Load(ctx, uuid.NewV4())
+		requireNotFound(t, err)
+	})
+
+	t.Run("create without name", func(t *testing.T) {
+		invalid := newEnvironment("", "stage", "cluster1.com", spaceID)
+		invalid.Name = nil
+		_, err := repo.Create(ctx, invalid)
+		require.Error(t, err)
+	})
+
+	t.Run("save", func(t *testing.T) {
+		loaded, err := repo.Load(ctx, *env.ID)
+		require.NoError(t, err)
+		loaded.Name = ptr.String("osio-run")
+		loaded.Protected = true
+		saved, err := repo.Save(ctx, loaded)
+		require.NoError(t, err)
+		assert.Equal(t, "osio-run", *saved.Name)
+		assert.True(t, saved.Protected)
+
+		loaded, err = repo.Load(ctx, *env.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "osio-run", *loaded.Name)
+		assert.True(t, loaded.Protected)
+
+		unknown := newEnvironment("osio-run", "run", "cluster1.com", spaceID)
+		unknownID := uuid.NewV4()
+		unknown.ID = &unknownID
+		_, err = repo.Save(ctx, unknown)
+		requireNotFound(t, err)
+	})
+
+	t.Run("returned environments are copies", func(t *testing.T) {
+		loaded, err := repo.Load(ctx, *env.ID)
+		require.NoError(t, err)
+		loaded.Name = ptr.String("changed")
+		loaded, err = repo.Load(ctx, *env.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "osio-run", *loaded.Name)
+	})
+
+	t.Run("list and count", func(t *testing.T) {
+		other, err := repo.Create(ctx, newEnvironment("osio-run", "run", "cluster1.com", spaceID))
+		require.NoError(t, err)
+		_, err = repo.Create(ctx, newEnvironment("osio-run", "run", "cluster1.com", uuid.NewV4()))
+		require.NoError(t, err)
+
+		envs, err := repo.List(ctx, spaceID)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []uuid.UUID{*env.ID, *other.ID}, ids(envs))
+		count, err := repo.Count(ctx, spaceID)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+
+		envs, err = repo.List(ctx, uuid.NewV4())
+		require.NoError(t, err)
+		assert.Empty(t, envs)
+		count, err = repo.Count(ctx, uuid.NewV4())
+		require.NoError(t, err)
+		assert.Equal(t, 0, count)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, repo.Delete(ctx, *env.ID))
+		_, err := repo.Load(ctx, *env.ID)
+		requireNotFound(t, err)
+		envs, err := repo.List(ctx, spaceID)
+		require.NoError(t, err)
+		assert.NotContains(t, ids(envs), *env.ID)
+
+		requireNotFound(t, repo.Delete(ctx, *env.ID))
+	})
+}
+
+func testEnvironmentQueries(t *testing.T, db application.DB) {
+	ctx := context.Background()
+	repo := db.Environments()
+	clusterURL := fmt.Sprintf("https://api.%s.example.com", uuid.NewV4())
+
+	var created []*environment.Environment
+	for _, envType := range []string{"stage", "run", "run"} {
+		env, err := repo.Create(ctx, newEnvironment("osio-"+envType, envType, clusterURL, uuid.NewV4()))
+		require.NoError(t, err)
+		created = append(created, env)
+	}
+
+	t.Run("list by cluster", func(t *testing.T) {
+		envs, err := repo.ListByCluster(ctx, clusterURL+"/")
+		require.NoError(t, err)
+		assert.ElementsMatch(t, ids(created), ids(envs))
+
+		envs, err = repo.ListByCluster(ctx, "https://unknown.example.com")
+		require.NoError(t, err)
+		assert.Empty(t, envs)
+	})
+
+	t.Run("namespace names", func(t *testing.T) {
+		nsURL := fmt.Sprintf("https://api.%s.example.com", uuid.NewV4())
+		env := newEnvironment("osio-stage", "stage", nsURL, uuid.NewV4())
+		env.NamespaceName = ptr.String("osio-stage")
+		env, err := repo.Create(ctx, env)
+		require.NoError(t, err)
+
+		used, err := repo.UsedNamespaceNames(ctx, nsURL+"/", []string{"osio-stage", "osio-stage-1"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"osio-stage"}, used)
+		used, err = repo.UsedNamespaceNames(ctx, clusterURL, []string{"osio-stage"})
+		require.NoError(t, err)
+		assert.Empty(t, used)
+
+		duplicate := newEnvironment("osio-stage", "stage", nsURL+"/", uuid.NewV4())
+		duplicate.NamespaceName = ptr.String("osio-stage")
+		_, err = repo.Create(ctx, duplicate)
+		require.Error(t, err)
+		assert.IsType(t, errors.DataConflictError{}, errs.Cause(err))
+
+		other, err := repo.Create(ctx, newEnvironment("osio-run", "run", nsURL, uuid.NewV4()))
+		require.NoError(t, err)
+		other.NamespaceName = ptr.String("osio-stage")
+		_, err = repo.Save(ctx, other)
+		require.Error(t, err)
+		assert.IsType(t, errors.DataConflictError{}, errs.Cause(err))
+
+		// the namespace of a deleted environment can be used again
+		require.NoError(t, repo.Delete(ctx, *env.ID))
+		_, err = repo.Save(ctx, other)
+		require.NoError(t, err)
+	})
+
+	t.Run("list all", func(t *testing.T) {
+		filter := environment.Filter{ClusterURL: &clusterURL}
+		all, total, err := repo.ListAll(ctx, filter, 0, -1)
+		require.NoError(t, err)
+		assert.Equal(t, 3, total)
+		assert.ElementsMatch(t, ids(created), ids(all))
+
+		envs, total, err := repo.ListAll(ctx, filter, 1, 1)
+		require.NoError(t, err)
+		assert.Equal(t, 3, total)
+		assert.Equal(t, []uuid.UUID{*all[1].ID}, ids(envs))
+
+		envs, total, err = repo.ListAll(ctx, filter, 5, 10)
+		require.NoError(t, err)
+		assert.Equal(t, 3, total)
+		assert.Empty(t, envs)
+
+		filter.Type = ptr.String("run")
+		envs, total, err = repo.ListAll(ctx, filter, 0, 10)
+		require.NoError(t, err)
+		assert.Equal(t, 2, total)
+		assert.ElementsMatch(t, []uuid.UUID{*created[1].ID, *created[2].ID}, ids(envs))
+
+		before := created[0].CreatedAt.Add(-time.Hour)
+		filter = environment.Filter{ClusterURL: &clusterURL, CreatedBefore: &before}
+		_, total, err = repo.ListAll(ctx, filter, 0, 10)
+		require.NoError(t, err)
+		assert.Equal(t, 0, total)
+	})
+
+	t.Run("list expired", func(t *testing.T) {
+		// a random time in 1971, so that the environments of other runs do not match
+		now := time.Date(1971, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(rand.Int63n(int64(365 * 24 * time.Hour))))
+		past := now.Add(-time.Hour)
+		create := func(update func(env *environment.Environment)) uuid.UUID {
+			env := newEnvironment("osio-stage", "stage", clusterURL, uuid.NewV4())
+			env.ExpiresAt = &past
+			update(env)
+			env, err := repo.Create(ctx, env)
+			require.NoError(t, err)
+			return *env.ID
+		}
+		expired := create(func(env *environment.Environment) {})
+		expiredLock := create(func(env *environment.Environment) {
+			env.LockedAt = &past
+			env.LockExpiresAt = &past
+		})
+		protected := create(func(env *environment.Environment) {
+			env.Protected = true
+		})
+		locked := create(func(env *environment.Environment) {
+			env.LockedAt = &past
+		})
+		notExpired := create(func(env *environment.Environment) {
+			future := now.Add(time.Hour)
+			env.ExpiresAt = &future
+		})
+
+		envs, err := repo.ListExpired(ctx, now, 100)
+		require.NoError(t, err)
+		found := ids(envs)
+		assert.Contains(t, found, expired)
+		assert.Contains(t, found, expiredLock)
+		assert.NotContains(t, found, protected)
+		assert.NotContains(t, found, locked)
+		assert.NotContains(t, found, notExpired)
+		for i := 1; i < len(envs); i++ {
+			assert.False(t, envs[i].ExpiresAt.Before(*envs[i-1].ExpiresAt), "ordered by expiry")
+		}
+
+		envs, err = repo.ListExpired(ctx, now, 1)
+		require.NoError(t, err)
+		assert.Len(t, envs, 1)
+
+		// the expired environments must not be left to the other tests
+		for _, id := range []uuid.UUID{expired, expiredLock, protected, locked} {
+			require.NoError(t, repo.Delete(ctx, id))
+		}
+	})
+
+	t.Run("move cluster", func(t *testing.T) {
+		oldURL := fmt.Sprintf("https://api.%s.example.com", uuid.NewV4())
+		newURL := fmt.Sprintf("https://api.%s.example.com", uuid.NewV4())
+		now := time.Now()
+		past, future := now.Add(-time.Hour), now.Add(time.Hour)
+		create := func(clusterURL string, update func(env *environment.Environment)) uuid.UUID {
+			env := newEnvironment("osio-stage", "stage", clusterURL, uuid.NewV4())
+			update(env)
+			env, err := repo.Create(ctx, env)
+			require.NoError(t, err)
+			return *env.ID
+		}
+		unlocked := create(oldURL+"/", func(env *environment.Environment) {})
+		expiredLock := create(oldURL, func(env *environment.Environment) {
+			env.LockedAt = &past
+			env.LockExpiresAt = &past
+		})
+		locked := create(oldURL, func(env *environment.Environment) {
+			env.LockedAt = &past
+			env.LockExpiresAt = &future
+		})
+
+		moved, err := repo.MoveCluster(ctx, oldURL+"/", newURL, now)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []uuid.UUID{unlocked, expiredLock}, ids(moved))
+		for _, env := range moved {
+			assert.Equal(t, newURL, *env.ClusterURL)
+		}
+		left, err := repo.ListByCluster(ctx, oldURL)
+		require.NoError(t, err)
+		assert.Equal(t, []uuid.UUID{locked}, ids(left))
+		loaded, err := repo.Load(ctx, locked)
+		require.NoError(t, err)
+		assert.NotNil(t, loaded.LockedAt, "the lock is kept")
+
+		// no environment moves when a namespace is used on both clusters
+		taken := create(oldURL, func(env *environment.Environment) {
+			env.NamespaceName = ptr.String("osio-stage")
+		})
+		create(newURL, func(env *environment.Environment) {
+			env.NamespaceName = ptr.String("osio-stage")
+		})
+		_, err = repo.MoveCluster(ctx, oldURL, newURL, now)
+		require.Error(t, err)
+		assert.IsType(t, errors.DataConflictError{}, errs.Cause(err))
+		left, err = repo.ListByCluster(ctx, oldURL)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []uuid.UUID{locked, taken}, ids(left))
+	})
+}
+
+func testTransactions(t *testing.T, db application.DB) {
+	ctx := context.Background()
+
+	t.Run("commit", func(t *testing.T) {
+		tx, err := db.BeginTransaction(ctx)
+		require.NoError(t, err)
+		env, err := tx.Environments().Create(ctx, newEnvironment("osio-stage", "stage", "cluster1.com", uuid.NewV4()))
+		require.NoError(t, err)
+
+		_, err = tx.Environments().Load(ctx, *env.ID)
+		require.NoError(t, err, "the transaction reads its own writes")
+		_, err = db.Environments().Load(ctx, *env.ID)
+		requireNotFound(t, err)
+
+		require.NoError(t, tx.Commit())
+		_, err = db.Environments().Load(ctx, *env.ID)
+		require.NoError(t, err)
+		assert.Error(t, tx.Commit(), "already committed")
+	})
+
+	t.Run("load for update", func(t *testing.T) {
+		env, err := db.Environments().Create(ctx, newEnvironment("osio-stage", "stage", "cluster1.com", uuid.NewV4()))
+		require.NoError(t, err)
+		tx, err := db.BeginTransaction(ctx)
+		require.NoError(t, err)
+		_, err = tx.Environments().LoadForUpdate(ctx, *env.ID)
+		require.NoError(t, err)
+
+		loaded := make(chan error, 1)
+		go func() {
+			other, err := db.BeginTransaction(ctx)
+			if err != nil {
+				loaded <- err
+				return
+			}
+			defer other.Rollback()
+			_, err = other.Environments().LoadForUpdate(ctx, *env.ID)
+			loaded <- err
+		}()
+		select {
+		case err := <-loaded:
+			t.Fatalf("loaded while locked by another transaction: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		require.NoError(t, tx.Commit())
+		require.NoError(t, <-loaded)
+
+		tx, err = db.BeginTransaction(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback()
+		_, err = tx.Environments().LoadForUpdate(ctx, uuid.NewV4())
+		requireNotFound(t, err)
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		tx, err := db.BeginTransaction(ctx)
+		require.NoError(t, err)
+		env, err := tx.Environments().Create(ctx, newEnvironment("osio-stage", "stage", "cluster1.com", uuid.NewV4()))
+		require.NoError(t, err)
+		_, err = tx.AuditLogs().Create(ctx, &audit.Entry{EnvironmentID: *env.ID, SpaceID: *env.SpaceID, Action: audit.ActionUpdate})
+		require.NoError(t, err)
+
+		require.NoError(t, tx.Rollback())
+		_, err = db.Environments().Load(ctx, *env.ID)
+		requireNotFound(t, err)
+		entries, err := db.AuditLogs().List(ctx, *env.ID)
+		require.NoError(t, err)
+		assert.Empty(t, entries)
+		assert.Error(t, tx.Commit(), "already rolled back")
+	})
+
+	t.Run("transactional", func(t *testing.T) {
+		spaceID := uuid.NewV4()
+		fnErr := errs.New("failed")
+		err := application.Transactional(ctx, db, func(appl application.Application) error {
+			_, err := appl.Environments().Create(ctx, newEnvironment("osio-stage", "stage", "cluster1.com", spaceID))
+			require.NoError(t, err)
+			return fnErr
+		})
+		assert.Equal(t, fnErr, errs.Cause(err))
+		envs, err := db.Environments().List(ctx, spaceID)
+		require.NoError(t, err)
+		assert.Empty(t, envs)
+
+		err = application.Transactional(ctx, db, func(appl application.Application) error {
+			_, err := appl.Environments().Create(ctx, newEnvironment("osio-stage", "stage", "cluster1.com", spaceID))
+			return err
+		})
+		require.NoError(t, err)
+		envs, err = db.Environments().List(ctx, spaceID)
+		require.NoError(t, err)
+		assert.Len(t, envs, 1)
+	})
+
+	t.Run("context done", func(t *testing.T) {
+		txCtx, cancel := context.WithCancel(ctx)
+		tx, err := db.BeginTransaction(txCtx)
+		require.NoError(t, err)
+		env, err := tx.Environments().Create(ctx, newEnvironment("osio-stage", "stage", "cluster1.com", uuid.NewV4()))
+		require.NoError(t, err)
+
+		cancel()
+		assert.Error(t, tx.Commit())
+		_, err = db.Environments().Load(ctx, *env.ID)
+		requireNotFound(t, err)
+	})
+}
+
+func testTemplates(t *testing.T, db application.DB) {
+	ctx := context.Background()
+	repo := db.Templates()
+	name := "template-" + uuid.NewV4().String()
+
+	tmpl, err := repo.Create(ctx, &envtemplate.Template{
+		Name:         &name,
+		Description:  ptr.String("stage and run"),
+		Environments: envtemplate.Items{{Name: "{space}-stage", Type: "stage", ClusterURL: "cluster1.com"}},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, tmpl.ID)
+
+	t.Run("load", func(t *testing.T) {
+		loaded, err := repo.Load(ctx, *tmpl.ID)
+		require.NoError(t, err)
+		assert.Equal(t, name, *loaded.Name)
+		require.Len(t, loaded.Environments, 1)
+		assert.Equal(t, "stage", loaded.Environments[0].Type)
+
+		loaded, err = repo.LoadByName(ctx, name)
+		require.NoError(t, err)
+		assert.Equal(t, *tmpl.ID, *loaded.ID)
+
+		_, err = repo.Load(ctx, uuid.NewV4())
+		requireNotFound(t, err)
+		_, err = repo.LoadByName(ctx, "unknown-"+name)
+		requireNotFound(t, err)
+	})
+
+	t.Run("unique name", func(t *testing.T) {
+		_, err := repo.Create(ctx, &envtemplate.Template{Name: &name})
+		require.Error(t, err)
+		assert.IsType(t, errors.DataConflictError{}, errs.Cause(err))
+	})
+
+	t.Run("save", func(t *testing.T) {
+		newName := name + "-renamed"
+		tmpl.Name = &newName
+		saved, err := repo.Save(ctx, tmpl)
+		require.NoError(t, err)
+		assert.Equal(t, newName, *saved.Name)
+		_, err = repo.LoadByName(ctx, name)
+		requireNotFound(t, err)
+
+		unknownID := uuid.NewV4()
+		_, err = repo.Save(ctx, &envtemplate.Template{ID: &unknownID, Name: ptr.String("unknown-" + name)})
+		requireNotFound(t, err)
+	})
+
+	t.Run("list", func(t *testing.T) {
+		tmpls, err := repo.List(ctx)
+		require.NoError(t, err)
+		found := false
+		for i, other := range tmpls {
+			found = found || *other.ID == *tmpl.ID
+			if i > 0 {
+				assert.True(t, *tmpls[i-1].Name <= *other.Name, "ordered by name")
+			}
+		}
+		assert.True(t, found)
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		require.NoError(t, repo.Delete(ctx, *tmpl.ID))
+		_, err := repo.Load(ctx, *tmpl.ID)
+		requireNotFound(t, err)
+		requireNotFound(t, repo.Delete(ctx, *tmpl.ID))
+
+		// the name of a deleted template can be used again
+		_, err = repo.Create(ctx, &envtemplate.Template{Name: tmpl.Name})
+		require.NoError(t, err)
+	})
+}
+
+func testAuditLogs(t *testing.T, db application.DB) {
+	ctx := context.Background()
+	repo := db.AuditLogs()
+	envID, spaceID := uuid.NewV4(), uuid.NewV4()
+
+	for _, action := range []string{audit.ActionUpdate, audit.ActionDelete} {
+		entry, err := repo.Create(ctx, &audit.Entry{
+			EnvironmentID: envID,
+			SpaceID:       spaceID,
+			Action:        action,
+			Actor:         "user",
+		})
+		require.NoError(t, err)
+		require.NotNil(t, entry.ID)
+		// keeps the creation times apart
+		time.Sleep(time.Millisecond)
+	}
+
+	entries, err := repo.List(ctx, envID)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, audit.ActionUpdate, entries[0].Action)
+	assert.Equal(t, audit.ActionDelete, entries[1].Action)
+	assert.Empty(t, entries[0].Details)
+
+	entries, err = repo.List(ctx, uuid.NewV4())
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func testSpaceQuotas(t *testing.T, db application.DB) {
+	ctx := context.Background()
+	repo := db.SpaceQuotas()
+	spaceID := uuid.NewV4()
+
+	q, err := repo.Load(ctx, spaceID)
+	require.NoError(t, err)
+	assert.Nil(t, q, "the space uses the default quota")
+
+	q, err = repo.Save(ctx, &quota.SpaceQuota{SpaceID: spaceID, MaxEnvironments: 5})
+	require.NoError(t, err)
+	assert.Equal(t, 5, q.MaxEnvironments)
+	q, err = repo.Save(ctx, &quota.SpaceQuota{SpaceID: spaceID, MaxEnvironments: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 10, q.MaxEnvironments)
+
+	_, err = repo.Save(ctx, &quota.SpaceQuota{SpaceID: spaceID, MaxEnvironments: -1})
+	require.Error(t, err)
+
+	require.NoError(t, repo.Delete(ctx, spaceID))
+	q, err = repo.Load(ctx, spaceID)
+	require.NoError(t, err)
+	assert.Nil(t, q)
+	require.NoError(t, repo.Delete(ctx, spaceID))
+}
+
+func testIdempotencyKeys(t *testing.T, db application.DB) {
+	ctx := context.Background()
+	repo := db.IdempotencyKeys()
+	spaceID := uuid.NewV4()
+	now := time.Now()
+	rec := &idempotency.Record{
+		SpaceID:        spaceID,
+		Key:            "key",
+		RequestHash:    "hash",
+		ResponseStatus: 201,
+		ResponseBody:   "{}",
+		ExpiresAt:      now.Add(time.Hour),
+	}
+
+	require.NoError(t, repo.Create(ctx, rec, now))
+	loaded, err := repo.Load(ctx, spaceID, "key", now)
+	require.NoError(t, err)
+	assert.Equal(t, "hash", loaded.RequestHash)
+	assert.Equal(t, 201, loaded.ResponseStatus)
+
+	_, err = repo.Load(ctx, uuid.NewV4(), "key", now)
+	requireNotFound(t, err)
+
+	err = repo.Create(ctx, rec, now)
+	require.Error(t, err)
+	assert.IsType(t, errors.DataConflictError{}, errs.Cause(err))
+
+	// once expired, the key is not found and can be used again
+	later := now.Add(2 * time.Hour)
+	_, err = repo.Load(ctx, spaceID, "key", later)
+	requireNotFound(t, err)
+	rec.RequestHash = "other-hash"
+	rec.ExpiresAt = later.Add(time.Hour)
+	require.NoError(t, repo.Create(ctx, rec, later))
+	loaded, err = repo.Load(ctx, spaceID, "key", later)
+	require.NoError(t, err)
+	assert.Equal(t, "other-hash", loaded.RequestHash)
+
+	count, err := repo.DeleteExpired(ctx, later.Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, count >= 1)
+	_, err = repo.Load(ctx, spaceID, "key", later)
+	requireNotFound(t, err)
+}
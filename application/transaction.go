@@ -1,12 +1,17 @@
 package application
 
 import (
+	"context"
+	"math/rand"
 	"runtime/debug"
+	"sync/atomic"
 	"time"
 
+	commonerrors "github.com/fabric8-services/fabric8-common/errors"
 	"github.com/fabric8-services/fabric8-common/log"
-
+	"github.com/lib/pq"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 var databaseTransactionTimeout = 5 * time.Minute
@@ -15,49 +20,219 @@ func SetDatabaseTransactionTimeout(t time.Duration) {
 	databaseTransactionTimeout = t
 }
 
-// Transactional executes the given function in a transaction. If todo returns an error, the transaction is rolled back
-func Transactional(db DB, todo func(f Application) error) error {
-	var tx Transaction
-	var err error
-	if tx, err = db.BeginTransaction(); err != nil {
-		log.Error(nil, map[string]interface{}{
+var databaseTransactionRetries int
+
+// SetDatabaseTransactionRetries sets how many times Transactional runs a
+// transaction again after a serialization failure or a deadlock.
+func SetDatabaseTransactionRetries(retries int) {
+	databaseTransactionRetries = retries
+}
+
+const (
+	sqlStateSerializationFailure = "40001"
+	sqlStateDeadlockDetected     = "40P01"
+
+	retryBackoff    = 10 * time.Millisecond
+	maxRetryBackoff = time.Second
+)
+
+var transactionRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "fabric8_env_db_transaction_retries_total",
+	Help: "Number of transactions run again after a serialization failure or a deadlock, by SQLSTATE.",
+}, []string{"code"})
+
+func init() {
+	prometheus.MustRegister(transactionRetries)
+}
+
+// ErrTransactionTimeout is returned by Transactional when the transaction did
+// not complete within the timeout.
+var ErrTransactionTimeout = errors.New("database transaction timeout")
+
+// Clock schedules the timeout of transactions.
+type Clock interface {
+	// AfterFunc calls f in its own goroutine after d and returns a function
+	// which prevents the call, it returns false if f was already called.
+	AfterFunc(d time.Duration, f func()) (stop func() bool)
+}
+
+type realClock struct{}
+
+func (realClock) AfterFunc(d time.Duration, f func()) func() bool {
+	return time.AfterFunc(d, f).Stop
+}
+
+type txOptions struct {
+	timeout time.Duration
+	retries int
+	clock   Clock
+}
+
+// TxOption configures a call of Transactional.
+type TxOption func(o *txOptions)
+
+// WithTimeout replaces the timeout set by SetDatabaseTransactionTimeout.
+func WithTimeout(timeout time.Duration) TxOption {
+	return func(o *txOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithRetries replaces the number of retries set by SetDatabaseTransactionRetries.
+func WithRetries(retries int) TxOption {
+	return func(o *txOptions) {
+		o.retries = retries
+	}
+}
+
+// WithClock replaces the clock scheduling the timeout of the transaction.
+func WithClock(clock Clock) TxOption {
+	return func(o *txOptions) {
+		o.clock = clock
+	}
+}
+
+// Transactional executes fn in a transaction which is committed if fn returns
+// nil and rolled back otherwise. The transaction is bound to ctx and to the
+// transaction timeout: once either is done, the statements of fn fail, the
+// transaction is rolled back and the error of ctx or ErrTransactionTimeout is
+// returned. A failed commit is returned as well.
+//
+// If the transaction fails with a serialization failure or a deadlock, fn is run
+// again in a new transaction, up to the configured number of retries and with
+// an exponential backoff. fn must therefore not have effects outside of the
+// transaction which cannot be repeated.
+func Transactional(ctx context.Context, db DB, fn func(f Application) error, options ...TxOption) error {
+	opts := txOptions{
+		timeout: databaseTransactionTimeout,
+		retries: databaseTransactionRetries,
+		clock:   realClock{},
+	}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
+	backoff := retryBackoff
+	for attempt := 0; ; attempt++ {
+		err := runTransaction(ctx, db, fn, opts)
+		code, retryable := retryableSQLState(err)
+		if !retryable || attempt >= opts.retries {
+			return err
+		}
+		transactionRetries.WithLabelValues(code).Inc()
+		log.Warn(ctx, map[string]interface{}{
+			"err":     err,
+			"attempt": attempt + 1,
+		}, "retrying the database transaction")
+		if err := sleep(ctx, backoff/2+time.Duration(rand.Int63n(int64(backoff/2)+1))); err != nil {
+			return errors.WithStack(err)
+		}
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
+
+// runTransaction runs fn once in a transaction.
+func runTransaction(ctx context.Context, db DB, fn func(f Application) error, opts txOptions) (err error) {
+	if err := ctx.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	txCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var timedOut int32
+	stop := opts.clock.AfterFunc(opts.timeout, func() {
+		atomic.StoreInt32(&timedOut, 1)
+		cancel()
+	})
+	defer stop()
+
+	tx, err := db.BeginTransaction(txCtx)
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{
 			"err": err,
 		}, "database BeginTransaction failed!")
 		return errors.WithStack(err)
 	}
 
-	return func() error {
-		errorChan := make(chan error, 1)
-		txTimeout := time.After(databaseTransactionTimeout)
-
-		go func(tx Transaction) {
-			defer func() {
-				if err := recover(); err != nil {
-					errorChan <- errors.Errorf("recovered %v. stack: %s", err, debug.Stack())
-				}
-			}()
-			errorChan <- todo(tx)
-		}(tx)
-
-		select {
-		case err := <-errorChan:
-			if err != nil {
-				log.Debug(nil, map[string]interface{}{"error": err}, "Rolling back the transaction...")
-				_ = tx.Rollback()
-				log.Error(nil, map[string]interface{}{
-					"err": err,
-				}, "database transaction failed!")
-				return errors.WithStack(err)
-			}
-			_ = tx.Commit()
-			log.Debug(nil, nil, "Commit the transaction!")
-			return nil
-
-		case <-txTimeout:
-			log.Debug(nil, nil, "Rolling back the transaction...")
-			_ = tx.Rollback()
-			log.Error(nil, nil, "database transaction timeout!")
-			return errors.New("database transaction timeout")
+	// done reports why the transaction must not be committed anymore, if so
+	done := func() error {
+		if atomic.LoadInt32(&timedOut) == 1 {
+			return ErrTransactionTimeout
+		}
+		return ctx.Err()
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.Errorf("recovered %v. stack: %s", r, debug.Stack())
+			rollback(ctx, tx, err)
 		}
 	}()
+
+	if err := fn(tx); err != nil {
+		if doneErr := done(); doneErr != nil {
+			err = doneErr
+		}
+		rollback(ctx, tx, err)
+		return errors.WithStack(err)
+	}
+	if err := done(); err != nil {
+		rollback(ctx, tx, err)
+		return errors.WithStack(err)
+	}
+	if err := tx.Commit(); err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"err": err,
+		}, "database transaction commit failed!")
+		if doneErr := done(); doneErr != nil {
+			return errors.WithStack(doneErr)
+		}
+		return errors.Wrap(err, "failed to commit the transaction")
+	}
+	log.Debug(ctx, nil, "Commit the transaction!")
+	return nil
+}
+
+func rollback(ctx context.Context, tx Transaction, cause error) {
+	log.Debug(ctx, map[string]interface{}{"error": cause}, "Rolling back the transaction...")
+	if err := tx.Rollback(); err != nil {
+		log.Warn(ctx, map[string]interface{}{
+			"err": err,
+		}, "database transaction rollback failed")
+	}
+	log.Error(ctx, map[string]interface{}{
+		"err": cause,
+	}, "database transaction failed!")
+}
+
+// retryableSQLState returns the SQLSTATE of err if the transaction failed
+// because of a serialization failure or a deadlock. The database errors wrapped
+// in an InternalError by the repositories are unwrapped.
+func retryableSQLState(err error) (string, bool) {
+	cause := errors.Cause(err)
+	if internalErr, ok := cause.(commonerrors.InternalError); ok {
+		cause = errors.Cause(internalErr.Err)
+	}
+	pqErr, ok := cause.(*pq.Error)
+	if !ok {
+		return "", false
+	}
+	switch pqErr.Code {
+	case sqlStateSerializationFailure, sqlStateDeadlockDetected:
+		return string(pqErr.Code), true
+	}
+	return "", false
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
@@ -0,0 +1,305 @@
+package application_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/errors"
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/audit"
+	"github.com/fabric8-services/fabric8-env/environment"
+	"github.com/fabric8-services/fabric8-env/envtemplate"
+	"github.com/fabric8-services/fabric8-env/idempotency"
+	"github.com/fabric8-services/fabric8-env/quota"
+	"github.com/lib/pq"
+	errs "github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type TransactionalSuite struct {
+	testsuite.UnitTestSuite
+}
+
+func TestTransactional(t *testing.T) {
+	suite.Run(t, &TransactionalSuite{})
+}
+
+// testDB records the transactions it begins, the commit of the i-th one fails
+// with commitErrs[i] if set.
+type testDB struct {
+	testApplication
+	commitErrs []error
+	txs        []*testTransaction
+}
+
+func (db *testDB) BeginTransaction(ctx context.Context) (application.Transaction, error) {
+	tx := &testTransaction{ctx: ctx}
+	if len(db.txs) < len(db.commitErrs) {
+		tx.commitErr = db.commitErrs[len(db.txs)]
+	}
+	db.txs = append(db.txs, tx)
+	return tx, nil
+}
+
+type testApplication struct{}
+
+func (testApplication) Environments() environment.Repository    { return nil }
+func (testApplication) Templates() envtemplate.Repository       { return nil }
+func (testApplication) AuditLogs() audit.Repository             { return nil }
+func (testApplication) SpaceQuotas() quota.Repository           { return nil }
+func (testApplication) IdempotencyKeys() idempotency.Repository { return nil }
+
+type testTransaction struct {
+	testApplication
+	ctx        context.Context
+	commitErr  error
+	committed  bool
+	rolledBack bool
+}
+
+func (tx *testTransaction) Commit() error {
+	tx.committed = true
+	return tx.commitErr
+}
+
+func (tx *testTransaction) Rollback() error {
+	tx.rolledBack = true
+	return nil
+}
+
+// testClock fires the timeout when the test calls fire.
+type testClock struct {
+	mu      sync.Mutex
+	timeout time.Duration
+	f       func()
+}
+
+func (c *testClock) AfterFunc(d time.Duration, f func()) func() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timeout = d
+	c.f = f
+	return func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		stopped := c.f != nil
+		c.f = nil
+		return stopped
+	}
+}
+
+func (c *testClock) fire() {
+	c.mu.Lock()
+	f := c.f
+	c.f = nil
+	c.mu.Unlock()
+	if f != nil {
+		f()
+	}
+}
+
+func (s *TransactionalSuite) TestCommit() {
+	db := &testDB{}
+	err := application.Transactional(context.Background(), db, func(appl application.Application) error {
+		return nil
+	})
+	require.NoError(s.T(), err)
+	require.Len(s.T(), db.txs, 1)
+	assert.True(s.T(), db.txs[0].committed)
+	assert.False(s.T(), db.txs[0].rolledBack)
+}
+
+func (s *TransactionalSuite) TestRollback() {
+	db := &testDB{}
+	fnErr := errs.New("failed")
+	err := application.Transactional(context.Background(), db, func(appl application.Application) error {
+		return fnErr
+	})
+	assert.Equal(s.T(), fnErr, errs.Cause(err))
+	assert.False(s.T(), db.txs[0].committed)
+	assert.True(s.T(), db.txs[0].rolledBack)
+}
+
+func (s *TransactionalSuite) TestCommitFailure() {
+	db := &testDB{commitErrs: []error{errs.New("connection lost")}}
+	err := application.Transactional(context.Background(), db, func(appl application.Application) error {
+		return nil
+	})
+	require.Error(s.T(), err)
+	assert.Equal(s.T(), db.commitErrs[0], errs.Cause(err))
+}
+
+func (s *TransactionalSuite) TestPanic() {
+	db := &testDB{}
+	err := application.Transactional(context.Background(), db, func(appl application.Application) error {
+		panic("boom")
+	})
+	require.Error(s.T(), err)
+	assert.Contains(s.T(), err.Error(), "recovered boom")
+	assert.True(s.T(), db.txs[0].rolledBack)
+}
+
+func (s *TransactionalSuite) TestTimeout() {
+	s.T().Run("statement fails after the timeout", func(t *testing.T) {
+		db := &testDB{}
+		clock := &testClock{}
+		err := application.Transactional(context.Background(), db, func(appl application.Application) error {
+			clock.fire()
+			// the statements of a transaction fail once its context is done
+			tx := appl.(*testTransaction)
+			return tx.ctx.Err()
+		}, application.WithTimeout(time.Minute), application.WithClock(clock))
+		assert.Equal(t, application.ErrTransactionTimeout, errs.Cause(err))
+		assert.Equal(t, time.Minute, clock.timeout)
+		assert.False(t, db.txs[0].committed)
+		assert.True(t, db.txs[0].rolledBack)
+	})
+
+	s.T().Run("not committed after the timeout", func(t *testing.T) {
+		db := &testDB{}
+		clock := &testClock{}
+		err := application.Transactional(context.Background(), db, func(appl application.Application) error {
+			clock.fire()
+			return nil
+		}, application.WithClock(clock))
+		assert.Equal(t, application.ErrTransactionTimeout, errs.Cause(err))
+		assert.False(t, db.txs[0].committed)
+		assert.True(t, db.txs[0].rolledBack)
+	})
+
+	s.T().Run("timer stopped", func(t *testing.T) {
+		db := &testDB{}
+		clock := &testClock{}
+		err := application.Transactional(context.Background(), db, func(appl application.Application) error {
+			return nil
+		}, application.WithClock(clock))
+		require.NoError(t, err)
+		assert.Nil(t, clock.f)
+	})
+}
+
+func (s *TransactionalSuite) TestContext() {
+	s.T().Run("cancelled before", func(t *testing.T) {
+		db := &testDB{}
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		called := false
+		err := application.Transactional(ctx, db, func(appl application.Application) error {
+			called = true
+			return nil
+		})
+		assert.Equal(t, context.Canceled, errs.Cause(err))
+		assert.False(t, called)
+		assert.Empty(t, db.txs)
+	})
+
+	s.T().Run("cancelled during", func(t *testing.T) {
+		db := &testDB{}
+		ctx, cancel := context.WithCancel(context.Background())
+		err := application.Transactional(ctx, db, func(appl application.Application) error {
+			cancel()
+			return nil
+		})
+		assert.Equal(t, context.Canceled, errs.Cause(err))
+		assert.False(t, db.txs[0].committed)
+		assert.True(t, db.txs[0].rolledBack)
+		assert.Error(t, db.txs[0].ctx.Err(), "the transaction is bound to the context")
+	})
+}
+
+func (s *TransactionalSuite) TestRetry() {
+	serializationFailure := &pq.Error{Code: "40001"}
+	deadlock := &pq.Error{Code: "40P01"}
+
+	s.T().Run("serialization failure on commit", func(t *testing.T) {
+		before := retryCount(t, "40001")
+		db := &testDB{commitErrs: []error{errs.WithStack(serializationFailure), errs.WithStack(serializationFailure)}}
+		calls := 0
+		err := application.Transactional(context.Background(), db, func(appl application.Application) error {
+			calls++
+			return nil
+		}, application.WithRetries(3))
+		require.NoError(t, err)
+		assert.Equal(t, 3, calls)
+		require.Len(t, db.txs, 3)
+		assert.True(t, db.txs[2].committed)
+		assert.Equal(t, before+2, retryCount(t, "40001"))
+	})
+
+	s.T().Run("deadlock in the function", func(t *testing.T) {
+		before := retryCount(t, "40P01")
+		db := &testDB{}
+		calls := 0
+		err := application.Transactional(context.Background(), db, func(appl application.Application) error {
+			calls++
+			if calls == 1 {
+				return errs.Wrap(deadlock, "failed to lock")
+			}
+			return nil
+		}, application.WithRetries(3))
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+		assert.True(t, db.txs[0].rolledBack)
+		assert.Equal(t, before+1, retryCount(t, "40P01"))
+	})
+
+	s.T().Run("serialization failure in an internal error", func(t *testing.T) {
+		db := &testDB{}
+		calls := 0
+		err := application.Transactional(context.Background(), db, func(appl application.Application) error {
+			calls++
+			if calls == 1 {
+				return errors.NewInternalError(context.Background(), serializationFailure)
+			}
+			return nil
+		}, application.WithRetries(3))
+		require.NoError(t, err)
+		assert.Equal(t, 2, calls)
+	})
+
+	s.T().Run("retries exhausted", func(t *testing.T) {
+		db := &testDB{}
+		calls := 0
+		err := application.Transactional(context.Background(), db, func(appl application.Application) error {
+			calls++
+			return serializationFailure
+		}, application.WithRetries(2))
+		assert.Equal(t, serializationFailure, errs.Cause(err))
+		assert.Equal(t, 3, calls)
+	})
+
+	s.T().Run("other errors are not retried", func(t *testing.T) {
+		db := &testDB{}
+		calls := 0
+		err := application.Transactional(context.Background(), db, func(appl application.Application) error {
+			calls++
+			return &pq.Error{Code: "23505"}
+		}, application.WithRetries(2))
+		assert.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+}
+
+func retryCount(t *testing.T, code string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() != "fabric8_env_db_transaction_retries_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "code" && label.GetValue() == code {
+					return metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
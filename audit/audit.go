@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/gormsupport"
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/fabric8-services/fabric8-env/gormctx"
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionMoveCluster = "move_cluster"
+	ActionExpire      = "expire"
+	ActionUpdate      = "update"
+	ActionDelete      = "delete"
+	ActionLock        = "lock"
+	ActionUnlock      = "unlock"
+	// ActionLockOverride records the justification given to bypass a lock or the
+	// deletion protection of an environment.
+	ActionLockOverride = "lock_override"
+)
+
+// Details is stored as a JSON document in the details column.
+type Details map[string]interface{}
+
+func (d Details) Value() (driver.Value, error) {
+	if d == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(d)
+}
+
+func (d *Details) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		*d = Details{}
+		return nil
+	default:
+		return errs.Errorf("unable to scan %T into audit details", src)
+	}
+	return json.Unmarshal(data, d)
+}
+
+// Entry is a single change made to an environment.
+type Entry struct {
+	gormsupport.Lifecycle
+	ID            *uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key"`
+	EnvironmentID uuid.UUID  `sql:"type:uuid"`
+	SpaceID       uuid.UUID  `sql:"type:uuid"`
+	Action        string
+	Actor         string
+	Details       Details `sql:"type:jsonb"`
+}
+
+func (e Entry) TableName() string {
+	return "environment_audit_logs"
+}
+
+type Repository interface {
+	Create(ctx context.Context, entry *Entry) (*Entry, error)
+	List(ctx context.Context, envID uuid.UUID) ([]*Entry, error)
+}
+
+type GormRepository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *GormRepository {
+	return &GormRepository{
+		db: db,
+	}
+}
+
+func (r *GormRepository) bind(ctx context.Context) *gorm.DB {
+	return gormctx.Bind(ctx, r.db)
+}
+
+func (r *GormRepository) Create(ctx context.Context, entry *Entry) (*Entry, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "audit", "create"}, time.Now())
+
+	err := r.bind(ctx).Create(entry).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{"err": err, "env_id": entry.EnvironmentID.String()},
+			"unable to create the audit entry")
+		return nil, errs.WithStack(err)
+	}
+
+	return entry, nil
+}
+
+func (r *GormRepository) List(ctx context.Context, envID uuid.UUID) ([]*Entry, error) {
+	var rows []*Entry
+
+	err := r.bind(ctx).Model(&Entry{}).Where("environment_id = ?", envID).Order("created_at").Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		log.Error(ctx, map[string]interface{}{"env_id": envID.String(), "err": err},
+			"unable to list the audit entries")
+		return nil, errs.WithStack(err)
+	}
+
+	return rows, nil
+}
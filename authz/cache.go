@@ -0,0 +1,104 @@
+package authz
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/auth"
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-env/cache"
+	errs "github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	cacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fabric8_env_auth_scope_cache_hits_total",
+		Help: "Number of scope checks answered from the cache.",
+	})
+	cacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fabric8_env_auth_scope_cache_misses_total",
+		Help: "Number of scope checks sent to the auth service.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(cacheHits, cacheMisses)
+}
+
+type cacheKey struct {
+	subject    string
+	resourceID string
+	scope      string
+}
+
+// cacheEntry is the decision of the auth service, nil if the scope was granted.
+type cacheEntry struct {
+	err error
+}
+
+type cachingAuthService struct {
+	next        auth.AuthService
+	positiveTTL time.Duration
+	negativeTTL time.Duration
+	now         func() time.Time
+	cache       *cache.LRU
+}
+
+// CacheOption configures the cache created by NewCachingAuthService.
+type CacheOption func(s *cachingAuthService)
+
+// WithCacheClock replaces the clock used to expire the cache entries.
+func WithCacheClock(now func() time.Time) CacheOption {
+	return func(s *cachingAuthService) {
+		s.now = now
+	}
+}
+
+// NewCachingAuthService returns an auth service which caches the scope decisions
+// of next by token subject, resource and scope. Granted scopes are cached for
+// positiveTTL, denied ones for negativeTTL, other errors are not cached. The least
+// recently used entries are evicted when the cache holds more than maxEntries.
+func NewCachingAuthService(next auth.AuthService, positiveTTL, negativeTTL time.Duration, maxEntries int, options ...CacheOption) auth.AuthService {
+	s := &cachingAuthService{
+		next:        next,
+		positiveTTL: positiveTTL,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+	s.cache = cache.New(maxEntries, cache.WithClock(s.now))
+	return s
+}
+
+func (s *cachingAuthService) RequireScope(ctx context.Context, resourceID, requiredScope string) error {
+	subject := Subject(ctx)
+	if subject == "" {
+		return s.next.RequireScope(ctx, resourceID, requiredScope)
+	}
+	key := cacheKey{subject: subject, resourceID: resourceID, scope: requiredScope}
+	if entry, ok := s.cache.Get(key); ok {
+		cacheHits.Inc()
+		return entry.(cacheEntry).err
+	}
+	cacheMisses.Inc()
+
+	err := s.next.RequireScope(ctx, resourceID, requiredScope)
+	switch {
+	case err == nil:
+		s.cache.Put(key, cacheEntry{}, s.positiveTTL)
+	case isDenied(err):
+		s.cache.Put(key, cacheEntry{err: err}, s.negativeTTL)
+	}
+	return err
+}
+
+func isDenied(err error) bool {
+	switch errs.Cause(err).(type) {
+	case errors.ForbiddenError, errors.UnauthorizedError:
+		return true
+	}
+	return false
+}
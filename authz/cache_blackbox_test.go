@@ -0,0 +1,137 @@
+package authz_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fabric8-services/fabric8-common/errors"
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/authz"
+	errs "github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type CacheSuite struct {
+	testsuite.UnitTestSuite
+}
+
+func TestCache(t *testing.T) {
+	suite.Run(t, &CacheSuite{})
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (s *CacheSuite) TestRequireScope() {
+	clock := &testClock{now: time.Now()}
+	next := &countingAuthService{}
+	authService := authz.NewCachingAuthService(next, time.Minute, 10*time.Second, 100, authz.WithCacheClock(clock.Now))
+	ctx := contextWithClaims(jwt.MapClaims{"sub": uuid.NewV4().String()})
+	spaceID := uuid.NewV4().String()
+
+	s.T().Run("granted_cached", func(t *testing.T) {
+		require.NoError(t, authService.RequireScope(ctx, spaceID, "contribute"))
+		require.NoError(t, authService.RequireScope(ctx, spaceID, "contribute"))
+		assert.Equal(t, 1, next.calls)
+
+		// other scopes, spaces and users are cached separately
+		require.NoError(t, authService.RequireScope(ctx, spaceID, "manage"))
+		require.NoError(t, authService.RequireScope(ctx, uuid.NewV4().String(), "contribute"))
+		require.NoError(t, authService.RequireScope(contextWithClaims(jwt.MapClaims{"sub": uuid.NewV4().String()}), spaceID, "contribute"))
+		assert.Equal(t, 4, next.calls)
+	})
+
+	s.T().Run("granted_expired", func(t *testing.T) {
+		next.calls = 0
+		clock.now = clock.now.Add(time.Minute)
+		require.NoError(t, authService.RequireScope(ctx, spaceID, "contribute"))
+		assert.Equal(t, 1, next.calls)
+	})
+
+	s.T().Run("denied_cached_shorter", func(t *testing.T) {
+		next.calls = 0
+		next.err = errors.NewForbiddenError("no scope")
+		otherSpaceID := uuid.NewV4().String()
+		assert.Error(t, authService.RequireScope(ctx, otherSpaceID, "manage"))
+		assert.Error(t, authService.RequireScope(ctx, otherSpaceID, "manage"))
+		assert.Equal(t, 1, next.calls)
+
+		clock.now = clock.now.Add(10 * time.Second)
+		next.err = nil
+		assert.NoError(t, authService.RequireScope(ctx, otherSpaceID, "manage"))
+		assert.Equal(t, 2, next.calls)
+	})
+
+	s.T().Run("failure_not_cached", func(t *testing.T) {
+		next.calls = 0
+		next.err = errs.New("auth service unavailable")
+		otherSpaceID := uuid.NewV4().String()
+		assert.Error(t, authService.RequireScope(ctx, otherSpaceID, "contribute"))
+		next.err = nil
+		assert.NoError(t, authService.RequireScope(ctx, otherSpaceID, "contribute"))
+		assert.Equal(t, 2, next.calls)
+	})
+
+	s.T().Run("no_token_not_cached", func(t *testing.T) {
+		next.calls = 0
+		assert.NoError(t, authService.RequireScope(context.Background(), spaceID, "contribute"))
+		assert.NoError(t, authService.RequireScope(context.Background(), spaceID, "contribute"))
+		assert.Equal(t, 2, next.calls)
+	})
+}
+
+func (s *CacheSuite) TestSizeBound() {
+	next := &countingAuthService{}
+	authService := authz.NewCachingAuthService(next, time.Minute, time.Minute, 2)
+	ctx := contextWithClaims(jwt.MapClaims{"sub": uuid.NewV4().String()})
+	spaceIDs := []string{uuid.NewV4().String(), uuid.NewV4().String(), uuid.NewV4().String()}
+
+	for _, spaceID := range spaceIDs {
+		require.NoError(s.T(), authService.RequireScope(ctx, spaceID, "contribute"))
+	}
+	assert.Equal(s.T(), 3, next.calls)
+
+	// the least recently used entry was evicted
+	require.NoError(s.T(), authService.RequireScope(ctx, spaceIDs[2], "contribute"))
+	require.NoError(s.T(), authService.RequireScope(ctx, spaceIDs[1], "contribute"))
+	assert.Equal(s.T(), 3, next.calls)
+	require.NoError(s.T(), authService.RequireScope(ctx, spaceIDs[0], "contribute"))
+	assert.Equal(s.T(), 4, next.calls)
+}
+
+func (s *CacheSuite) TestMetrics() {
+	hits, misses := counterValue(s.T(), "fabric8_env_auth_scope_cache_hits_total"), counterValue(s.T(), "fabric8_env_auth_scope_cache_misses_total")
+	authService := authz.NewCachingAuthService(&countingAuthService{}, time.Minute, time.Minute, 10)
+	ctx := contextWithClaims(jwt.MapClaims{"sub": uuid.NewV4().String()})
+	spaceID := uuid.NewV4().String()
+
+	require.NoError(s.T(), authService.RequireScope(ctx, spaceID, "contribute"))
+	require.NoError(s.T(), authService.RequireScope(ctx, spaceID, "contribute"))
+	require.NoError(s.T(), authService.RequireScope(ctx, spaceID, "contribute"))
+
+	assert.Equal(s.T(), hits+2, counterValue(s.T(), "fabric8_env_auth_scope_cache_hits_total"))
+	assert.Equal(s.T(), misses+1, counterValue(s.T(), "fabric8_env_auth_scope_cache_misses_total"))
+}
+
+func counterValue(t *testing.T, name string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	t.Fatalf("metric %s not found", name)
+	return 0
+}
@@ -0,0 +1,83 @@
+package authz_test
+
+import (
+	"context"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fabric8-services/fabric8-common/errors"
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/authz"
+	goajwt "github.com/goadesign/goa/middleware/security/jwt"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type ServiceAccountSuite struct {
+	testsuite.UnitTestSuite
+}
+
+func TestServiceAccount(t *testing.T) {
+	suite.Run(t, &ServiceAccountSuite{})
+}
+
+// countingAuthService answers all scope checks with err and counts the calls.
+type countingAuthService struct {
+	calls int
+	err   error
+}
+
+func (s *countingAuthService) RequireScope(ctx context.Context, resourceID, requiredScope string) error {
+	s.calls++
+	return s.err
+}
+
+func (s *ServiceAccountSuite) TestRequireScope() {
+	next := &countingAuthService{}
+	authService := authz.NewServiceAccountAuthService(next, map[string][]string{
+		"fabric8-deployments": {authz.PermissionReadAll},
+		"fabric8-ops":         {authz.PermissionManageAll},
+	})
+	spaceID := uuid.NewV4().String()
+
+	s.T().Run("read_all", func(t *testing.T) {
+		ctx := contextWithClaims(jwt.MapClaims{"service_accountname": "fabric8-deployments"})
+		assert.NoError(t, authService.RequireScope(ctx, spaceID, "contribute"))
+		assert.NoError(t, authService.RequireScope(ctx, spaceID, "view"))
+		assert.IsType(t, errors.ForbiddenError{}, authService.RequireScope(ctx, spaceID, "manage"))
+		assert.IsType(t, errors.ForbiddenError{}, authService.RequireScope(ctx, spaceID, "admin"), "not a read scope")
+	})
+
+	s.T().Run("manage_all", func(t *testing.T) {
+		ctx := contextWithClaims(jwt.MapClaims{"service_accountname": "fabric8-ops"})
+		assert.NoError(t, authService.RequireScope(ctx, spaceID, "contribute"))
+		assert.NoError(t, authService.RequireScope(ctx, spaceID, "manage"))
+	})
+
+	s.T().Run("unknown_account", func(t *testing.T) {
+		ctx := contextWithClaims(jwt.MapClaims{"service_accountname": "fabric8-unknown"})
+		assert.IsType(t, errors.ForbiddenError{}, authService.RequireScope(ctx, spaceID, "contribute"))
+	})
+
+	s.T().Run("service_accounts_not_delegated", func(t *testing.T) {
+		assert.Equal(t, 0, next.calls)
+	})
+
+	s.T().Run("user_delegated", func(t *testing.T) {
+		ctx := contextWithClaims(jwt.MapClaims{"sub": uuid.NewV4().String(), "preferred_username": "user1"})
+		next.err = errors.NewForbiddenError("no scope")
+		assert.Error(t, authService.RequireScope(ctx, spaceID, "contribute"))
+		assert.Equal(t, 1, next.calls)
+	})
+}
+
+func (s *ServiceAccountSuite) TestServiceAccountName() {
+	assert.Equal(s.T(), "fabric8-ops", authz.ServiceAccountName(contextWithClaims(jwt.MapClaims{"service_accountname": "fabric8-ops"})))
+	assert.Equal(s.T(), "", authz.ServiceAccountName(contextWithClaims(jwt.MapClaims{"sub": "user1"})))
+	assert.Equal(s.T(), "", authz.ServiceAccountName(context.Background()))
+}
+
+func contextWithClaims(claims jwt.MapClaims) context.Context {
+	return goajwt.WithJWT(context.Background(), jwt.NewWithClaims(jwt.SigningMethodRS256, claims))
+}
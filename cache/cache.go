@@ -0,0 +1,142 @@
+// Package cache holds the in-memory cache used by the clients of the other
+// services and by the environment repository.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type entry struct {
+	key       interface{}
+	value     interface{}
+	expiresAt time.Time
+}
+
+// LRU caches at most maxEntries values, each until its TTL expired. The least
+// recently used entries are evicted first. It is safe for concurrent use.
+type LRU struct {
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[interface{}]*list.Element
+	// lru holds the entries, the most recently used first
+	lru *list.List
+	// generation changes with every removal, see PutIfGeneration
+	generation uint64
+}
+
+// Option configures the cache created by New.
+type Option func(c *LRU)
+
+// WithClock replaces the clock used to expire the entries.
+func WithClock(now func() time.Time) Option {
+	return func(c *LRU) {
+		c.now = now
+	}
+}
+
+// New returns an empty cache of at most maxEntries values. Nothing is cached if
+// maxEntries is not positive.
+func New(maxEntries int, options ...Option) *LRU {
+	c := &LRU{
+		maxEntries: maxEntries,
+		now:        time.Now,
+		entries:    make(map[interface{}]*list.Element),
+		lru:        list.New(),
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+	return c
+}
+
+// Get returns the unexpired value of the key, or false if there is none.
+func (c *LRU) Get(key interface{}) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	e := elem.Value.(*entry)
+	if !c.now().Before(e.expiresAt) {
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return e.value, true
+}
+
+// Put caches the value of the key for the TTL. Nothing is cached if the TTL is
+// not positive.
+func (c *LRU) Put(key, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.put(key, value, ttl)
+}
+
+// Generation returns the current generation of the cache, which changes with
+// every removal.
+func (c *LRU) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// PutIfGeneration caches the value like Put, unless an entry was removed since
+// the given generation. A value loaded while it was removed may be stale: the
+// generation must be read before loading it.
+func (c *LRU) PutIfGeneration(generation uint64, key, value interface{}, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	c.put(key, value, ttl)
+}
+
+func (c *LRU) put(key, value interface{}, ttl time.Duration) {
+	if ttl <= 0 || c.maxEntries <= 0 {
+		return
+	}
+	e := &entry{key: key, value: value, expiresAt: c.now().Add(ttl)}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = e
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(e)
+	for c.lru.Len() > c.maxEntries {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*entry).key)
+	}
+}
+
+// Remove removes the values of the keys.
+func (c *LRU) Remove(keys ...interface{}) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	for _, key := range keys {
+		if elem, ok := c.entries[key]; ok {
+			c.lru.Remove(elem)
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Purge removes all the values and returns how many were cached.
+func (c *LRU) Purge() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	n := len(c.entries)
+	c.entries = make(map[interface{}]*list.Element)
+	c.lru.Init()
+	return n
+}
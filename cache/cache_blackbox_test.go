@@ -0,0 +1,120 @@
+package cache_test
+
+import (
+	"testing"
+	"time"
+
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/cache"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type LRUSuite struct {
+	testsuite.UnitTestSuite
+}
+
+func TestLRU(t *testing.T) {
+	suite.Run(t, &LRUSuite{})
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func (s *LRUSuite) TestGet() {
+	clock := &testClock{now: time.Now()}
+	c := cache.New(10, cache.WithClock(clock.Now))
+
+	s.T().Run("cached", func(t *testing.T) {
+		c.Put("a", 1, time.Minute)
+		value, ok := c.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, 1, value)
+
+		_, ok = c.Get("b")
+		assert.False(t, ok)
+	})
+
+	s.T().Run("replaced", func(t *testing.T) {
+		c.Put("a", 2, time.Minute)
+		value, ok := c.Get("a")
+		assert.True(t, ok)
+		assert.Equal(t, 2, value)
+	})
+
+	s.T().Run("expired", func(t *testing.T) {
+		c.Put("c", 3, time.Second)
+		clock.now = clock.now.Add(time.Second)
+		_, ok := c.Get("c")
+		assert.False(t, ok)
+	})
+
+	s.T().Run("no_ttl_not_cached", func(t *testing.T) {
+		c.Put("d", 4, 0)
+		_, ok := c.Get("d")
+		assert.False(t, ok)
+	})
+
+	s.T().Run("no_entries_not_cached", func(t *testing.T) {
+		empty := cache.New(0)
+		empty.Put("a", 1, time.Minute)
+		_, ok := empty.Get("a")
+		assert.False(t, ok)
+	})
+}
+
+func (s *LRUSuite) TestEviction() {
+	c := cache.New(2)
+	c.Put("a", 1, time.Minute)
+	c.Put("b", 2, time.Minute)
+	c.Get("a")
+	c.Put("c", 3, time.Minute)
+
+	// the least recently used entry was evicted
+	_, ok := c.Get("b")
+	assert.False(s.T(), ok)
+	_, ok = c.Get("a")
+	assert.True(s.T(), ok)
+	_, ok = c.Get("c")
+	assert.True(s.T(), ok)
+}
+
+func (s *LRUSuite) TestRemove() {
+	c := cache.New(10)
+	c.Put("a", 1, time.Minute)
+	c.Put("b", 2, time.Minute)
+	c.Put("c", 3, time.Minute)
+
+	s.T().Run("remove", func(t *testing.T) {
+		c.Remove("a", "b", "unknown")
+		_, ok := c.Get("a")
+		assert.False(t, ok)
+		_, ok = c.Get("b")
+		assert.False(t, ok)
+		_, ok = c.Get("c")
+		assert.True(t, ok)
+	})
+
+	s.T().Run("purge", func(t *testing.T) {
+		assert.Equal(t, 1, c.Purge())
+		_, ok := c.Get("c")
+		assert.False(t, ok)
+	})
+
+	s.T().Run("put_if_generation", func(t *testing.T) {
+		generation := c.Generation()
+		c.Remove("other")
+		c.PutIfGeneration(generation, "a", 1, time.Minute)
+		_, ok := c.Get("a")
+		assert.False(t, ok, "a value loaded during a removal is not cached")
+
+		c.PutIfGeneration(c.Generation(), "a", 1, time.Minute)
+		_, ok = c.Get("a")
+		assert.True(t, ok)
+	})
+}
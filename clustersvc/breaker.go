@@ -0,0 +1,103 @@
+package clustersvc
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	errs "github.com/pkg/errors"
+)
+
+// ErrCircuitOpen is returned without calling the Cluster service while the
+// circuit breaker is open.
+var ErrCircuitOpen = errs.New("cluster service is unavailable, circuit breaker is open")
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case stateOpen:
+		return "open"
+	case stateHalfOpen:
+		return "half-open"
+	}
+	return "closed"
+}
+
+// breaker opens after threshold consecutive failures and rejects the calls for
+// cooldown. Then a single trial call is let through, which closes the breaker
+// when it succeeds and opens it again when it fails.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	lastErr  error
+}
+
+// allow returns ErrCircuitOpen if a call must not be made.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case stateOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return ErrCircuitOpen
+		}
+		b.state = stateHalfOpen
+		return nil
+	case stateHalfOpen:
+		// the trial call is still running
+		return ErrCircuitOpen
+	}
+	return nil
+}
+
+// record updates the breaker with the result of an allowed call.
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err == nil {
+		b.state = stateClosed
+		b.failures = 0
+		b.lastErr = nil
+		return
+	}
+	b.failures++
+	b.lastErr = err
+	if b.state == stateHalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.state = stateOpen
+		b.openedAt = b.now()
+	}
+}
+
+// release ends an allowed call without a result. A pending trial call is
+// given to the next caller.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == stateHalfOpen {
+		b.state = stateOpen
+	}
+}
+
+// status returns nil if the breaker is closed, or an error describing why it is not.
+func (b *breaker) status() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == stateClosed {
+		return nil
+	}
+	return fmt.Errorf("circuit breaker is %s since %s after %d consecutive failures, last error: %v",
+		b.state, b.openedAt.UTC().Format(time.RFC3339), b.failures, b.lastErr)
+}
@@ -0,0 +1,224 @@
+package clustersvc
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/fabric8-services/fabric8-cluster-client/cluster"
+	clusterclient "github.com/fabric8-services/fabric8-cluster-client/service"
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/fabric8-services/fabric8-env/authz"
+	"github.com/fabric8-services/fabric8-env/cache"
+	errs "github.com/pkg/errors"
+)
+
+// Config holds the settings of the Service.
+type Config interface {
+	GetClusterCacheTTL() time.Duration
+	GetClusterCacheSize() int
+	GetClusterTimeout() time.Duration
+	GetClusterRetries() int
+	GetClusterRetryBackoff() time.Duration
+	GetClusterBreakerThreshold() int
+	GetClusterBreakerCooldown() time.Duration
+}
+
+// Service wraps a Cluster service client. The clusters of a user are cached by
+// token subject, every request is bounded by a timeout, failed requests are
+// retried with a jittered exponential backoff and a circuit breaker stops
+// calling the Cluster service while it keeps failing.
+type Service struct {
+	next     clusterclient.Service
+	cacheTTL time.Duration
+	timeout  time.Duration
+	retries  int
+	backoff  time.Duration
+	now      func() time.Time
+	breaker  *breaker
+	cache    *cache.LRU
+}
+
+// Option configures a Service.
+type Option func(s *Service)
+
+// WithClock replaces the clock used to expire the cache entries and to close the
+// circuit breaker.
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+		s.breaker.now = now
+	}
+}
+
+// New returns a Service calling next with the settings of config.
+func New(next clusterclient.Service, config Config, options ...Option) *Service {
+	s := &Service{
+		next:     next,
+		cacheTTL: config.GetClusterCacheTTL(),
+		timeout:  config.GetClusterTimeout(),
+		retries:  config.GetClusterRetries(),
+		backoff:  config.GetClusterRetryBackoff(),
+		now:      time.Now,
+		breaker: &breaker{
+			threshold: config.GetClusterBreakerThreshold(),
+			cooldown:  config.GetClusterBreakerCooldown(),
+			now:       time.Now,
+		},
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+	s.cache = cache.New(config.GetClusterCacheSize(), cache.WithClock(s.now))
+	return s
+}
+
+// UserClusters returns the clusters of the user of the token in the context.
+func (s *Service) UserClusters(ctx context.Context) (*cluster.ClusterList, error) {
+	subject := authz.Subject(ctx)
+	if subject != "" {
+		if clusters, ok := s.cache.Get(subject); ok {
+			return clusters.(*cluster.ClusterList), nil
+		}
+	}
+
+	var err error
+	for attempt := 0; attempt <= s.retries; attempt++ {
+		if attempt > 0 {
+			if sleep(ctx, s.delay(attempt)) != nil {
+				return nil, err
+			}
+		}
+		var clusters *cluster.ClusterList
+		clusters, err = s.attempt(ctx)
+		if err == nil {
+			if subject != "" {
+				s.cache.Put(subject, clusters, s.cacheTTL)
+			}
+			return clusters, nil
+		}
+		if err == ErrCircuitOpen || ctx.Err() != nil || !isFailure(err) {
+			return nil, err
+		}
+		log.Warn(ctx, map[string]interface{}{
+			"attempt": attempt + 1,
+			"err":     err,
+		}, "request to the cluster service failed")
+	}
+	return nil, err
+}
+
+// Ping returns an error if the requests to the Cluster service are failing.
+func (s *Service) Ping() error {
+	return s.breaker.status()
+}
+
+func (s *Service) attempt(ctx context.Context) (*cluster.ClusterList, error) {
+	if err := s.breaker.allow(); err != nil {
+		return nil, err
+	}
+	clusters, err := s.call(ctx)
+	if err != nil && ctx.Err() != nil {
+		// the caller gave up, this says nothing about the Cluster service
+		s.breaker.release()
+		return nil, err
+	}
+	if isFailure(err) {
+		s.breaker.record(err)
+	} else {
+		// the Cluster service answered, even if it rejected the request
+		s.breaker.record(nil)
+	}
+	return clusters, err
+}
+
+// isFailure returns true if err means that the Cluster service is unreachable
+// or unhealthy, i.e. a transport error or a 5xx response. The requests rejected
+// by the Cluster service are neither retried nor counted by the breaker.
+func isFailure(err error) bool {
+	switch e := errs.Cause(err).(type) {
+	case nil:
+		return false
+	case StatusError:
+		return e.StatusCode >= 500
+	case errors.UnauthorizedError, errors.ForbiddenError, errors.NotFoundError, errors.BadParameterError:
+		return false
+	}
+	return true
+}
+
+// clientStatus finds the status of a rejected request in the errors of the Cluster
+// client, which reports the unexpected responses as untyped errors. The status
+// follows a space, '=' or an opening bracket, unlike the port of an address.
+var clientStatus = regexp.MustCompile(`(?:^|[\s=(\[])(4[0-9]{2})\b`)
+
+// clientError returns the untyped error of the Cluster client as a StatusError if
+// the Cluster service rejected the request, so that it is not taken for a
+// failure.
+func clientError(err error) error {
+	switch errs.Cause(err).(type) {
+	case nil, StatusError, errors.UnauthorizedError, errors.ForbiddenError, errors.NotFoundError, errors.BadParameterError:
+		return err
+	}
+	m := clientStatus.FindStringSubmatch(err.Error())
+	if m == nil {
+		return err
+	}
+	code, _ := strconv.Atoi(m[1])
+	return errs.WithMessage(StatusError{StatusCode: code, Status: fmt.Sprintf("%d %s", code, http.StatusText(code))}, err.Error())
+}
+
+// call calls the Cluster service and returns at the latest when the timeout
+// expires, even if the client does not honour the context.
+func (s *Service) call(ctx context.Context) (*cluster.ClusterList, error) {
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+	}
+	type result struct {
+		clusters *cluster.ClusterList
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		clusters, err := s.next.UserClusters(ctx)
+		done <- result{clusters: clusters, err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.clusters, clientError(r.err)
+	case <-ctx.Done():
+		return nil, errs.Wrap(ctx.Err(), "request to the cluster service timed out")
+	}
+}
+
+// delay returns the backoff before the given retry, with a random jitter of up
+// to half of it.
+func (s *Service) delay(retry int) time.Duration {
+	d := s.backoff << uint(retry-1)
+	if d <= 0 {
+		return 0
+	}
+	half := int64(d / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
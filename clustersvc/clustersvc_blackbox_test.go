@@ -0,0 +1,277 @@
+package clustersvc_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fabric8-services/fabric8-cluster-client/cluster"
+	clusterclient "github.com/fabric8-services/fabric8-cluster-client/service"
+	commonerrors "github.com/fabric8-services/fabric8-common/errors"
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/clustersvc"
+	goajwt "github.com/goadesign/goa/middleware/security/jwt"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ClusterServiceSuite struct {
+	testsuite.UnitTestSuite
+}
+
+func TestClusterService(t *testing.T) {
+	suite.Run(t, &ClusterServiceSuite{})
+}
+
+type testConfig struct {
+	cacheTTL         time.Duration
+	timeout          time.Duration
+	retries          int
+	breakerThreshold int
+}
+
+func (c *testConfig) GetClusterCacheTTL() time.Duration        { return c.cacheTTL }
+func (c *testConfig) GetClusterCacheSize() int                 { return 100 }
+func (c *testConfig) GetClusterTimeout() time.Duration         { return c.timeout }
+func (c *testConfig) GetClusterRetries() int                   { return c.retries }
+func (c *testConfig) GetClusterRetryBackoff() time.Duration    { return time.Millisecond }
+func (c *testConfig) GetClusterBreakerThreshold() int          { return c.breakerThreshold }
+func (c *testConfig) GetClusterBreakerCooldown() time.Duration { return 10 * time.Second }
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+// testClusterClient fails the first failures calls, with err if not nil, and
+// blocks the calls while block is not nil.
+type testClusterClient struct {
+	calls    int32
+	failures int32
+	err      error
+	block    chan struct{}
+}
+
+func (c *testClusterClient) UserClusters(ctx context.Context) (*cluster.ClusterList, error) {
+	call := atomic.AddInt32(&c.calls, 1)
+	if c.block != nil {
+		<-c.block
+	}
+	if call <= atomic.LoadInt32(&c.failures) {
+		if c.err != nil {
+			return nil, c.err
+		}
+		return nil, errors.New("cluster service error")
+	}
+	return &cluster.ClusterList{
+		Data: []*cluster.ClusterData{
+			{APIURL: "https://api.starter-us-east-2.openshift.com"},
+		},
+	}, nil
+}
+
+func (c *testClusterClient) callCount() int {
+	return int(atomic.LoadInt32(&c.calls))
+}
+
+func contextWithSubject(subject string) context.Context {
+	return goajwt.WithJWT(context.Background(), jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": subject}))
+}
+
+func (s *ClusterServiceSuite) TestCache() {
+	clock := &testClock{now: time.Now()}
+	next := &testClusterClient{}
+	svc := clustersvc.New(next, &testConfig{cacheTTL: time.Minute, timeout: time.Second}, clustersvc.WithClock(clock.Now))
+	ctx := contextWithSubject(uuid.NewV4().String())
+
+	s.T().Run("cached by subject", func(t *testing.T) {
+		clusters, err := svc.UserClusters(ctx)
+		require.NoError(t, err)
+		require.Len(t, clusters.Data, 1)
+		_, err = svc.UserClusters(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, next.callCount())
+
+		_, err = svc.UserClusters(contextWithSubject(uuid.NewV4().String()))
+		require.NoError(t, err)
+		assert.Equal(t, 2, next.callCount())
+	})
+
+	s.T().Run("expired", func(t *testing.T) {
+		clock.now = clock.now.Add(time.Minute)
+		_, err := svc.UserClusters(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 3, next.callCount())
+	})
+
+	s.T().Run("not cached without token", func(t *testing.T) {
+		_, err := svc.UserClusters(context.Background())
+		require.NoError(t, err)
+		_, err = svc.UserClusters(context.Background())
+		require.NoError(t, err)
+		assert.Equal(t, 5, next.callCount())
+	})
+
+	s.T().Run("failures not cached", func(t *testing.T) {
+		failing := &testClusterClient{failures: 1}
+		svc := clustersvc.New(failing, &testConfig{cacheTTL: time.Minute, timeout: time.Second})
+		ctx := contextWithSubject(uuid.NewV4().String())
+		_, err := svc.UserClusters(ctx)
+		require.Error(t, err)
+		_, err = svc.UserClusters(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, failing.callCount())
+	})
+}
+
+func (s *ClusterServiceSuite) TestRetries() {
+	s.T().Run("succeeds after retries", func(t *testing.T) {
+		next := &testClusterClient{failures: 2}
+		svc := clustersvc.New(next, &testConfig{timeout: time.Second, retries: 2})
+		clusters, err := svc.UserClusters(context.Background())
+		require.NoError(t, err)
+		require.Len(t, clusters.Data, 1)
+		assert.Equal(t, 3, next.callCount())
+		assert.NoError(t, svc.Ping())
+	})
+
+	s.T().Run("fails when retries are exhausted", func(t *testing.T) {
+		next := &testClusterClient{failures: 3}
+		svc := clustersvc.New(next, &testConfig{timeout: time.Second, retries: 2})
+		_, err := svc.UserClusters(context.Background())
+		require.EqualError(t, err, "cluster service error")
+		assert.Equal(t, 3, next.callCount())
+	})
+}
+
+func (s *ClusterServiceSuite) TestTimeout() {
+	next := &testClusterClient{block: make(chan struct{})}
+	defer close(next.block)
+	svc := clustersvc.New(next, &testConfig{timeout: 10 * time.Millisecond, retries: 1})
+
+	start := time.Now()
+	_, err := svc.UserClusters(context.Background())
+	require.Error(s.T(), err)
+	assert.Contains(s.T(), err.Error(), "timed out")
+	assert.Equal(s.T(), 2, next.callCount())
+	assert.True(s.T(), time.Since(start) < time.Second, "the client blocking must not block the caller")
+}
+
+func (s *ClusterServiceSuite) TestCircuitBreaker() {
+	clock := &testClock{now: time.Now()}
+	next := &testClusterClient{failures: 3}
+	svc := clustersvc.New(next, &testConfig{timeout: time.Second, breakerThreshold: 3}, clustersvc.WithClock(clock.Now))
+
+	// the breaker opens after 3 consecutive failures
+	for i := 0; i < 3; i++ {
+		_, err := svc.UserClusters(context.Background())
+		require.EqualError(s.T(), err, "cluster service error")
+	}
+	_, err := svc.UserClusters(context.Background())
+	assert.Equal(s.T(), clustersvc.ErrCircuitOpen, err)
+	assert.Equal(s.T(), 3, next.callCount())
+	require.Error(s.T(), svc.Ping())
+	assert.Contains(s.T(), svc.Ping().Error(), "circuit breaker is open")
+
+	// a trial call is let through after the cooldown and closes the breaker
+	clock.now = clock.now.Add(10 * time.Second)
+	_, err = svc.UserClusters(context.Background())
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 4, next.callCount())
+	assert.NoError(s.T(), svc.Ping())
+}
+
+func (s *ClusterServiceSuite) TestCircuitBreakerFailedTrial() {
+	clock := &testClock{now: time.Now()}
+	next := &testClusterClient{failures: 2}
+	svc := clustersvc.New(next, &testConfig{timeout: time.Second, breakerThreshold: 1}, clustersvc.WithClock(clock.Now))
+
+	_, err := svc.UserClusters(context.Background())
+	require.Error(s.T(), err)
+	clock.now = clock.now.Add(10 * time.Second)
+	_, err = svc.UserClusters(context.Background())
+	require.EqualError(s.T(), err, "cluster service error")
+
+	// the failed trial opens the breaker for another cooldown
+	_, err = svc.UserClusters(context.Background())
+	assert.Equal(s.T(), clustersvc.ErrCircuitOpen, err)
+	assert.Equal(s.T(), 2, next.callCount())
+}
+
+func (s *ClusterServiceSuite) TestRejectedRequests() {
+	for name, err := range map[string]error{
+		"unauthorized": commonerrors.NewUnauthorizedError("invalid token"),
+		"forbidden":    commonerrors.NewForbiddenError("not allowed"),
+		"status 404":   clustersvc.StatusError{StatusCode: 404, Status: "404 Not Found"},
+	} {
+		s.T().Run(name, func(t *testing.T) {
+			next := &testClusterClient{failures: 2, err: err}
+			svc := clustersvc.New(next, &testConfig{timeout: time.Second, retries: 2, breakerThreshold: 1})
+
+			// neither retried nor counted by the breaker
+			_, err := svc.UserClusters(context.Background())
+			require.Error(t, err)
+			assert.Equal(t, 1, next.callCount())
+			assert.NoError(t, svc.Ping())
+			_, err = svc.UserClusters(context.Background())
+			require.Error(t, err)
+			assert.Equal(t, 2, next.callCount())
+		})
+	}
+
+	s.T().Run("status 503", func(t *testing.T) {
+		next := &testClusterClient{failures: 3, err: clustersvc.StatusError{StatusCode: 503, Status: "503 Service Unavailable"}}
+		svc := clustersvc.New(next, &testConfig{timeout: time.Second, retries: 2, breakerThreshold: 3})
+		_, err := svc.UserClusters(context.Background())
+		require.Error(t, err)
+		assert.Equal(t, 3, next.callCount())
+		assert.Error(t, svc.Ping())
+	})
+}
+
+func (s *ClusterServiceSuite) TestClientErrors() {
+	for status, calls := range map[int]int32{
+		http.StatusUnauthorized:       1,
+		http.StatusNotFound:           1,
+		http.StatusServiceUnavailable: 3,
+	} {
+		s.T().Run(http.StatusText(status), func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&requests, 1)
+				w.Header().Set("Content-Type", "application/vnd.api+json")
+				w.WriteHeader(status)
+				w.Write([]byte(`{"errors":[{"code":"error"}]}`))
+			}))
+			defer server.Close()
+			client, err := clusterclient.NewClusterService(server.URL)
+			require.NoError(t, err)
+			svc := clustersvc.New(client, &testConfig{timeout: time.Second, retries: 2, breakerThreshold: 3})
+
+			// the requests rejected by the Cluster service are neither retried nor
+			// counted by the breaker
+			_, err = svc.UserClusters(goajwt.WithJWT(context.Background(), &jwt.Token{Raw: "user-token"}))
+			require.Error(t, err)
+			assert.Equal(t, calls, atomic.LoadInt32(&requests))
+			if status < http.StatusInternalServerError {
+				statusErr, ok := errs.Cause(err).(clustersvc.StatusError)
+				require.True(t, ok, "unexpected error: %v", err)
+				assert.Equal(t, status, statusErr.StatusCode)
+				assert.NoError(t, svc.Ping())
+			} else {
+				assert.Error(t, svc.Ping())
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package clustersvc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fabric8-services/fabric8-cluster-client/cluster"
+	goajwt "github.com/goadesign/goa/middleware/security/jwt"
+	errs "github.com/pkg/errors"
+)
+
+// clustersPath lists the configuration of all the clusters.
+const clustersPath = "/api/clusters/"
+
+// StatusError is returned when the Cluster service answers with an unexpected
+// status.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("unexpected response from the cluster service: %s", e.Status)
+}
+
+// Lister lists all the clusters configured in the Cluster service, not only the
+// ones of a user.
+type Lister struct {
+	url    string
+	client *http.Client
+}
+
+// NewLister returns a Lister calling the Cluster service at serviceURL, every
+// request is bounded by timeout.
+func NewLister(serviceURL string, timeout time.Duration) *Lister {
+	return &Lister{
+		url:    strings.TrimSuffix(serviceURL, "/") + clustersPath,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Clusters returns all the clusters. The token in the context is forwarded, it
+// must be one of a service account allowed to read the cluster configuration.
+func (l *Lister) Clusters(ctx context.Context) (*cluster.ClusterList, error) {
+	req, err := http.NewRequest(http.MethodGet, l.url, nil)
+	if err != nil {
+		return nil, errs.WithStack(err)
+	}
+	if token := goajwt.ContextJWT(ctx); token != nil {
+		req.Header.Set("Authorization", "Bearer "+token.Raw)
+	}
+	resp, err := l.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errs.Wrap(err, "unable to list the clusters")
+	}
+	defer func() {
+		io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	}()
+	if resp.StatusCode != http.StatusOK {
+		return nil, StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+	}
+	clusters := &cluster.ClusterList{}
+	if err := json.NewDecoder(resp.Body).Decode(clusters); err != nil {
+		return nil, errs.Wrap(err, "unable to decode the clusters")
+	}
+	return clusters, nil
+}
@@ -0,0 +1,62 @@
+package clustersvc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/clustersvc"
+	goajwt "github.com/goadesign/goa/middleware/security/jwt"
+	errs "github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ListerSuite struct {
+	testsuite.UnitTestSuite
+}
+
+func TestLister(t *testing.T) {
+	suite.Run(t, &ListerSuite{})
+}
+
+func (s *ListerSuite) TestClusters() {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/clusters/" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		authorization = r.Header.Get("Authorization")
+		if authorization != "Bearer sa-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data":[{"api-url":"https://api.starter-us-east-2.openshift.com/","name":"us-east-2"}]}`))
+	}))
+	defer server.Close()
+	lister := clustersvc.NewLister(server.URL+"/", time.Second)
+
+	s.T().Run("ok", func(t *testing.T) {
+		token := &jwt.Token{Raw: "sa-token"}
+		clusters, err := lister.Clusters(goajwt.WithJWT(context.Background(), token))
+		require.NoError(t, err)
+		require.Len(t, clusters.Data, 1)
+		assert.Equal(t, "https://api.starter-us-east-2.openshift.com/", clusters.Data[0].APIURL)
+	})
+
+	s.T().Run("rejected", func(t *testing.T) {
+		_, err := lister.Clusters(context.Background())
+		require.Error(t, err)
+		statusErr, ok := errs.Cause(err).(clustersvc.StatusError)
+		require.True(t, ok)
+		assert.Equal(t, http.StatusForbidden, statusErr.StatusCode)
+		assert.Empty(t, authorization)
+	})
+}
@@ -20,6 +20,25 @@ const (
 	varAuthURL                             = "auth.url"
 	varClusterURL                          = "cluster.url"
 	varAuthKeysPath                        = "auth.keys.path"
+	varAuthCacheEnabled                    = "auth.cache.enabled"
+	varAuthCacheTTL                        = "auth.cache.ttl"
+	varAuthCacheNegativeTTL                = "auth.cache.negative.ttl"
+	varAuthCacheSize                       = "auth.cache.size"
+	varClusterCacheTTL                     = "cluster.cache.ttl"
+	varClusterCacheSize                    = "cluster.cache.size"
+	varClusterTimeout                      = "cluster.timeout"
+	varClusterRetries                      = "cluster.retries"
+	varClusterRetryBackoff                 = "cluster.retry.backoff"
+	varClusterBreakerThreshold             = "cluster.breaker.threshold"
+	varClusterBreakerCooldown              = "cluster.breaker.cooldown"
+	varStatusCheckTimeout                  = "status.check.timeout"
+	varStatusCacheTTL                      = "status.cache.ttl"
+	varHTTPShutdownTimeout                 = "http.shutdown.timeout"
+	varHTTPShutdownDrainDelay              = "http.shutdown.drain.delay"
+	varHTTPTLSCertFile                     = "http.tls.cert.file"
+	varHTTPTLSKeyFile                      = "http.tls.key.file"
+	varHTTPTLSClientCAFile                 = "http.tls.client.ca.file"
+	varHTTPTLSReloadInterval               = "http.tls.reload.interval"
 	varHTTPAddress                         = "http.address"
 	varMetricsHTTPAddress                  = "metrics.http.address"
 	varDiagnoseHTTPAddress                 = "diagnose.http.address"
@@ -29,6 +48,17 @@ const (
 	varCleanTestDataEnabled                = "clean.test.data"
 	varCleanTestDataErrorReportingRequired = "clean.test.data.error.reporting.required"
 	varDBLogsEnabled                       = "enable.db.logs"
+	varAdminServiceAccounts                = "admin.service.accounts"
+	varServiceAccountPermissions           = "service.accounts.permissions"
+	varReaperInterval                      = "reaper.interval"
+	varEnvironmentCacheEnabled             = "environment.cache.enabled"
+	varEnvironmentCacheTTL                 = "environment.cache.ttl"
+	varEnvironmentCacheSize                = "environment.cache.size"
+	varSpaceEnvironmentsQuota              = "space.environments.quota"
+	varIdempotencyWindow                   = "idempotency.window"
+	varIdempotencyPurgeInterval            = "idempotency.purge.interval"
+	varSpaceServiceAccounts                = "space.service.accounts"
+	varSpaceDefaultEnvironments            = "space.default.environments"
 
 	// postgres
 	varPostgresHost                 = "postgres.host"
@@ -42,6 +72,11 @@ const (
 	varPostgresConnectionMaxIdle    = "postgres.connection.maxidle"
 	varPostgresConnectionMaxOpen    = "postgres.connection.maxopen"
 	varPostgresTransactionTimeout   = "postgres.transaction.timeout"
+	varPostgresStatementTimeout     = "postgres.statement.timeout"
+	varPostgresTransactionRetries   = "postgres.transaction.retries"
+	varPostgresReplicaDSN           = "postgres.replica.dsn"
+	varPostgresReplicaMaxLag        = "postgres.replica.max.lag"
+	varPostgresReplicaCheckInterval = "postgres.replica.check.interval"
 )
 
 type Registry struct {
@@ -115,6 +150,31 @@ func (c *Registry) setConfigDefaults() {
 	c.v.SetDefault(varCleanTestDataEnabled, true)
 	c.v.SetDefault(varCleanTestDataErrorReportingRequired, true)
 	c.v.SetDefault(varDBLogsEnabled, false)
+	c.v.SetDefault(varReaperInterval, time.Duration(time.Minute))
+	c.v.SetDefault(varEnvironmentCacheEnabled, true)
+	c.v.SetDefault(varEnvironmentCacheTTL, time.Duration(30*time.Second))
+	c.v.SetDefault(varEnvironmentCacheSize, 10000)
+	c.v.SetDefault(varAuthCacheEnabled, true)
+	c.v.SetDefault(varAuthCacheTTL, time.Duration(30*time.Second))
+	c.v.SetDefault(varAuthCacheNegativeTTL, time.Duration(5*time.Second))
+	c.v.SetDefault(varAuthCacheSize, 10000)
+	c.v.SetDefault(varClusterCacheTTL, time.Duration(time.Minute))
+	c.v.SetDefault(varClusterCacheSize, 10000)
+	c.v.SetDefault(varClusterTimeout, time.Duration(5*time.Second))
+	c.v.SetDefault(varClusterRetries, 2)
+	c.v.SetDefault(varClusterRetryBackoff, time.Duration(100*time.Millisecond))
+	c.v.SetDefault(varClusterBreakerThreshold, 5)
+	c.v.SetDefault(varClusterBreakerCooldown, time.Duration(30*time.Second))
+	c.v.SetDefault(varStatusCheckTimeout, time.Duration(2*time.Second))
+	c.v.SetDefault(varStatusCacheTTL, time.Duration(10*time.Second))
+	c.v.SetDefault(varHTTPShutdownTimeout, time.Duration(25*time.Second))
+	c.v.SetDefault(varHTTPShutdownDrainDelay, time.Duration(5*time.Second))
+	c.v.SetDefault(varHTTPTLSReloadInterval, time.Duration(time.Minute))
+	c.v.SetDefault(varSpaceEnvironmentsQuota, 50)
+	c.v.SetDefault(varIdempotencyWindow, time.Duration(24*time.Hour))
+	c.v.SetDefault(varIdempotencyPurgeInterval, time.Duration(time.Hour))
+	c.v.SetDefault(varSpaceServiceAccounts, "fabric8-wit")
+	c.v.SetDefault(varSpaceDefaultEnvironments, "stage,run")
 
 	c.v.SetDefault(varPostgresHost, "localhost")
 	c.v.SetDefault(varPostgresPort, 5436)
@@ -126,6 +186,10 @@ func (c *Registry) setConfigDefaults() {
 	c.v.SetDefault(varPostgresConnectionMaxIdle, -1)
 	c.v.SetDefault(varPostgresConnectionMaxOpen, -1)
 	c.v.SetDefault(varPostgresTransactionTimeout, time.Duration(5*time.Minute))
+	c.v.SetDefault(varPostgresStatementTimeout, time.Duration(30*time.Second))
+	c.v.SetDefault(varPostgresTransactionRetries, 3)
+	c.v.SetDefault(varPostgresReplicaMaxLag, time.Duration(10*time.Second))
+	c.v.SetDefault(varPostgresReplicaCheckInterval, time.Duration(5*time.Second))
 	c.v.SetDefault(varPostgresConnectionRetrySleep, time.Duration(time.Second))
 }
 
@@ -175,6 +239,26 @@ func (c *Registry) GetAuthKeysPath() string {
 	return c.v.GetString(varAuthKeysPath)
 }
 
+// IsAuthCacheEnabled returns true if the scope decisions of the Auth service are cached.
+func (c *Registry) IsAuthCacheEnabled() bool {
+	return c.v.GetBool(varAuthCacheEnabled)
+}
+
+// GetAuthCacheTTL returns how long a granted scope is cached.
+func (c *Registry) GetAuthCacheTTL() time.Duration {
+	return c.v.GetDuration(varAuthCacheTTL)
+}
+
+// GetAuthCacheNegativeTTL returns how long a denied scope is cached.
+func (c *Registry) GetAuthCacheNegativeTTL() time.Duration {
+	return c.v.GetDuration(varAuthCacheNegativeTTL)
+}
+
+// GetAuthCacheSize returns the maximum number of cached scope decisions.
+func (c *Registry) GetAuthCacheSize() int {
+	return c.v.GetInt(varAuthCacheSize)
+}
+
 // GetAuthServiceUrl returns Auth Service URL
 func (c *Registry) GetAuthServiceURL() string {
 	if c.v.IsSet(varAuthURL) {
@@ -196,6 +280,55 @@ func (c *Registry) GetClusterServiceURL() string {
 	return ""
 }
 
+// GetClusterCacheTTL returns how long the clusters of a user are cached.
+func (c *Registry) GetClusterCacheTTL() time.Duration {
+	return c.v.GetDuration(varClusterCacheTTL)
+}
+
+// GetClusterCacheSize returns the maximum number of users whose clusters are cached.
+func (c *Registry) GetClusterCacheSize() int {
+	return c.v.GetInt(varClusterCacheSize)
+}
+
+// GetClusterTimeout returns the timeout of a single request to the Cluster service.
+func (c *Registry) GetClusterTimeout() time.Duration {
+	return c.v.GetDuration(varClusterTimeout)
+}
+
+// GetClusterRetries returns how many times a failed request to the Cluster service is retried.
+func (c *Registry) GetClusterRetries() int {
+	return c.v.GetInt(varClusterRetries)
+}
+
+// GetClusterRetryBackoff returns the delay before the first retry, it doubles with every retry.
+func (c *Registry) GetClusterRetryBackoff() time.Duration {
+	return c.v.GetDuration(varClusterRetryBackoff)
+}
+
+// GetClusterBreakerThreshold returns the number of consecutive failed requests
+// after which the requests to the Cluster service are suspended.
+func (c *Registry) GetClusterBreakerThreshold() int {
+	return c.v.GetInt(varClusterBreakerThreshold)
+}
+
+// GetClusterBreakerCooldown returns how long the requests to the Cluster service
+// are suspended before a trial request is let through.
+func (c *Registry) GetClusterBreakerCooldown() time.Duration {
+	return c.v.GetDuration(varClusterBreakerCooldown)
+}
+
+// GetStatusCheckTimeout returns how long the status endpoint waits for the
+// database and each dependency to respond.
+func (c *Registry) GetStatusCheckTimeout() time.Duration {
+	return c.v.GetDuration(varStatusCheckTimeout)
+}
+
+// GetStatusCacheTTL returns how long the status endpoint reuses the results of
+// the dependency checks, 0 checks the dependencies on every request.
+func (c *Registry) GetStatusCacheTTL() time.Duration {
+	return c.v.GetDuration(varStatusCacheTTL)
+}
+
 func (c *Registry) GetDevModePrivateKey() []byte {
 	if c.DeveloperModeEnabled() {
 		return []byte(commonconfig.DevModeRsaPrivateKey)
@@ -207,6 +340,48 @@ func (c *Registry) GetHTTPAddress() string {
 	return c.v.GetString(varHTTPAddress)
 }
 
+// GetHTTPShutdownTimeout returns how long the in-flight requests may take to
+// complete when the service shuts down.
+func (c *Registry) GetHTTPShutdownTimeout() time.Duration {
+	return c.v.GetDuration(varHTTPShutdownTimeout)
+}
+
+// GetHTTPShutdownDrainDelay returns how long new connections are still accepted
+// when the service shuts down, after the readiness probe started to fail. It
+// is part of the shutdown timeout and must be shorter than it.
+func (c *Registry) GetHTTPShutdownDrainDelay() time.Duration {
+	return c.v.GetDuration(varHTTPShutdownDrainDelay)
+}
+
+// IsHTTPTLSEnabled returns true if the service is served over HTTPS, i.e. if
+// any of the TLS files is set.
+func (c *Registry) IsHTTPTLSEnabled() bool {
+	return c.GetHTTPTLSCertFile() != "" || c.GetHTTPTLSKeyFile() != "" || c.GetHTTPTLSClientCAFile() != ""
+}
+
+// GetHTTPTLSCertFile returns the path of the PEM encoded certificate of the service.
+func (c *Registry) GetHTTPTLSCertFile() string {
+	return c.v.GetString(varHTTPTLSCertFile)
+}
+
+// GetHTTPTLSKeyFile returns the path of the PEM encoded private key of the service.
+func (c *Registry) GetHTTPTLSKeyFile() string {
+	return c.v.GetString(varHTTPTLSKeyFile)
+}
+
+// GetHTTPTLSClientCAFile returns the path of the PEM encoded CA bundle client
+// certificates must be signed by, or an empty string if clients are not
+// required to present a certificate. The probes and the metrics never require
+// one.
+func (c *Registry) GetHTTPTLSClientCAFile() string {
+	return c.v.GetString(varHTTPTLSClientCAFile)
+}
+
+// GetHTTPTLSReloadInterval returns how often the TLS files are checked for changes.
+func (c *Registry) GetHTTPTLSReloadInterval() time.Duration {
+	return c.v.GetDuration(varHTTPTLSReloadInterval)
+}
+
 func (c *Registry) GetMetricsHTTPAddress() string {
 	return c.v.GetString(varMetricsHTTPAddress)
 }
@@ -260,7 +435,7 @@ func (c *Registry) GetPostgresConnectionTimeout() int64 {
 }
 
 func (c *Registry) GetPostgresConfigString() string {
-	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s connect_timeout=%d",
+	config := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s connect_timeout=%d",
 		c.GetPostgresHost(),
 		c.GetPostgresPort(),
 		c.GetPostgresUser(),
@@ -269,6 +444,47 @@ func (c *Registry) GetPostgresConfigString() string {
 		c.GetPostgresSSLMode(),
 		c.GetPostgresConnectionTimeout(),
 	)
+	if timeout := c.GetPostgresStatementTimeout(); timeout > 0 {
+		config += fmt.Sprintf(" statement_timeout=%d", int64(timeout/time.Millisecond))
+	}
+	return config
+}
+
+// GetPostgresReplicaConfigString returns the connection string of the read
+// replica, or an empty string if there is none.
+func (c *Registry) GetPostgresReplicaConfigString() string {
+	config := c.v.GetString(varPostgresReplicaDSN)
+	if config == "" {
+		return ""
+	}
+	if timeout := c.GetPostgresStatementTimeout(); timeout > 0 {
+		config += fmt.Sprintf(" statement_timeout=%d", int64(timeout/time.Millisecond))
+	}
+	return config
+}
+
+// GetPostgresReplicaMaxLag returns how far the read replica may lag behind the
+// primary before the reads are sent to the primary.
+func (c *Registry) GetPostgresReplicaMaxLag() time.Duration {
+	return c.v.GetDuration(varPostgresReplicaMaxLag)
+}
+
+// GetPostgresReplicaCheckInterval returns how often the health and the lag of
+// the read replica are checked.
+func (c *Registry) GetPostgresReplicaCheckInterval() time.Duration {
+	return c.v.GetDuration(varPostgresReplicaCheckInterval)
+}
+
+// GetPostgresTransactionRetries returns how many times a transaction is run
+// again after a serialization failure or a deadlock.
+func (c *Registry) GetPostgresTransactionRetries() int {
+	return c.v.GetInt(varPostgresTransactionRetries)
+}
+
+// GetPostgresStatementTimeout returns how long a single statement may run before
+// Postgres cancels it, zero disables the timeout.
+func (c *Registry) GetPostgresStatementTimeout() time.Duration {
+	return c.v.GetDuration(varPostgresStatementTimeout)
 }
 
 func (c *Registry) GetPostgresConnectionRetrySleep() time.Duration {
@@ -307,6 +523,114 @@ func (c *Registry) IsDBLogsEnabled() bool {
 	return c.v.GetBool(varDBLogsEnabled)
 }
 
+// GetAdminServiceAccounts returns the names of the service accounts which are
+// allowed to call the admin endpoints. In environment variables the names are
+// separated by commas.
+func (c *Registry) GetAdminServiceAccounts() []string {
+	return c.getStringList(varAdminServiceAccounts)
+}
+
+// GetServiceAccountPermissions returns the permissions of the service accounts
+// which are allowed to access the environments of all spaces, by account name. In
+// environment variables the permissions are given as comma separated
+// 'account:permission' pairs, e.g. "fabric8-deployments:read-all".
+func (c *Registry) GetServiceAccountPermissions() map[string][]string {
+	res := make(map[string][]string)
+	switch v := c.v.Get(varServiceAccountPermissions).(type) {
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			parts := strings.SplitN(item, ":", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			name, perm := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+			if name != "" && perm != "" {
+				res[name] = append(res[name], perm)
+			}
+		}
+	case nil:
+	default:
+		for name, perms := range c.v.GetStringMapStringSlice(varServiceAccountPermissions) {
+			res[name] = perms
+		}
+	}
+	return res
+}
+
+// GetSpaceServiceAccounts returns the names of the service accounts which notify
+// about the lifecycle of spaces, e.g. to delete the environments of a deleted space.
+// In environment variables the names are separated by commas.
+func (c *Registry) GetSpaceServiceAccounts() []string {
+	return c.getStringList(varSpaceServiceAccounts)
+}
+
+// GetSpaceDefaultEnvironments returns the types of the environments created for a
+// new space. In environment variables the types are separated by commas.
+func (c *Registry) GetSpaceDefaultEnvironments() []string {
+	return c.getStringList(varSpaceDefaultEnvironments)
+}
+
+// GetReaperInterval returns how often expired environments are deleted. A zero
+// interval disables the reaper.
+func (c *Registry) GetReaperInterval() time.Duration {
+	return c.v.GetDuration(varReaperInterval)
+}
+
+// IsEnvironmentCacheEnabled returns true if the environments loaded by ID are
+// cached.
+func (c *Registry) IsEnvironmentCacheEnabled() bool {
+	return c.v.GetBool(varEnvironmentCacheEnabled)
+}
+
+// GetEnvironmentCacheTTL returns how long an environment is cached, unless it is
+// changed before.
+func (c *Registry) GetEnvironmentCacheTTL() time.Duration {
+	return c.v.GetDuration(varEnvironmentCacheTTL)
+}
+
+// GetEnvironmentCacheSize returns the maximum number of cached environments.
+func (c *Registry) GetEnvironmentCacheSize() int {
+	return c.v.GetInt(varEnvironmentCacheSize)
+}
+
+// GetSpaceEnvironmentsQuota returns the default maximum number of environments in
+// a space. Spaces can have their own limit stored in the DB. A negative value
+// disables the limit.
+func (c *Registry) GetSpaceEnvironmentsQuota() int {
+	return c.v.GetInt(varSpaceEnvironmentsQuota)
+}
+
+// GetIdempotencyWindow returns how long the response to a request with an
+// Idempotency-Key header is kept for replay.
+func (c *Registry) GetIdempotencyWindow() time.Duration {
+	return c.v.GetDuration(varIdempotencyWindow)
+}
+
+// GetIdempotencyPurgeInterval returns how often the expired idempotency keys are
+// deleted. A zero interval disables the purge.
+func (c *Registry) GetIdempotencyPurgeInterval() time.Duration {
+	return c.v.GetDuration(varIdempotencyPurgeInterval)
+}
+
+func (c *Registry) getStringList(key string) []string {
+	var res []string
+	switch v := c.v.Get(key).(type) {
+	case string:
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				res = append(res, item)
+			}
+		}
+	default:
+		for _, item := range c.v.GetStringSlice(key) {
+			if item = strings.TrimSpace(item); item != "" {
+				res = append(res, item)
+			}
+		}
+	}
+	return res
+}
+
 func (c *Registry) DefaultConfigError() error {
 	return c.defaultConfigError
 }
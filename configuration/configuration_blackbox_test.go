@@ -2,7 +2,9 @@ package configuration_test
 
 import (
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
 	"github.com/fabric8-services/fabric8-env/configuration"
@@ -87,6 +89,101 @@ func (s *ConfigurationTestSuite) TestConfigErr() {
 	assert.Equal(t, "Auth service url is empty", configErr.Error())
 }
 
+func (s *ConfigurationTestSuite) TestAdminServiceAccounts() {
+	existing, set := os.LookupEnv("F8_ADMIN_SERVICE_ACCOUNTS")
+	defer func() {
+		if set {
+			os.Setenv("F8_ADMIN_SERVICE_ACCOUNTS", existing)
+		} else {
+			os.Unsetenv("F8_ADMIN_SERVICE_ACCOUNTS")
+		}
+	}()
+
+	os.Unsetenv("F8_ADMIN_SERVICE_ACCOUNTS")
+	config, err := configuration.New("")
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), config.GetAdminServiceAccounts())
+
+	os.Setenv("F8_ADMIN_SERVICE_ACCOUNTS", "fabric8-ops, fabric8-cluster,")
+	config, err = configuration.New("")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{"fabric8-ops", "fabric8-cluster"}, config.GetAdminServiceAccounts())
+}
+
+func (s *ConfigurationTestSuite) TestServiceAccountPermissions() {
+	existing, set := os.LookupEnv("F8_SERVICE_ACCOUNTS_PERMISSIONS")
+	defer func() {
+		if set {
+			os.Setenv("F8_SERVICE_ACCOUNTS_PERMISSIONS", existing)
+		} else {
+			os.Unsetenv("F8_SERVICE_ACCOUNTS_PERMISSIONS")
+		}
+	}()
+
+	os.Unsetenv("F8_SERVICE_ACCOUNTS_PERMISSIONS")
+	config, err := configuration.New("")
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), config.GetServiceAccountPermissions())
+
+	os.Setenv("F8_SERVICE_ACCOUNTS_PERMISSIONS", "fabric8-deployments:read-all, fabric8-ops:read-all,fabric8-ops:manage-all,invalid")
+	config, err = configuration.New("")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), map[string][]string{
+		"fabric8-deployments": {"read-all"},
+		"fabric8-ops":         {"read-all", "manage-all"},
+	}, config.GetServiceAccountPermissions())
+}
+
+func (s *ConfigurationTestSuite) TestSpaceServiceAccounts() {
+	config, err := configuration.New("")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), []string{"fabric8-wit"}, config.GetSpaceServiceAccounts())
+	assert.Equal(s.T(), []string{"stage", "run"}, config.GetSpaceDefaultEnvironments())
+}
+
+func (s *ConfigurationTestSuite) TestPostgresStatementTimeout() {
+	existing, set := os.LookupEnv("F8_POSTGRES_STATEMENT_TIMEOUT")
+	defer func() {
+		if set {
+			os.Setenv("F8_POSTGRES_STATEMENT_TIMEOUT", existing)
+		} else {
+			os.Unsetenv("F8_POSTGRES_STATEMENT_TIMEOUT")
+		}
+	}()
+
+	os.Unsetenv("F8_POSTGRES_STATEMENT_TIMEOUT")
+	config, err := configuration.New("")
+	require.NoError(s.T(), err)
+	assert.True(s.T(), strings.HasSuffix(config.GetPostgresConfigString(), " statement_timeout=30000"))
+
+	os.Setenv("F8_POSTGRES_STATEMENT_TIMEOUT", "0s")
+	config, err = configuration.New("")
+	require.NoError(s.T(), err)
+	assert.NotContains(s.T(), config.GetPostgresConfigString(), "statement_timeout")
+}
+
+func (s *ConfigurationTestSuite) TestPostgresReplica() {
+	existing, set := os.LookupEnv("F8_POSTGRES_REPLICA_DSN")
+	defer func() {
+		if set {
+			os.Setenv("F8_POSTGRES_REPLICA_DSN", existing)
+		} else {
+			os.Unsetenv("F8_POSTGRES_REPLICA_DSN")
+		}
+	}()
+
+	os.Unsetenv("F8_POSTGRES_REPLICA_DSN")
+	config, err := configuration.New("")
+	require.NoError(s.T(), err)
+	assert.Empty(s.T(), config.GetPostgresReplicaConfigString())
+	assert.Equal(s.T(), 10*time.Second, config.GetPostgresReplicaMaxLag())
+
+	os.Setenv("F8_POSTGRES_REPLICA_DSN", "host=replica port=5432")
+	config, err = configuration.New("")
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "host=replica port=5432 statement_timeout=30000", config.GetPostgresReplicaConfigString())
+}
+
 func createConfigAndGetConfigErr(t *testing.T) error {
 	config, err := configuration.New("")
 	require.NoError(t, err)
@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+
+	clusterclient "github.com/fabric8-services/fabric8-cluster-client/service"
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-common/httpsupport"
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/fabric8-services/fabric8-env/app"
+	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/audit"
+	"github.com/fabric8-services/fabric8-env/environment"
+	"github.com/goadesign/goa"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+type adminConfig interface {
+	quotaConfig
+	GetAdminServiceAccounts() []string
+}
+
+// clusterLister lists all the clusters known to the Cluster service.
+type clusterLister interface {
+	Clusters(ctx context.Context) (*clusterclient.ClusterList, error)
+}
+
+type AdminController struct {
+	*goa.Controller
+	db       application.DB
+	clusters clusterLister
+	config   adminConfig
+}
+
+func NewAdminController(service *goa.Service, db application.DB, clusters clusterLister, config adminConfig) *AdminController {
+	return &AdminController{
+		Controller: service.NewController("AdminController"),
+		db:         db,
+		clusters:   clusters,
+		config:     config,
+	}
+}
+
+func (c *AdminController) MoveCluster(ctx *app.MoveClusterAdminContext) error {
+	err := c.requireAdmin(ctx)
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	reqMove := ctx.Payload.Data
+	if reqMove == nil {
+		return app.JSONErrorResponse(ctx, errors.NewBadParameterError("data", nil).Expected("not nil"))
+	}
+	oldClusterURL := httpsupport.RemoveTrailingSlashFromURL(reqMove.Attributes.OldClusterURL)
+	newClusterURL := httpsupport.RemoveTrailingSlashFromURL(reqMove.Attributes.NewClusterURL)
+	if oldClusterURL == newClusterURL {
+		return app.JSONErrorResponse(ctx, errors.NewBadParameterError("new-cluster-url", newClusterURL).Expected("different from old-cluster-url"))
+	}
+	dryRun := reqMove.Attributes.DryRun != nil && *reqMove.Attributes.DryRun
+
+	err = checkClusterKnown(ctx, c.clusters, newClusterURL, "new-cluster-url")
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	// locked environments are left unchanged and reported
+	var envs []*environment.Environment
+	var skipped []uuid.UUID
+	err = application.Transactional(ctx, c.db, func(appl application.Application) error {
+		now := time.Now()
+		var err error
+		envs, skipped = nil, nil
+		if !dryRun {
+			envs, err = appl.Environments().MoveCluster(ctx, oldClusterURL, newClusterURL, now)
+			if err != nil {
+				return errs.Wrapf(err, "failed to move the environments of cluster: %s", oldClusterURL)
+			}
+		}
+		// the environments left on the old cluster are the locked ones
+		remaining, err := appl.Environments().ListByCluster(ctx, oldClusterURL)
+		if err != nil {
+			return err
+		}
+		for _, env := range remaining {
+			if env.IsLocked(now) {
+				skipped = append(skipped, *env.ID)
+			} else if dryRun {
+				envs = append(envs, env)
+			}
+		}
+
+		if dryRun {
+			return nil
+		}
+		actor := actorFromContext(ctx)
+		for _, env := range envs {
+			_, err := appl.AuditLogs().Create(ctx, &audit.Entry{
+				EnvironmentID: *env.ID,
+				SpaceID:       *env.SpaceID,
+				Action:        audit.ActionMoveCluster,
+				Actor:         actor,
+				Details: audit.Details{
+					"old-cluster-url": oldClusterURL,
+					"new-cluster-url": newClusterURL,
+				},
+			})
+			if err != nil {
+				return errs.Wrapf(err, "failed to audit move of environment: %s", env.ID)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"old_cluster_url": oldClusterURL,
+		"new_cluster_url": newClusterURL,
+		"dry_run":         dryRun,
+		"count":           len(envs),
+		"skipped":         len(skipped),
+	}, "moved environments between clusters")
+
+	res := ConvertEnvironments(envs)
+	res.Meta = &app.EnvironmentListMeta{TotalCount: len(envs), Skipped: skipped}
+	return ctx.OK(res)
+}
+
+const (
+	// defaultPageLimit is the page size of environment lists if none is requested.
+	defaultPageLimit = 100
+	exportFormatCSV  = "csv"
+)
+
+var csvHeader = []string{"id", "space-id", "name", "type", "cluster-url", "namespace-name", "created-at", "expires-at", "protected"}
+
+func (c *AdminController) ListEnvironments(ctx *app.ListEnvironmentsAdminContext) error {
+	err := c.requireAdmin(ctx)
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	filter := environment.Filter{
+		ClusterURL:    ctx.Cluster,
+		Type:          ctx.Type,
+		CreatedAfter:  ctx.CreatedAfter,
+		CreatedBefore: ctx.CreatedBefore,
+	}
+	offset := 0
+	if ctx.PageOffset != nil {
+		offset = *ctx.PageOffset
+	}
+	limit := defaultPageLimit
+	if ctx.PageLimit != nil {
+		limit = *ctx.PageLimit
+	} else if ctx.Format == exportFormatCSV {
+		limit = -1
+	}
+
+	envs, total, err := c.db.Environments().ListAll(ctx, filter, offset, limit)
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	if ctx.Format == exportFormatCSV {
+		return writeEnvironmentsCSV(ctx, envs)
+	}
+
+	res := ConvertEnvironments(envs)
+	res.Meta = &app.EnvironmentListMeta{TotalCount: total}
+	if limit > 0 {
+		req := &goa.RequestData{Request: ctx.Request}
+		res.Links = &app.PagingLinks{
+			First: pagingLink(req, 0, limit),
+		}
+		lastOffset := 0
+		if total > 0 {
+			lastOffset = (total - 1) / limit * limit
+		}
+		res.Links.Last = pagingLink(req, lastOffset, limit)
+		if offset > 0 {
+			prevOffset := offset - limit
+			if prevOffset < 0 {
+				prevOffset = 0
+			}
+			res.Links.Prev = pagingLink(req, prevOffset, limit)
+		}
+		if offset+limit < total {
+			res.Links.Next = pagingLink(req, offset+limit, limit)
+		}
+	}
+	return ctx.OK(res)
+}
+
+// pagingLink returns the URL of the request with the given page.
+func pagingLink(req *goa.RequestData, offset, limit int) *string {
+	query := req.URL.Query()
+	query.Set("page[offset]", strconv.Itoa(offset))
+	query.Set("page[limit]", strconv.Itoa(limit))
+	link := httpsupport.AbsoluteURL(req, req.URL.Path, nil) + "?" + query.Encode()
+	return &link
+}
+
+func writeEnvironmentsCSV(ctx *app.ListEnvironmentsAdminContext, envs []*environment.Environment) error {
+	ctx.ResponseData.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	ctx.ResponseData.Header().Set("Content-Disposition", `attachment; filename="environments.csv"`)
+	ctx.ResponseData.WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(ctx.ResponseData)
+	if err := w.Write(csvHeader); err != nil {
+		return errs.WithStack(err)
+	}
+	for _, env := range envs {
+		var namespaceName, expiresAt string
+		if env.NamespaceName != nil {
+			namespaceName = *env.NamespaceName
+		}
+		if env.ExpiresAt != nil {
+			expiresAt = env.ExpiresAt.UTC().Format(time.RFC3339)
+		}
+		err := w.Write([]string{
+			env.ID.String(),
+			env.SpaceID.String(),
+			*env.Name,
+			*env.Type,
+			*env.ClusterURL,
+			namespaceName,
+			env.CreatedAt.UTC().Format(time.RFC3339),
+			expiresAt,
+			strconv.FormatBool(env.Protected),
+		})
+		if err != nil {
+			return errs.WithStack(err)
+		}
+	}
+	w.Flush()
+	return errs.WithStack(w.Error())
+}
+
+// requireAdmin checks that the caller uses a token of one of the configured admin
+// service accounts.
+func (c *AdminController) requireAdmin(ctx context.Context) error {
+	return requireServiceAccount(ctx, c.config.GetAdminServiceAccounts())
+}
+
+// checkClusterKnown verifies that the cluster is known to the Cluster service, the
+// param names the request parameter holding the URL.
+func checkClusterKnown(ctx context.Context, clusters clusterLister, clusterURL, param string) error {
+	list, err := clusters.Clusters(ctx)
+	if err != nil {
+		return err
+	}
+	for _, cluster := range list.Data {
+		if httpsupport.RemoveTrailingSlashFromURL(cluster.APIURL) == clusterURL {
+			return nil
+		}
+	}
+	return errors.NewBadParameterError(param, clusterURL).Expected("cluster known to the cluster service")
+}
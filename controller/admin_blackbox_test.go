@@ -0,0 +1,303 @@
+package controller_test
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/fabric8-services/fabric8-common/convert/ptr"
+	testauth "github.com/fabric8-services/fabric8-common/test/auth"
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/app"
+	"github.com/fabric8-services/fabric8-env/app/test"
+	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/audit"
+	"github.com/fabric8-services/fabric8-env/configuration"
+	"github.com/fabric8-services/fabric8-env/controller"
+	"github.com/fabric8-services/fabric8-env/environment"
+	"github.com/fabric8-services/fabric8-env/gormapp"
+	"github.com/goadesign/goa"
+	goajwt "github.com/goadesign/goa/middleware/security/jwt"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type AdminControllerSuite struct {
+	testsuite.DBTestSuite
+	db application.DB
+
+	svc      *goa.Service
+	adminCtx context.Context
+	ctrl     *controller.AdminController
+	envCtrl  *controller.EnvironmentController
+}
+
+type testAdminConfig struct{}
+
+func (c *testAdminConfig) GetAdminServiceAccounts() []string {
+	return []string{"fabric8-ops"}
+}
+
+func (c *testAdminConfig) GetSpaceEnvironmentsQuota() int {
+	return 50
+}
+
+func TestAdminController(t *testing.T) {
+	config, err := configuration.New("")
+	require.NoError(t, err)
+	suite.Run(t, &AdminControllerSuite{DBTestSuite: testsuite.NewDBTestSuite(config)})
+}
+
+func (s *AdminControllerSuite) SetupSuite() {
+	s.DBTestSuite.SetupSuite()
+	s.setup(gormapp.NewGormDB(s.DB))
+}
+
+func (s *AdminControllerSuite) setup(db application.DB) {
+	s.db = db
+	s.svc = testauth.UnsecuredService("admin-test")
+	s.adminCtx = contextWithServiceAccount("fabric8-ops")
+	s.ctrl = controller.NewAdminController(s.svc, s.db, &testClusterService{}, &testAdminConfig{})
+	config, err := configuration.New("")
+	require.NoError(s.T(), err)
+	s.envCtrl = controller.NewEnvironmentController(s.svc, s.db, &testAuthService{}, &testClusterService{}, &testClusterService{}, config)
+}
+
+func (s *AdminControllerSuite) TestMoveCluster() {
+	oldClusterURL := "https://" + uuid.NewV4().String() + ".com"
+	spaceID := uuid.NewV4()
+	envIDs := make([]uuid.UUID, 2)
+	for ind := range envIDs {
+		env, err := s.db.Environments().Create(s.svc.Context, newEnvironment("osio-stage", "stage", oldClusterURL, spaceID))
+		require.NoError(s.T(), err)
+		envIDs[ind] = *env.ID
+	}
+
+	s.T().Run("dry_run", func(t *testing.T) {
+		payload := newMoveClusterPayload(oldClusterURL+"/", "cluster1.com", true)
+
+		_, list := test.MoveClusterAdminOK(t, s.adminCtx, s.svc, s.ctrl, payload)
+		require.NotNil(t, list)
+		assert.Equal(t, 2, list.Meta.TotalCount)
+
+		env, err := s.db.Environments().Load(s.svc.Context, envIDs[0])
+		require.NoError(t, err)
+		assert.Equal(t, oldClusterURL, *env.ClusterURL)
+	})
+
+	s.T().Run("unknown_cluster", func(t *testing.T) {
+		payload := newMoveClusterPayload(oldClusterURL, "cluster2.com", false)
+		_, err := test.MoveClusterAdminBadRequest(t, s.adminCtx, s.svc, s.ctrl, payload)
+		assert.NotNil(t, err)
+	})
+
+	s.T().Run("not_admin", func(t *testing.T) {
+		payload := newMoveClusterPayload(oldClusterURL, "cluster1.com", false)
+		_, err := test.MoveClusterAdminForbidden(t, contextWithServiceAccount("fabric8-tenant"), s.svc, s.ctrl, payload)
+		assert.NotNil(t, err)
+		_, err = test.MoveClusterAdminForbidden(t, s.svc.Context, s.svc, s.ctrl, payload)
+		assert.NotNil(t, err)
+	})
+
+	s.T().Run("ok", func(t *testing.T) {
+		payload := newMoveClusterPayload(oldClusterURL, "cluster1.com", false)
+
+		_, list := test.MoveClusterAdminOK(t, s.adminCtx, s.svc, s.ctrl, payload)
+		require.NotNil(t, list)
+		assert.Equal(t, 2, list.Meta.TotalCount)
+
+		for _, envID := range envIDs {
+			env, err := s.db.Environments().Load(s.svc.Context, envID)
+			require.NoError(t, err)
+			assert.Equal(t, "cluster1.com", *env.ClusterURL)
+
+			entries, err := s.db.AuditLogs().List(s.svc.Context, envID)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, audit.ActionMoveCluster, entries[0].Action)
+			assert.Equal(t, "service-account:fabric8-ops", entries[0].Actor)
+			assert.Equal(t, oldClusterURL, entries[0].Details["old-cluster-url"])
+		}
+
+		_, list = test.MoveClusterAdminOK(t, s.adminCtx, s.svc, s.ctrl, payload)
+		assert.Equal(t, 0, list.Meta.TotalCount)
+	})
+
+	s.T().Run("locked_skipped", func(t *testing.T) {
+		clusterURL := "https://" + uuid.NewV4().String() + ".com"
+		unlocked, err := s.db.Environments().Create(s.svc.Context, newEnvironment("osio-stage", "stage", clusterURL, spaceID))
+		require.NoError(t, err)
+		lockedEnv := newEnvironment("osio-run", "run", clusterURL, spaceID)
+		lockedAt := time.Now()
+		lockedEnv.LockedAt = &lockedAt
+		lockedEnv.LockedBy = ptr.String("user1")
+		lockedEnv.LockReason = ptr.String("release freeze")
+		locked, err := s.db.Environments().Create(s.svc.Context, lockedEnv)
+		require.NoError(t, err)
+
+		_, list := test.MoveClusterAdminOK(t, s.adminCtx, s.svc, s.ctrl, newMoveClusterPayload(clusterURL, "cluster1.com", false))
+		require.NotNil(t, list)
+		assert.Equal(t, 1, list.Meta.TotalCount)
+		assert.Equal(t, *unlocked.ID, *list.Data[0].ID)
+		assert.Equal(t, []uuid.UUID{*locked.ID}, list.Meta.Skipped)
+
+		env, err := s.db.Environments().Load(s.svc.Context, *locked.ID)
+		require.NoError(t, err)
+		assert.Equal(t, clusterURL, *env.ClusterURL)
+	})
+}
+
+func (s *AdminControllerSuite) TestListEnvironments() {
+	clusterURL := "https://" + uuid.NewV4().String() + ".com"
+	start := time.Now().Add(-time.Second)
+	envIDs := make([]uuid.UUID, 3)
+	for ind, envType := range []string{"stage", "run", "stage"} {
+		env, err := s.db.Environments().Create(s.svc.Context, newEnvironment("osio-"+envType, envType, clusterURL, uuid.NewV4()))
+		require.NoError(s.T(), err)
+		envIDs[ind] = *env.ID
+	}
+	json := "json"
+
+	s.T().Run("by_cluster", func(t *testing.T) {
+		_, list := test.ListEnvironmentsAdminOK(t, s.adminCtx, s.svc, s.ctrl, &clusterURL, nil, nil, json, nil, nil, nil)
+		require.NotNil(t, list)
+		assert.Equal(t, 3, list.Meta.TotalCount)
+		require.Len(t, list.Data, 3)
+		for ind, envID := range envIDs {
+			assert.Equal(t, envID, *list.Data[ind].ID)
+			assert.NotNil(t, list.Data[ind].Attributes.SpaceID)
+		}
+	})
+
+	s.T().Run("by_type_and_date", func(t *testing.T) {
+		_, list := test.ListEnvironmentsAdminOK(t, s.adminCtx, s.svc, s.ctrl, &clusterURL, &start, nil, json, nil, nil, ptr.String("stage"))
+		assert.Equal(t, 2, list.Meta.TotalCount)
+
+		_, list = test.ListEnvironmentsAdminOK(t, s.adminCtx, s.svc, s.ctrl, &clusterURL, nil, &start, json, nil, nil, nil)
+		assert.Equal(t, 0, list.Meta.TotalCount)
+	})
+
+	s.T().Run("paging", func(t *testing.T) {
+		offset, limit := 0, 2
+		_, list := test.ListEnvironmentsAdminOK(t, s.adminCtx, s.svc, s.ctrl, &clusterURL, nil, nil, json, &limit, &offset, nil)
+		assert.Equal(t, 3, list.Meta.TotalCount)
+		require.Len(t, list.Data, 2)
+		require.NotNil(t, list.Links.Next)
+		assert.Contains(t, *list.Links.Next, "page%5Boffset%5D=2")
+		assert.Nil(t, list.Links.Prev)
+
+		offset = 2
+		_, list = test.ListEnvironmentsAdminOK(t, s.adminCtx, s.svc, s.ctrl, &clusterURL, nil, nil, json, &limit, &offset, nil)
+		require.Len(t, list.Data, 1)
+		assert.Equal(t, envIDs[2], *list.Data[0].ID)
+		assert.Nil(t, list.Links.Next)
+		assert.NotNil(t, list.Links.Prev)
+	})
+
+	s.T().Run("csv", func(t *testing.T) {
+		rw, _ := test.ListEnvironmentsAdminOK(t, s.adminCtx, s.svc, s.ctrl, &clusterURL, nil, nil, "csv", nil, nil, nil)
+		assert.Contains(t, rw.Header().Get("Content-Type"), "text/csv")
+		records, err := csv.NewReader(rw.(*httptest.ResponseRecorder).Body).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 4)
+		assert.Equal(t, "id", records[0][0])
+		assert.Equal(t, envIDs[0].String(), records[1][0])
+		assert.Equal(t, clusterURL, records[1][4])
+	})
+
+	s.T().Run("not_admin", func(t *testing.T) {
+		_, err := test.ListEnvironmentsAdminForbidden(t, contextWithServiceAccount("fabric8-tenant"), s.svc, s.ctrl, nil, nil, nil, json, nil, nil, nil)
+		assert.NotNil(t, err)
+	})
+}
+
+func (s *AdminControllerSuite) TestSpaceQuota() {
+	spaceID := uuid.NewV4()
+
+	s.T().Run("show_default", func(t *testing.T) {
+		_, q := test.ShowSpaceQuotaAdminOK(t, s.adminCtx, s.svc, s.ctrl, spaceID)
+		require.NotNil(t, q)
+		assert.Equal(t, 50, q.Data.Attributes.MaxEnvironments)
+		assert.True(t, *q.Data.Attributes.Default)
+	})
+
+	s.T().Run("set_ok", func(t *testing.T) {
+		_, q := test.SetSpaceQuotaAdminOK(t, s.adminCtx, s.svc, s.ctrl, spaceID, newSpaceQuotaPayload(1))
+		require.NotNil(t, q)
+		assert.Equal(t, 1, q.Data.Attributes.MaxEnvironments)
+		assert.False(t, *q.Data.Attributes.Default)
+
+		_, q = test.ShowSpaceQuotaAdminOK(t, s.adminCtx, s.svc, s.ctrl, spaceID)
+		assert.Equal(t, 1, q.Data.Attributes.MaxEnvironments)
+
+		test.CreateEnvironmentCreated(t, s.svc.Context, s.svc, s.envCtrl, spaceID, nil, newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com"))
+		_, jerrs := test.CreateEnvironmentForbidden(t, s.svc.Context, s.svc, s.envCtrl, spaceID, nil, newCreateEnvironmentPayload("osio-run", "run", "cluster1.com"))
+		require.NotNil(t, jerrs)
+		require.Len(t, jerrs.Errors, 1)
+		assert.Equal(t, "quota_exceeded", *jerrs.Errors[0].Code)
+	})
+
+	s.T().Run("set_negative", func(t *testing.T) {
+		_, err := test.SetSpaceQuotaAdminBadRequest(t, s.adminCtx, s.svc, s.ctrl, spaceID, newSpaceQuotaPayload(-1))
+		assert.NotNil(t, err)
+	})
+
+	s.T().Run("delete_ok", func(t *testing.T) {
+		test.DeleteSpaceQuotaAdminNoContent(t, s.adminCtx, s.svc, s.ctrl, spaceID)
+
+		_, q := test.ShowSpaceQuotaAdminOK(t, s.adminCtx, s.svc, s.ctrl, spaceID)
+		assert.True(t, *q.Data.Attributes.Default)
+		test.CreateEnvironmentCreated(t, s.svc.Context, s.svc, s.envCtrl, spaceID, nil, newCreateEnvironmentPayload("osio-run", "run", "cluster1.com"))
+	})
+
+	s.T().Run("not_admin", func(t *testing.T) {
+		_, err := test.SetSpaceQuotaAdminForbidden(t, contextWithServiceAccount("fabric8-tenant"), s.svc, s.ctrl, spaceID, newSpaceQuotaPayload(100))
+		assert.NotNil(t, err)
+	})
+}
+
+func newSpaceQuotaPayload(maxEnvironments int) *app.SetSpaceQuotaAdminPayload {
+	return &app.SetSpaceQuotaAdminPayload{
+		Data: &app.SpaceQuota{
+			Type: "space-quotas",
+			Attributes: &app.SpaceQuotaAttributes{
+				MaxEnvironments: maxEnvironments,
+			},
+		},
+	}
+}
+
+func newMoveClusterPayload(oldClusterURL, newClusterURL string, dryRun bool) *app.MoveClusterAdminPayload {
+	return &app.MoveClusterAdminPayload{
+		Data: &app.ClusterMove{
+			Type: "cluster-moves",
+			Attributes: &app.ClusterMoveAttributes{
+				OldClusterURL: oldClusterURL,
+				NewClusterURL: newClusterURL,
+				DryRun:        ptr.Bool(dryRun),
+			},
+		},
+	}
+}
+
+func contextWithServiceAccount(name string) context.Context {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub":                 uuid.NewV4().String(),
+		"service_accountname": name,
+	})
+	return goajwt.WithJWT(context.Background(), token)
+}
+
+func newEnvironment(name, envType, clusterURL string, spaceID uuid.UUID) *environment.Environment {
+	return &environment.Environment{
+		Name:       &name,
+		Type:       &envType,
+		SpaceID:    &spaceID,
+		ClusterURL: &clusterURL,
+	}
+}
@@ -3,40 +3,57 @@ package controller
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"time"
 
 	clusterclient "github.com/fabric8-services/fabric8-cluster-client/service"
 	"github.com/fabric8-services/fabric8-common/auth"
+	"github.com/fabric8-services/fabric8-common/convert/ptr"
 	"github.com/fabric8-services/fabric8-common/errors"
 	"github.com/fabric8-services/fabric8-common/httpsupport"
 	"github.com/fabric8-services/fabric8-common/log"
 	"github.com/fabric8-services/fabric8-env/app"
 	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/audit"
 	"github.com/fabric8-services/fabric8-env/environment"
 	"github.com/goadesign/goa"
 	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
 )
 
 const (
 	APIStringTypeEnvironment = "environments"
 )
 
+type environmentConfig interface {
+	quotaConfig
+	idempotencyConfig
+	spaceConfig
+}
+
 type EnvironmentController struct {
 	*goa.Controller
 	db             application.DB
 	authService    auth.AuthService
 	clusterService clusterclient.Service
+	clusters       clusterLister
+	config         environmentConfig
 }
 
-func NewEnvironmentController(service *goa.Service, db application.DB, authService auth.AuthService, clusterService clusterclient.Service) *EnvironmentController {
+func NewEnvironmentController(service *goa.Service, db application.DB, authService auth.AuthService, clusterService clusterclient.Service,
+	clusters clusterLister, config environmentConfig) *EnvironmentController {
 	return &EnvironmentController{
 		Controller:     service.NewController("EnvironmentController"),
 		db:             db,
 		authService:    authService,
 		clusterService: clusterService,
+		clusters:       clusters,
+		config:         config,
 	}
 }
 
 func ConvertEnvironment(env *environment.Environment) *app.Environment {
+	createdAt := env.CreatedAt
 	respEnv := &app.Environment{
 		ID:   env.ID,
 		Type: APIStringTypeEnvironment,
@@ -45,8 +62,20 @@ func ConvertEnvironment(env *environment.Environment) *app.Environment {
 			Type:          *env.Type,
 			NamespaceName: env.NamespaceName,
 			ClusterURL:    *env.ClusterURL,
+			ExpiresAt:     env.ExpiresAt,
+			Protected:     ptr.Bool(env.Protected),
+			SpaceID:       env.SpaceID,
+			CreatedAt:     &createdAt,
 		},
 	}
+	if env.IsLocked(time.Now()) {
+		respEnv.Attributes.Lock = &app.EnvironmentLock{
+			Reason:    *env.LockReason,
+			LockedBy:  env.LockedBy,
+			LockedAt:  env.LockedAt,
+			ExpiresAt: env.LockExpiresAt,
+		}
+	}
 	return respEnv
 }
 
@@ -59,51 +88,236 @@ func ConvertEnvironments(envs []*environment.Environment) *app.EnvironmentsList
 }
 
 func (c *EnvironmentController) Create(ctx *app.CreateEnvironmentContext) error {
+	spaceID := ctx.SpaceID
+	req, err := newIdempotentRequest(spaceID, ctx.IdempotencyKey, "", ctx.Payload, c.config.GetIdempotencyWindow())
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+	respond := func(body []byte) error {
+		res := &app.EnvironmentSingle{}
+		if err := decodeStoredResponse(ctx, body, res); err != nil {
+			return err
+		}
+		ctx.ResponseData.Header().Set("Location", httpsupport.AbsoluteURL(&goa.RequestData{Request: ctx.Request},
+			app.EnvironmentHref(res.Data.ID), nil))
+		return ctx.Created(res)
+	}
+	if replayed, err := c.replay(ctx, req, respond); replayed {
+		return err
+	}
+
 	reqEnv := ctx.Payload.Data
 	if reqEnv == nil {
 		return app.JSONErrorResponse(ctx, errors.NewBadParameterError("data", nil).Expected("not nil"))
 	}
+	if verrs := validateEnvironmentAttributes(reqEnv.Attributes, "/data/attributes"); len(verrs) > 0 {
+		return ctx.BadRequest(verrs.JSONAPIErrors())
+	}
+
+	convert := func(envs []*environment.Environment) interface{} {
+		return &app.EnvironmentSingle{Data: ConvertEnvironment(envs[0])}
+	}
+	envs, err := c.createEnvironments(ctx, spaceID, []*app.EnvironmentAttributes{reqEnv.Attributes},
+		req.store(ctx, http.StatusCreated, convert))
+	if err != nil {
+		return c.createErrorResponse(ctx, err, func() (bool, error) {
+			return c.replay(ctx, req, respond)
+		})
+	}
 
+	res := convert(envs).(*app.EnvironmentSingle)
+	ctx.ResponseData.Header().Set("Location", httpsupport.AbsoluteURL(&goa.RequestData{Request: ctx.Request},
+		app.EnvironmentHref(res.Data.ID), nil))
+	return ctx.Created(res)
+}
+
+// CreateFromTemplate runs the createFromTemplate action.
+func (c *EnvironmentController) CreateFromTemplate(ctx *app.CreateFromTemplateEnvironmentContext) error {
 	spaceID := ctx.SpaceID
-	err := c.authService.RequireScope(ctx, spaceID.String(), "manage")
+	req, err := newIdempotentRequest(spaceID, ctx.IdempotencyKey, ctx.Template, nil, c.config.GetIdempotencyWindow())
 	if err != nil {
 		return app.JSONErrorResponse(ctx, err)
 	}
+	respond := func(body []byte) error {
+		res := &app.EnvironmentsList{}
+		if err := decodeStoredResponse(ctx, body, res); err != nil {
+			return err
+		}
+		return ctx.Created(res)
+	}
+	if replayed, err := c.replay(ctx, req, respond); replayed {
+		return err
+	}
 
-	err = c.checkClustersUser(ctx, reqEnv.Attributes.ClusterURL)
+	tmpl, err := c.db.Templates().LoadByName(ctx, ctx.Template)
 	if err != nil {
 		return app.JSONErrorResponse(ctx, err)
 	}
 
-	var env *environment.Environment
-	err = application.Transactional(c.db, func(appl application.Application) error {
+	items := tmpl.Expand(spaceID, usernameFromContext(ctx))
+	attrs := make([]*app.EnvironmentAttributes, len(items))
+	var verrs ValidationErrors
+	for ind, item := range items {
+		attrs[ind] = templateItemAttributes(item)
+		verrs = append(verrs, validateTemplateItem(attrs[ind], ind, "template")...)
+	}
+	if len(verrs) > 0 {
+		return ctx.BadRequest(verrs.JSONAPIErrors())
+	}
+
+	convert := func(envs []*environment.Environment) interface{} {
+		return ConvertEnvironments(envs)
+	}
+	envs, err := c.createEnvironments(ctx, spaceID, attrs, req.store(ctx, http.StatusCreated, convert))
+	if err != nil {
+		return c.createErrorResponse(ctx, err, func() (bool, error) {
+			return c.replay(ctx, req, respond)
+		})
+	}
+	return ctx.Created(ConvertEnvironments(envs))
+}
+
+// createResponseContext is implemented by the contexts of the actions creating
+// environments.
+type createResponseContext interface {
+	context.Context
+	BadRequest(r *app.JSONAPIErrors) error
+	Forbidden(r *app.JSONAPIErrors) error
+	InternalServerError(r *app.JSONAPIErrors) error
+}
+
+// createErrorResponse sends the response for a failed create or clone. A create
+// which lost the race against a concurrent retry with the same idempotency key gets
+// the response of the other one from the optional replay func.
+func (c *EnvironmentController) createErrorResponse(ctx createResponseContext, err error, replay func() (bool, error)) error {
+	if verrs, ok := errs.Cause(err).(ValidationErrors); ok {
+		return ctx.BadRequest(verrs.JSONAPIErrors())
+	}
+	if qerr, ok := errs.Cause(err).(QuotaExceededError); ok {
+		return ctx.Forbidden(qerr.JSONAPIErrors())
+	}
+	if _, ok := errs.Cause(err).(errors.DataConflictError); ok && replay != nil {
+		if replayed, err := replay(); replayed {
+			return err
+		}
+	}
+	return app.JSONErrorResponse(ctx, err)
+}
+
+// createEnvironments checks the scope and the clusters of the user and creates all
+// the given, already validated, environments in a single transaction. The optional afterCreate hook
+// runs in the same transaction.
+func (c *EnvironmentController) createEnvironments(ctx context.Context, spaceID uuid.UUID, attrs []*app.EnvironmentAttributes,
+	afterCreate func(appl application.Application, envs []*environment.Environment) error) ([]*environment.Environment, error) {
+	err := c.checkCreateAccess(ctx, spaceID, attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	var envs []*environment.Environment
+	err = application.Transactional(ctx, c.db, func(appl application.Application) error {
+		var err error
+		envs, err = c.insertEnvironments(ctx, appl, spaceID, attrs)
+		if err != nil {
+			return err
+		}
+		if afterCreate != nil {
+			return afterCreate(appl, envs)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return envs, nil
+}
+
+// checkCreateAccess checks that the user may manage the space and use the
+// clusters of the environments.
+func (c *EnvironmentController) checkCreateAccess(ctx context.Context, spaceID uuid.UUID, attrs []*app.EnvironmentAttributes) error {
+	err := c.authService.RequireScope(ctx, spaceID.String(), "manage")
+	if err != nil {
+		return err
+	}
+	for _, attr := range attrs {
+		err = c.checkClustersUser(ctx, attr.ClusterURL)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertEnvironments checks the quota of the space and stores the environments.
+// It must be called inside a transaction.
+func (c *EnvironmentController) insertEnvironments(ctx context.Context, appl application.Application, spaceID uuid.UUID, attrs []*app.EnvironmentAttributes) ([]*environment.Environment, error) {
+	err := checkQuota(ctx, appl, c.config, spaceID, len(attrs))
+	if err != nil {
+		return nil, err
+	}
+	envs := make([]*environment.Environment, 0, len(attrs))
+	for _, attr := range attrs {
 		newEnv := environment.Environment{
-			Name:          &reqEnv.Attributes.Name,
-			Type:          &reqEnv.Attributes.Type,
+			Name:          ptr.String(attr.Name),
+			Type:          ptr.String(attr.Type),
 			SpaceID:       &spaceID,
-			NamespaceName: reqEnv.Attributes.NamespaceName,
-			ClusterURL:    &reqEnv.Attributes.ClusterURL,
+			NamespaceName: attr.NamespaceName,
+			ClusterURL:    ptr.String(attr.ClusterURL),
+			ExpiresAt:     expiryTime(attr.ExpiresAt, attr.TTL, time.Now()),
+			Protected:     attr.Type == "run",
+		}
+		if attr.Protected != nil {
+			newEnv.Protected = *attr.Protected
+		}
+		if newEnv.NamespaceName == nil {
+			namespaceName, err := generateNamespaceName(ctx, appl, spaceID, attr.Type, attr.ClusterURL)
+			if err != nil {
+				return nil, err
+			}
+			newEnv.NamespaceName = &namespaceName
 		}
 
-		env, err = appl.Environments().Create(ctx, &newEnv)
+		env, err := appl.Environments().Create(ctx, &newEnv)
 		if err != nil {
 			log.Error(ctx, map[string]interface{}{"err": err},
 				"failed to create environment: %s", *newEnv.Name)
-			return errs.Wrapf(err, "failed to create environment: %s", *newEnv.Name)
+			return nil, errs.Wrapf(err, "failed to create environment: %s", *newEnv.Name)
 		}
-		return nil
-	})
-	if err != nil {
-		return app.JSONErrorResponse(ctx, err)
+		envs = append(envs, env)
 	}
+	return envs, nil
+}
 
-	envData := ConvertEnvironment(env)
-	res := &app.EnvironmentSingle{
-		Data: envData,
+// namespaceNameCandidates is the number of generated namespace names checked at once.
+const namespaceNameCandidates = 10
+
+// generateNamespaceName derives the namespace name from the user name (or the space ID
+// when the user is unknown) and the environment type, skipping names already used on
+// the cluster.
+func generateNamespaceName(ctx context.Context, appl application.Application, spaceID uuid.UUID, envType, clusterURL string) (string, error) {
+	base := usernameFromContext(ctx)
+	if base == "" {
+		base = spaceID.String()
+	}
+	for offset := 0; ; offset += namespaceNameCandidates {
+		candidates := make([]string, namespaceNameCandidates)
+		for i := range candidates {
+			candidates[i] = environment.NamespaceNameCandidate(base, envType, offset+i)
+		}
+		names, err := appl.Environments().UsedNamespaceNames(ctx, clusterURL, candidates)
+		if err != nil {
+			return "", err
+		}
+		used := make(map[string]bool, len(names))
+		for _, name := range names {
+			used[name] = true
+		}
+		for _, candidate := range candidates {
+			if !used[candidate] {
+				return candidate, nil
+			}
+		}
 	}
-	ctx.ResponseData.Header().Set("Location", httpsupport.AbsoluteURL(&goa.RequestData{Request: ctx.Request},
-		app.EnvironmentHref(res.Data.ID), nil))
-	return ctx.Created(res)
 }
 
 func (c *EnvironmentController) List(ctx *app.ListEnvironmentContext) error {
@@ -143,6 +357,241 @@ func (c *EnvironmentController) Show(ctx *app.ShowEnvironmentContext) error {
 	return ctx.OK(res)
 }
 
+// loadAuthorized loads the environment without locking it and checks that the
+// user has the scope in its space. The check calls the auth service, so it is
+// made before the environment is locked and not repeated when the transaction is
+// retried.
+func (c *EnvironmentController) loadAuthorized(ctx context.Context, envID uuid.UUID, scope string) (*environment.Environment, error) {
+	env, err := c.db.Environments().Load(ctx, envID)
+	if err != nil {
+		return nil, err
+	}
+	err = c.authService.RequireScope(ctx, env.SpaceID.String(), scope)
+	if err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// loadForUpdate loads and locks the environment returned by loadAuthorized. It
+// fails if the environment moved to another space since it was authorized.
+func loadForUpdate(ctx context.Context, appl application.Application, authorized *environment.Environment) (*environment.Environment, error) {
+	env, err := appl.Environments().LoadForUpdate(ctx, *authorized.ID)
+	if err != nil {
+		return nil, err
+	}
+	if *env.SpaceID != *authorized.SpaceID {
+		return nil, errors.NewDataConflictError(fmt.Sprintf("environment %s moved to another space", *env.ID))
+	}
+	return env, nil
+}
+
+func (c *EnvironmentController) Update(ctx *app.UpdateEnvironmentContext) error {
+	reqEnv := ctx.Payload.Data
+	if reqEnv == nil || reqEnv.Attributes == nil {
+		return app.JSONErrorResponse(ctx, errors.NewBadParameterError("data", nil).Expected("not nil"))
+	}
+	attrs := reqEnv.Attributes
+	if verrs := validateEnvironmentUpdateAttributes(attrs, "/data/attributes"); len(verrs) > 0 {
+		return ctx.BadRequest(verrs.JSONAPIErrors())
+	}
+
+	authorized, err := c.loadAuthorized(ctx, ctx.EnvID, "manage")
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	// the environment is loaded again and locked in the transaction, so that
+	// concurrent updates don't overwrite each other
+	var updated *environment.Environment
+	err = application.Transactional(ctx, c.db, func(appl application.Application) error {
+		env, err := loadForUpdate(ctx, appl, authorized)
+		if err != nil {
+			return err
+		}
+
+		unprotect := attrs.Protected != nil && !*attrs.Protected
+		overrideEntry, err := checkMutable(ctx, env, audit.ActionUpdate, unprotect, ctx.Override)
+		if err != nil {
+			return err
+		}
+
+		details := audit.Details{}
+		if attrs.Name != nil {
+			details["old-name"] = *env.Name
+			details["name"] = *attrs.Name
+			env.Name = attrs.Name
+		}
+		if attrs.TTL != nil && *attrs.TTL == 0 {
+			if env.ExpiresAt != nil {
+				details["old-expires-at"] = env.ExpiresAt.UTC().Format(time.RFC3339)
+			}
+			details["expires-at"] = nil
+			env.ExpiresAt = nil
+		} else if expiresAt := expiryTime(attrs.ExpiresAt, attrs.TTL, time.Now()); expiresAt != nil {
+			if env.ExpiresAt != nil {
+				details["old-expires-at"] = env.ExpiresAt.UTC().Format(time.RFC3339)
+			}
+			details["expires-at"] = expiresAt.UTC().Format(time.RFC3339)
+			env.ExpiresAt = expiresAt
+		}
+		if attrs.Protected != nil {
+			details["protected"] = *attrs.Protected
+			env.Protected = *attrs.Protected
+		}
+
+		updated, err = appl.Environments().Save(ctx, env)
+		if err != nil {
+			return errs.Wrapf(err, "failed to update environment: %s", ctx.EnvID)
+		}
+		return createAuditEntries(ctx, appl, overrideEntry, &audit.Entry{
+			EnvironmentID: *updated.ID,
+			SpaceID:       *updated.SpaceID,
+			Action:        audit.ActionUpdate,
+			Actor:         actorFromContext(ctx),
+			Details:       details,
+		})
+	})
+	if err != nil {
+		if lockedErr, ok := errs.Cause(err).(LockedError); ok {
+			return ctx.Locked(lockedErr.JSONAPIErrors())
+		}
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	return ctx.OK(&app.EnvironmentSingle{Data: ConvertEnvironment(updated)})
+}
+
+func (c *EnvironmentController) Delete(ctx *app.DeleteEnvironmentContext) error {
+	authorized, err := c.loadAuthorized(ctx, ctx.EnvID, "manage")
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	// the environment is loaded again and locked in the transaction, so that it
+	// cannot be locked or protected while it is deleted
+	err = application.Transactional(ctx, c.db, func(appl application.Application) error {
+		env, err := loadForUpdate(ctx, appl, authorized)
+		if err != nil {
+			return err
+		}
+
+		overrideEntry, err := checkMutable(ctx, env, audit.ActionDelete, true, ctx.Override)
+		if err != nil {
+			return err
+		}
+
+		err = appl.Environments().Delete(ctx, *env.ID)
+		if err != nil {
+			return errs.Wrapf(err, "failed to delete environment: %s", ctx.EnvID)
+		}
+		return createAuditEntries(ctx, appl, overrideEntry, &audit.Entry{
+			EnvironmentID: *env.ID,
+			SpaceID:       *env.SpaceID,
+			Action:        audit.ActionDelete,
+			Actor:         actorFromContext(ctx),
+			Details:       audit.Details{"name": *env.Name},
+		})
+	})
+	if err != nil {
+		if lockedErr, ok := errs.Cause(err).(LockedError); ok {
+			return ctx.Locked(lockedErr.JSONAPIErrors())
+		}
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	return ctx.NoContent()
+}
+
+// createAuditEntries stores all the given entries, nil entries are skipped.
+func createAuditEntries(ctx context.Context, appl application.Application, entries ...*audit.Entry) error {
+	for _, entry := range entries {
+		if entry == nil {
+			continue
+		}
+		if _, err := appl.AuditLogs().Create(ctx, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *EnvironmentController) Clone(ctx *app.CloneEnvironmentContext) error {
+	authorized, err := c.loadAuthorized(ctx, ctx.EnvID, "contribute")
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+	spaceID, checked := cloneAttributes(authorized, ctx.Payload)
+	if verrs := validateEnvironmentAttributes(checked, "/data/attributes"); len(verrs) > 0 {
+		return ctx.BadRequest(verrs.JSONAPIErrors())
+	}
+	err = c.checkCreateAccess(ctx, spaceID, []*app.EnvironmentAttributes{checked})
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	// the source is loaded again and locked in the transaction creating the clone,
+	// so that it cannot be changed or deleted meanwhile
+	var clone *environment.Environment
+	err = application.Transactional(ctx, c.db, func(appl application.Application) error {
+		src, err := loadForUpdate(ctx, appl, authorized)
+		if err != nil {
+			return err
+		}
+		// the access to the cluster was checked before the source was locked
+		_, attrs := cloneAttributes(src, ctx.Payload)
+		if attrs.ClusterURL != checked.ClusterURL {
+			return errors.NewDataConflictError(fmt.Sprintf("environment %s moved to another cluster", *src.ID))
+		}
+
+		envs, err := c.insertEnvironments(ctx, appl, spaceID, []*app.EnvironmentAttributes{attrs})
+		if err != nil {
+			return err
+		}
+		clone = envs[0]
+		return nil
+	})
+	if err != nil {
+		return c.createErrorResponse(ctx, err, nil)
+	}
+
+	res := &app.EnvironmentSingle{
+		Data: ConvertEnvironment(clone),
+	}
+	ctx.ResponseData.Header().Set("Location", httpsupport.AbsoluteURL(&goa.RequestData{Request: ctx.Request},
+		app.EnvironmentHref(res.Data.ID), nil))
+	return ctx.Created(res)
+}
+
+// cloneAttributes returns the space and the attributes of a clone of src. The
+// clone gets all the attributes of the source but its identity and lock. The
+// namespace of the source is never shared with the clone, its name is generated
+// for the target space and cluster unless one is given.
+func cloneAttributes(src *environment.Environment, payload *app.CloneEnvironmentPayload) (uuid.UUID, *app.EnvironmentAttributes) {
+	spaceID := *src.SpaceID
+	attrs := &app.EnvironmentAttributes{
+		Name:       *src.Name,
+		Type:       *src.Type,
+		ClusterURL: *src.ClusterURL,
+		ExpiresAt:  src.ExpiresAt,
+		Protected:  &src.Protected,
+	}
+	if payload != nil && payload.Data != nil && payload.Data.Attributes != nil {
+		overrides := payload.Data.Attributes
+		if overrides.SpaceID != nil {
+			spaceID = *overrides.SpaceID
+		}
+		if overrides.ClusterURL != nil {
+			attrs.ClusterURL = *overrides.ClusterURL
+		}
+		if overrides.Name != nil {
+			attrs.Name = *overrides.Name
+		}
+		attrs.NamespaceName = overrides.NamespaceName
+	}
+	return spaceID, attrs
+}
+
 func (c *EnvironmentController) checkClustersUser(ctx context.Context, clusterURL string) error {
 	clusters, err := c.clusterService.UserClusters(ctx)
 	if err != nil {
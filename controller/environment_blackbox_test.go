@@ -2,7 +2,9 @@ package controller_test
 
 import (
 	"context"
+	"strings"
 	"testing"
+	"time"
 
 	uuid "github.com/satori/go.uuid"
 	"github.com/stretchr/testify/assert"
@@ -14,16 +16,18 @@ import (
 	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
 	"github.com/fabric8-services/fabric8-env/app"
 	"github.com/fabric8-services/fabric8-env/app/test"
+	"github.com/fabric8-services/fabric8-env/application"
 	"github.com/fabric8-services/fabric8-env/configuration"
 	"github.com/fabric8-services/fabric8-env/controller"
 	"github.com/fabric8-services/fabric8-env/gormapp"
+	"github.com/fabric8-services/fabric8-env/quota"
 	"github.com/goadesign/goa"
 	"github.com/stretchr/testify/suite"
 )
 
 type EnvironmentControllerSuite struct {
 	testsuite.DBTestSuite
-	db *gormapp.GormDB
+	db application.DB
 
 	svc  *goa.Service
 	ctx  context.Context
@@ -49,6 +53,11 @@ func (s *testClusterService) UserClusters(ctx context.Context) (*clusterclient.C
 	}, nil
 }
 
+// Clusters returns the clusters known to the Cluster service.
+func (s *testClusterService) Clusters(ctx context.Context) (*clusterclient.ClusterList, error) {
+	return s.UserClusters(ctx)
+}
+
 func TestEnvironmentController(t *testing.T) {
 	config, err := configuration.New("")
 	require.NoError(t, err)
@@ -57,13 +66,18 @@ func TestEnvironmentController(t *testing.T) {
 
 func (s *EnvironmentControllerSuite) SetupSuite() {
 	s.DBTestSuite.SetupSuite()
+	s.setup(gormapp.NewGormDB(s.DB))
+}
 
-	s.db = gormapp.NewGormDB(s.DB)
+func (s *EnvironmentControllerSuite) setup(db application.DB) {
+	s.db = db
 
 	svc := testauth.UnsecuredService("enviroment-test")
 	s.svc = svc
 	s.ctx = s.svc.Context
-	s.ctrl = controller.NewEnvironmentController(s.svc, s.db, &testAuthService{}, &testClusterService{})
+	config, err := configuration.New("")
+	require.NoError(s.T(), err)
+	s.ctrl = controller.NewEnvironmentController(s.svc, s.db, &testAuthService{}, &testClusterService{}, &testClusterService{}, config)
 }
 
 func (s *EnvironmentControllerSuite) TestCreate() {
@@ -71,7 +85,7 @@ func (s *EnvironmentControllerSuite) TestCreate() {
 		spaceID := uuid.NewV4()
 		payload := newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com")
 
-		_, newEnv := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, spaceID, payload)
+		_, newEnv := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, spaceID, nil, payload)
 
 		assert.NotNil(t, newEnv)
 		assert.NotNil(t, newEnv.Data.ID)
@@ -81,11 +95,79 @@ func (s *EnvironmentControllerSuite) TestCreate() {
 		assert.Equal(t, env.Data.ID, newEnv.Data.ID)
 	})
 
+	s.T().Run("namespace_generated", func(t *testing.T) {
+		spaceID := uuid.NewV4()
+		payload := newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com")
+
+		_, env1 := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, spaceID, nil, payload)
+		require.NotNil(t, env1.Data.Attributes.NamespaceName)
+		assert.Equal(t, spaceID.String()+"-stage", *env1.Data.Attributes.NamespaceName)
+
+		_, env2 := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, spaceID, nil, payload)
+		require.NotNil(t, env2.Data.Attributes.NamespaceName)
+		assert.Equal(t, spaceID.String()+"-stage-1", *env2.Data.Attributes.NamespaceName)
+	})
+
+	s.T().Run("namespace_conflict", func(t *testing.T) {
+		payload := newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com")
+		payload.Data.Attributes.NamespaceName = ptr.String("conflict-" + uuid.NewV4().String())
+		test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil, payload)
+
+		_, err := test.CreateEnvironmentConflict(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil, payload)
+		assert.NotNil(t, err)
+	})
+
+	s.T().Run("namespace_invalid", func(t *testing.T) {
+		spaceID := uuid.NewV4()
+		payload := newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com")
+		payload.Data.Attributes.NamespaceName = ptr.String("Osio_Stage")
+
+		_, err := test.CreateEnvironmentBadRequest(t, s.ctx, s.svc, s.ctrl, spaceID, nil, payload)
+		assert.NotNil(t, err)
+	})
+
+	s.T().Run("invalid_attributes", func(t *testing.T) {
+		tables := []struct {
+			name     string
+			pointers []string
+		}{
+			{"", []string{"/data/attributes/name", "/data/attributes/namespaceName"}},
+			{"   ", []string{"/data/attributes/name", "/data/attributes/namespaceName"}},
+			{" osio-stage", []string{"/data/attributes/name", "/data/attributes/namespaceName"}},
+			{strings.Repeat("a", 10*1024), []string{"/data/attributes/name", "/data/attributes/namespaceName"}},
+		}
+		for _, table := range tables {
+			payload := newCreateEnvironmentPayload(table.name, "stage", "  ")
+			payload.Data.Attributes.NamespaceName = ptr.String("Osio_Stage")
+
+			_, jerrs := test.CreateEnvironmentBadRequest(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil, payload)
+			require.NotNil(t, jerrs)
+			var pointers []string
+			for _, jerr := range jerrs.Errors {
+				assert.Equal(t, "400", *jerr.Status)
+				assert.NotEmpty(t, jerr.Detail)
+				pointers = append(pointers, jerr.Source["pointer"].(string))
+			}
+			assert.Contains(t, pointers, "/data/attributes/cluster-url")
+			for _, pointer := range table.pointers {
+				assert.Contains(t, pointers, pointer)
+			}
+		}
+	})
+
+	s.T().Run("multibyte_name", func(t *testing.T) {
+		// 63 characters but more bytes
+		payload := newCreateEnvironmentPayload(strings.Repeat("é", controller.EnvironmentNameMaxLength), "stage", "cluster1.com")
+
+		_, env := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil, payload)
+		require.NotNil(t, env)
+	})
+
 	s.T().Run("cluster_not_linked", func(t *testing.T) {
 		spaceID := uuid.NewV4()
 		payload := newCreateEnvironmentPayload("osio-stage", "stage", "cluster2.com")
 
-		_, err := test.CreateEnvironmentForbidden(t, s.ctx, s.svc, s.ctrl, spaceID, payload)
+		_, err := test.CreateEnvironmentForbidden(t, s.ctx, s.svc, s.ctrl, spaceID, nil, payload)
 		assert.NotNil(t, err)
 	})
 }
@@ -94,7 +176,7 @@ func (s *EnvironmentControllerSuite) TestList() {
 	s.T().Run("ok", func(t *testing.T) {
 		spaceID := uuid.NewV4()
 		payload := newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com")
-		_, newEnv := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, spaceID, payload)
+		_, newEnv := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, spaceID, nil, payload)
 		require.NotNil(t, newEnv)
 
 		_, list := test.ListEnvironmentOK(t, s.ctx, s.svc, s.ctrl, spaceID)
@@ -108,7 +190,7 @@ func (s *EnvironmentControllerSuite) TestShow() {
 	s.T().Run("ok", func(t *testing.T) {
 		spaceID := uuid.NewV4()
 		payload := newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com")
-		_, newEnv := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, spaceID, payload)
+		_, newEnv := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, spaceID, nil, payload)
 		require.NotNil(t, newEnv)
 
 		_, env := test.ShowEnvironmentOK(t, s.ctx, s.svc, s.ctrl, *newEnv.Data.ID)
@@ -123,6 +205,229 @@ func (s *EnvironmentControllerSuite) TestShow() {
 	})
 }
 
+func (s *EnvironmentControllerSuite) TestExpiry() {
+	s.T().Run("create_with_ttl", func(t *testing.T) {
+		payload := newCreateEnvironmentPayload("pr-42", "dev", "cluster1.com")
+		ttl := 3600
+		payload.Data.Attributes.TTL = &ttl
+
+		before := time.Now()
+		_, env := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil, payload)
+		require.NotNil(t, env.Data.Attributes.ExpiresAt)
+		assert.WithinDuration(t, before.Add(time.Hour), *env.Data.Attributes.ExpiresAt, time.Minute)
+	})
+
+	s.T().Run("create_invalid_expiry", func(t *testing.T) {
+		payload := newCreateEnvironmentPayload("pr-42", "dev", "cluster1.com")
+		ttl := -1
+		past := time.Now().Add(-time.Hour)
+		payload.Data.Attributes.TTL = &ttl
+		payload.Data.Attributes.ExpiresAt = &past
+
+		_, jerrs := test.CreateEnvironmentBadRequest(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil, payload)
+		require.NotNil(t, jerrs)
+		assert.Len(t, jerrs.Errors, 3)
+	})
+
+	s.T().Run("extend_ttl", func(t *testing.T) {
+		payload := newCreateEnvironmentPayload("pr-43", "dev", "cluster1.com")
+		ttl := 60
+		payload.Data.Attributes.TTL = &ttl
+		_, env := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil, payload)
+
+		newTTL := 7 * 24 * 3600
+		update := newUpdateEnvironmentPayload(&app.EnvironmentUpdateAttributes{TTL: &newTTL})
+		_, updated := test.UpdateEnvironmentOK(t, s.ctx, s.svc, s.ctrl, *env.Data.ID, nil, update)
+		require.NotNil(t, updated.Data.Attributes.ExpiresAt)
+		assert.True(t, updated.Data.Attributes.ExpiresAt.After(time.Now().Add(6*24*time.Hour)))
+
+		entries, err := s.db.AuditLogs().List(s.ctx, *env.Data.ID)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "update", entries[0].Action)
+	})
+
+	s.T().Run("clear_ttl", func(t *testing.T) {
+		payload := newCreateEnvironmentPayload("pr-44", "dev", "cluster1.com")
+		ttl := 60
+		payload.Data.Attributes.TTL = &ttl
+		_, env := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil, payload)
+		require.NotNil(t, env.Data.Attributes.ExpiresAt)
+
+		noTTL := 0
+		update := newUpdateEnvironmentPayload(&app.EnvironmentUpdateAttributes{TTL: &noTTL})
+		_, updated := test.UpdateEnvironmentOK(t, s.ctx, s.svc, s.ctrl, *env.Data.ID, nil, update)
+		assert.Nil(t, updated.Data.Attributes.ExpiresAt)
+
+		_, shown := test.ShowEnvironmentOK(t, s.ctx, s.svc, s.ctrl, *env.Data.ID)
+		assert.Nil(t, shown.Data.Attributes.ExpiresAt)
+	})
+
+	s.T().Run("update_not_found", func(t *testing.T) {
+		update := newUpdateEnvironmentPayload(&app.EnvironmentUpdateAttributes{Name: ptr.String("osio-stage")})
+		_, err := test.UpdateEnvironmentNotFound(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil, update)
+		assert.NotNil(t, err)
+	})
+}
+
+func (s *EnvironmentControllerSuite) TestQuota() {
+	spaceID := uuid.NewV4()
+	_, err := s.db.SpaceQuotas().Save(s.ctx, &quota.SpaceQuota{SpaceID: spaceID, MaxEnvironments: 2})
+	require.NoError(s.T(), err)
+
+	test.CreateEnvironmentCreated(s.T(), s.ctx, s.svc, s.ctrl, spaceID, nil, newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com"))
+	test.CreateEnvironmentCreated(s.T(), s.ctx, s.svc, s.ctrl, spaceID, nil, newCreateEnvironmentPayload("osio-run", "run", "cluster1.com"))
+
+	s.T().Run("exceeded", func(t *testing.T) {
+		_, jerrs := test.CreateEnvironmentForbidden(t, s.ctx, s.svc, s.ctrl, spaceID, nil, newCreateEnvironmentPayload("pr-1", "dev", "cluster1.com"))
+		require.NotNil(t, jerrs)
+		require.Len(t, jerrs.Errors, 1)
+		assert.Equal(t, "quota_exceeded", *jerrs.Errors[0].Code)
+		assert.EqualValues(t, 2, jerrs.Errors[0].Meta["limit"])
+		assert.Contains(t, jerrs.Errors[0].Detail, "limit of 2 environments")
+
+		_, envs := test.ListEnvironmentOK(t, s.ctx, s.svc, s.ctrl, spaceID)
+		assert.Len(t, envs.Data, 2)
+	})
+
+	s.T().Run("deleted_environments_not_counted", func(t *testing.T) {
+		_, envs := test.ListEnvironmentOK(t, s.ctx, s.svc, s.ctrl, spaceID)
+		err := s.db.Environments().Delete(s.ctx, *envs.Data[0].ID)
+		require.NoError(t, err)
+
+		test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, spaceID, nil, newCreateEnvironmentPayload("pr-1", "dev", "cluster1.com"))
+	})
+}
+
+func (s *EnvironmentControllerSuite) TestIdempotencyKey() {
+	spaceID := uuid.NewV4()
+	key := uuid.NewV4().String()
+	payload := newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com")
+
+	_, env := test.CreateEnvironmentCreated(s.T(), s.ctx, s.svc, s.ctrl, spaceID, &key, payload)
+	require.NotNil(s.T(), env)
+
+	s.T().Run("retry_replayed", func(t *testing.T) {
+		resp, retried := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, spaceID, &key, newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com"))
+		require.NotNil(t, retried)
+		assert.Equal(t, *env.Data.ID, *retried.Data.ID)
+		assert.Equal(t, env.Data.Attributes.NamespaceName, retried.Data.Attributes.NamespaceName)
+		assert.NotEmpty(t, resp.Header().Get("Location"))
+
+		_, envs := test.ListEnvironmentOK(t, s.ctx, s.svc, s.ctrl, spaceID)
+		assert.Len(t, envs.Data, 1)
+	})
+
+	s.T().Run("different_body", func(t *testing.T) {
+		_, jerrs := test.CreateEnvironmentUnprocessableEntity(t, s.ctx, s.svc, s.ctrl, spaceID, &key, newCreateEnvironmentPayload("osio-run", "run", "cluster1.com"))
+		require.NotNil(t, jerrs)
+		assert.Equal(t, "idempotency_key_mismatch", *jerrs.Errors[0].Code)
+	})
+
+	s.T().Run("other_space", func(t *testing.T) {
+		_, other := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), &key, payload)
+		assert.NotEqual(t, *env.Data.ID, *other.Data.ID)
+	})
+
+	s.T().Run("failed_request_not_stored", func(t *testing.T) {
+		otherKey := uuid.NewV4().String()
+		invalid := newCreateEnvironmentPayload("", "stage", "cluster1.com")
+		test.CreateEnvironmentBadRequest(t, s.ctx, s.svc, s.ctrl, spaceID, nil, &otherKey, invalid)
+
+		_, created := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, spaceID, nil, &otherKey, newCreateEnvironmentPayload("osio-run", "run", "cluster1.com"))
+		assert.NotNil(t, created)
+	})
+}
+
+func (s *EnvironmentControllerSuite) TestClone() {
+	spaceID := uuid.NewV4()
+	payload := newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com")
+	payload.Data.Attributes.NamespaceName = ptr.String(spaceID.String() + "-stage")
+	_, srcEnv := test.CreateEnvironmentCreated(s.T(), s.ctx, s.svc, s.ctrl, spaceID, nil, payload)
+	require.NotNil(s.T(), srcEnv)
+
+	s.T().Run("ok_same_space", func(t *testing.T) {
+		_, env := test.CloneEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, *srcEnv.Data.ID, nil)
+		require.NotNil(t, env)
+		assert.NotEqual(t, srcEnv.Data.ID, env.Data.ID)
+		assert.Equal(t, srcEnv.Data.Attributes.Name, env.Data.Attributes.Name)
+		assert.Equal(t, srcEnv.Data.Attributes.Type, env.Data.Attributes.Type)
+		assert.Equal(t, srcEnv.Data.Attributes.ClusterURL, env.Data.Attributes.ClusterURL)
+		assert.Equal(t, spaceID.String()+"-stage-1", *env.Data.Attributes.NamespaceName, "the namespace of the source is not shared")
+	})
+
+	s.T().Run("ok_all_attributes", func(t *testing.T) {
+		payload := newCreateEnvironmentPayload("pr-12", "dev", "cluster1.com")
+		expiresAt := time.Now().Add(time.Hour)
+		payload.Data.Attributes.ExpiresAt = &expiresAt
+		payload.Data.Attributes.Protected = ptr.Bool(true)
+		_, src := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, spaceID, nil, payload)
+		require.NotNil(t, src)
+		test.LockEnvironmentOK(t, s.ctx, s.svc, s.ctrl, *src.Data.ID, nil, newLockEnvironmentPayload("release freeze", nil))
+
+		_, env := test.CloneEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, *src.Data.ID, nil)
+		require.NotNil(t, env)
+		assert.NotEqual(t, src.Data.ID, env.Data.ID)
+		assert.Equal(t, "pr-12", env.Data.Attributes.Name)
+		assert.Equal(t, "dev", env.Data.Attributes.Type)
+		assert.Equal(t, "cluster1.com", env.Data.Attributes.ClusterURL)
+		assert.Equal(t, spaceID, *env.Data.Attributes.SpaceID)
+		require.NotNil(t, env.Data.Attributes.ExpiresAt)
+		assert.WithinDuration(t, expiresAt, *env.Data.Attributes.ExpiresAt, time.Millisecond)
+		assert.Equal(t, ptr.Bool(true), env.Data.Attributes.Protected)
+		assert.NotEqual(t, src.Data.Attributes.NamespaceName, env.Data.Attributes.NamespaceName)
+		assert.Nil(t, env.Data.Attributes.Lock, "the lock of the source is not copied")
+	})
+
+	s.T().Run("ok_namespace_name", func(t *testing.T) {
+		clonePayload := newCloneEnvironmentPayload(&app.EnvironmentCloneAttributes{
+			NamespaceName: ptr.String("fork-" + spaceID.String()),
+		})
+		_, env := test.CloneEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, *srcEnv.Data.ID, clonePayload)
+		require.NotNil(t, env)
+		assert.Equal(t, "fork-"+spaceID.String(), *env.Data.Attributes.NamespaceName)
+	})
+
+	s.T().Run("namespace_conflict", func(t *testing.T) {
+		clonePayload := newCloneEnvironmentPayload(&app.EnvironmentCloneAttributes{
+			NamespaceName: srcEnv.Data.Attributes.NamespaceName,
+		})
+		_, err := test.CloneEnvironmentConflict(t, s.ctx, s.svc, s.ctrl, *srcEnv.Data.ID, clonePayload)
+		assert.NotNil(t, err)
+	})
+
+	s.T().Run("ok_other_space", func(t *testing.T) {
+		targetSpaceID := uuid.NewV4()
+		clonePayload := newCloneEnvironmentPayload(&app.EnvironmentCloneAttributes{
+			SpaceID: &targetSpaceID,
+			Name:    ptr.String("fork-stage"),
+		})
+
+		_, env := test.CloneEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, *srcEnv.Data.ID, clonePayload)
+		require.NotNil(t, env)
+		assert.Equal(t, "fork-stage", env.Data.Attributes.Name)
+		assert.Equal(t, "stage", env.Data.Attributes.Type)
+		assert.Equal(t, targetSpaceID.String()+"-stage", *env.Data.Attributes.NamespaceName)
+
+		_, list := test.ListEnvironmentOK(t, s.ctx, s.svc, s.ctrl, targetSpaceID)
+		require.Len(t, list.Data, 1)
+		assert.Equal(t, env.Data.ID, list.Data[0].ID)
+	})
+
+	s.T().Run("cluster_not_linked", func(t *testing.T) {
+		clonePayload := newCloneEnvironmentPayload(&app.EnvironmentCloneAttributes{
+			ClusterURL: ptr.String("cluster2.com"),
+		})
+		_, err := test.CloneEnvironmentForbidden(t, s.ctx, s.svc, s.ctrl, *srcEnv.Data.ID, clonePayload)
+		assert.NotNil(t, err)
+	})
+
+	s.T().Run("not_found", func(t *testing.T) {
+		_, err := test.CloneEnvironmentNotFound(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil)
+		assert.NotNil(t, err)
+	})
+}
+
 func (s *EnvironmentControllerSuite) TestValidate() {
 	s.T().Run("ok", func(t *testing.T) {
 		tables := []struct {
@@ -233,3 +538,21 @@ func newCreateEnvironmentPayload(name, envType, clusterURL string) *app.CreateEn
 	}
 	return payload
 }
+
+func newCloneEnvironmentPayload(attrs *app.EnvironmentCloneAttributes) *app.CloneEnvironmentPayload {
+	return &app.CloneEnvironmentPayload{
+		Data: &app.EnvironmentClone{
+			Attributes: attrs,
+			Type:       "environments",
+		},
+	}
+}
+
+func newUpdateEnvironmentPayload(attrs *app.EnvironmentUpdateAttributes) *app.UpdateEnvironmentPayload {
+	return &app.UpdateEnvironmentPayload{
+		Data: &app.EnvironmentUpdate{
+			Attributes: attrs,
+			Type:       "environments",
+		},
+	}
+}
@@ -14,6 +14,7 @@ import (
 	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
 	"github.com/fabric8-services/fabric8-env/app"
 	"github.com/fabric8-services/fabric8-env/app/test"
+	"github.com/fabric8-services/fabric8-env/authz"
 	"github.com/fabric8-services/fabric8-env/configuration"
 	"github.com/fabric8-services/fabric8-env/controller"
 	"github.com/fabric8-services/fabric8-env/gormapp"
@@ -39,12 +40,20 @@ user2	no		yes			yes
 user3	no		no			yes
 
 ** user operation matrix **
-================================
-user 	create 	list		show
-================================
-user1	yes		yes			yes
-user2	no		yes			yes
-user3	no		no			no
+=========================================
+user 	create 	list		show		clone
+=========================================
+user1	yes		yes			yes			yes
+user2	no		yes			yes			no
+user3	no		no			no			no
+
+** service account permission matrix **
+=========================================================
+account 				permission	create 	list	show	clone
+=========================================================
+fabric8-deployments		read-all	no		yes		yes		no
+fabric8-ops				manage-all	yes		yes		yes		yes
+fabric8-unknown			-			no		no		no		no
 */
 
 var testUser1 = &testauth.Identity{ID: uuid.NewV4(), Email: "user1@test.com", Username: "user1"} // user1
@@ -78,11 +87,17 @@ func (s *EnvironmentSpaceScopeSuite) SetupSuite() {
 	s.db = gormapp.NewGormDB(s.DB)
 	s.authServer = s.startAuthServer()
 	authURL := "http://" + s.authServer.Listener.Addr().String() + "/"
-	authService, err := auth.NewAuthService(authURL)
+	userAuthService, err := auth.NewAuthService(authURL)
 	require.NoError(s.T(), err)
 
 	s.svc = testauth.UnsecuredService("enviroment-test")
-	s.ctrl = controller.NewEnvironmentController(s.svc, s.db, authService, &testClusterService{})
+	config, err := configuration.New("")
+	require.NoError(s.T(), err)
+	authService := authz.NewServiceAccountAuthService(userAuthService, map[string][]string{
+		"fabric8-deployments": {authz.PermissionReadAll},
+		"fabric8-ops":         {authz.PermissionManageAll},
+	})
+	s.ctrl = controller.NewEnvironmentController(s.svc, s.db, authService, &testClusterService{}, &testClusterService{}, config)
 	s.spaceID = uuid.NewV4()
 
 	s.ctx1, _, err = testauth.EmbedUserTokenInContext(context.Background(), testUser1)
@@ -111,7 +126,7 @@ func (s *EnvironmentSpaceScopeSuite) TestAllScope() {
 
 	s.T().Run("user1", func(t *testing.T) {
 		t.Run("create", func(t *testing.T) {
-			_, newEnv = test.CreateEnvironmentCreated(t, s.ctx1, s.svc, s.ctrl, s.spaceID, payload)
+			_, newEnv = test.CreateEnvironmentCreated(t, s.ctx1, s.svc, s.ctrl, s.spaceID, nil, payload)
 			assert.NotNil(t, newEnv)
 		})
 
@@ -126,12 +141,18 @@ func (s *EnvironmentSpaceScopeSuite) TestAllScope() {
 			_, env := test.ShowEnvironmentOK(t, s.ctx1, s.svc, s.ctrl, *newEnv.Data.ID)
 			assert.NotNil(t, env)
 		})
+
+		t.Run("clone", func(t *testing.T) {
+			require.NotNil(t, newEnv)
+			_, env := test.CloneEnvironmentCreated(t, s.ctx1, s.svc, s.ctrl, *newEnv.Data.ID, nil)
+			assert.NotNil(t, env)
+		})
 	})
 
 	s.T().Run("user2", func(t *testing.T) {
 		t.Run("create", func(t *testing.T) {
 			require.NotNil(t, newEnv)
-			_, err := test.CreateEnvironmentForbidden(t, s.ctx2, s.svc, s.ctrl, s.spaceID, payload)
+			_, err := test.CreateEnvironmentForbidden(t, s.ctx2, s.svc, s.ctrl, s.spaceID, nil, payload)
 			assert.NotNil(t, err)
 		})
 
@@ -146,12 +167,18 @@ func (s *EnvironmentSpaceScopeSuite) TestAllScope() {
 			_, env := test.ShowEnvironmentOK(t, s.ctx2, s.svc, s.ctrl, *newEnv.Data.ID)
 			assert.NotNil(t, env)
 		})
+
+		t.Run("clone", func(t *testing.T) {
+			require.NotNil(t, newEnv)
+			_, err := test.CloneEnvironmentForbidden(t, s.ctx2, s.svc, s.ctrl, *newEnv.Data.ID, nil)
+			assert.NotNil(t, err)
+		})
 	})
 
 	s.T().Run("user3", func(t *testing.T) {
 		t.Run("create", func(t *testing.T) {
 			require.NotNil(t, newEnv)
-			_, err := test.CreateEnvironmentForbidden(t, s.ctx3, s.svc, s.ctrl, s.spaceID, payload)
+			_, err := test.CreateEnvironmentForbidden(t, s.ctx3, s.svc, s.ctrl, s.spaceID, nil, payload)
 			assert.NotNil(t, err)
 		})
 
@@ -166,6 +193,46 @@ func (s *EnvironmentSpaceScopeSuite) TestAllScope() {
 			_, err := test.ShowEnvironmentForbidden(t, s.ctx3, s.svc, s.ctrl, *newEnv.Data.ID)
 			assert.NotNil(t, err)
 		})
+
+		t.Run("clone", func(t *testing.T) {
+			require.NotNil(t, newEnv)
+			_, err := test.CloneEnvironmentForbidden(t, s.ctx3, s.svc, s.ctrl, *newEnv.Data.ID, nil)
+			assert.NotNil(t, err)
+		})
+	})
+}
+
+func (s *EnvironmentSpaceScopeSuite) TestServiceAccounts() {
+	payload := newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com")
+	_, newEnv := test.CreateEnvironmentCreated(s.T(), s.ctx1, s.svc, s.ctrl, s.spaceID, nil, payload)
+	require.NotNil(s.T(), newEnv)
+
+	// service account tokens are never sent to the auth service
+	s.T().Run("read_all", func(t *testing.T) {
+		ctx := contextWithServiceAccount("fabric8-deployments")
+		test.ListEnvironmentOK(t, ctx, s.svc, s.ctrl, s.spaceID)
+		test.ShowEnvironmentOK(t, ctx, s.svc, s.ctrl, *newEnv.Data.ID)
+		_, err := test.CreateEnvironmentForbidden(t, ctx, s.svc, s.ctrl, s.spaceID, nil, payload)
+		assert.NotNil(t, err)
+		_, err = test.CloneEnvironmentForbidden(t, ctx, s.svc, s.ctrl, *newEnv.Data.ID, nil)
+		assert.NotNil(t, err)
+	})
+
+	s.T().Run("manage_all", func(t *testing.T) {
+		ctx := contextWithServiceAccount("fabric8-ops")
+		test.ListEnvironmentOK(t, ctx, s.svc, s.ctrl, uuid.NewV4())
+		_, env := test.CreateEnvironmentCreated(t, ctx, s.svc, s.ctrl, uuid.NewV4(), nil, payload)
+		assert.NotNil(t, env)
+		_, env = test.CloneEnvironmentCreated(t, ctx, s.svc, s.ctrl, *newEnv.Data.ID, nil)
+		assert.NotNil(t, env)
+	})
+
+	s.T().Run("unknown", func(t *testing.T) {
+		ctx := contextWithServiceAccount("fabric8-unknown")
+		_, err := test.ListEnvironmentForbidden(t, ctx, s.svc, s.ctrl, s.spaceID)
+		assert.NotNil(t, err)
+		_, err = test.ShowEnvironmentForbidden(t, ctx, s.svc, s.ctrl, *newEnv.Data.ID)
+		assert.NotNil(t, err)
 	})
 }
 
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/convert/ptr"
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/fabric8-services/fabric8-env/app"
+	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/environment"
+	"github.com/fabric8-services/fabric8-env/idempotency"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+type idempotencyConfig interface {
+	GetIdempotencyWindow() time.Duration
+}
+
+// IdempotencyKeyMismatchError is returned when an Idempotency-Key is reused for a
+// request with a different body.
+type IdempotencyKeyMismatchError struct {
+	Key string
+}
+
+func (e IdempotencyKeyMismatchError) Error() string {
+	return fmt.Sprintf("idempotency key '%s' was used for a different request", e.Key)
+}
+
+// JSONAPIErrors converts the error to a 422 Unprocessable Entity JSONAPI error object.
+func (e IdempotencyKeyMismatchError) JSONAPIErrors() *app.JSONAPIErrors {
+	return &app.JSONAPIErrors{Errors: []*app.JSONAPIError{
+		{
+			Status: ptr.String(strconv.Itoa(http.StatusUnprocessableEntity)),
+			Code:   ptr.String("idempotency_key_mismatch"),
+			Title:  ptr.String("Idempotency key mismatch"),
+			Detail: e.Error(),
+			Source: map[string]interface{}{"parameter": "Idempotency-Key"},
+		},
+	}}
+}
+
+// idempotentRequest is a create request sent with an Idempotency-Key header.
+type idempotentRequest struct {
+	spaceID   uuid.UUID
+	key       string
+	hash      string
+	expiresAt time.Time
+}
+
+// newIdempotentRequest returns nil if the request has no Idempotency-Key header.
+// The template is the name of the template of the request, if any.
+func newIdempotentRequest(spaceID uuid.UUID, key *string, template string, payload interface{}, window time.Duration) (*idempotentRequest, error) {
+	if key == nil {
+		return nil, nil
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, errs.Wrap(err, "failed to hash the request")
+	}
+	return &idempotentRequest{
+		spaceID:   spaceID,
+		key:       *key,
+		hash:      idempotency.Hash([]byte(template), body),
+		expiresAt: time.Now().Add(window),
+	}, nil
+}
+
+// store returns a hook for createEnvironments which stores the response in the
+// same transaction as the created environments.
+func (r *idempotentRequest) store(ctx context.Context, status int, response func(envs []*environment.Environment) interface{}) func(appl application.Application, envs []*environment.Environment) error {
+	if r == nil {
+		return nil
+	}
+	return func(appl application.Application, envs []*environment.Environment) error {
+		body, err := json.Marshal(response(envs))
+		if err != nil {
+			return errs.Wrap(err, "failed to store the response of the idempotency key")
+		}
+		return appl.IdempotencyKeys().Create(ctx, &idempotency.Record{
+			SpaceID:        r.spaceID,
+			Key:            r.key,
+			RequestHash:    r.hash,
+			ResponseStatus: status,
+			ResponseBody:   string(body),
+			ExpiresAt:      r.expiresAt,
+		}, time.Now())
+	}
+}
+
+// replayContext is implemented by the contexts of the actions with an
+// Idempotency-Key header.
+type replayContext interface {
+	context.Context
+	UnprocessableEntity(r *app.JSONAPIErrors) error
+}
+
+// replay sends the stored response of a retried request with the respond func. It
+// returns false if there is no request or the key was not used yet, otherwise the
+// caller must return the error.
+func (c *EnvironmentController) replay(ctx replayContext, req *idempotentRequest, respond func(body []byte) error) (bool, error) {
+	if req == nil {
+		return false, nil
+	}
+	rec, err := c.db.IdempotencyKeys().Load(ctx, req.spaceID, req.key, time.Now())
+	if err != nil {
+		if _, ok := errs.Cause(err).(errors.NotFoundError); ok {
+			return false, nil
+		}
+		return true, app.JSONErrorResponse(ctx, err)
+	}
+
+	err = c.authService.RequireScope(ctx, req.spaceID.String(), "manage")
+	if err != nil {
+		return true, app.JSONErrorResponse(ctx, err)
+	}
+	if rec.RequestHash != req.hash {
+		return true, ctx.UnprocessableEntity(IdempotencyKeyMismatchError{Key: req.key}.JSONAPIErrors())
+	}
+	if rec.ResponseStatus != http.StatusCreated {
+		return true, app.JSONErrorResponse(ctx, errs.Errorf("unexpected status %d stored for idempotency key '%s'", rec.ResponseStatus, req.key))
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"space_id":        req.spaceID.String(),
+		"idempotency_key": req.key,
+	}, "replaying the response of a retried request")
+	return true, respond([]byte(rec.ResponseBody))
+}
+
+// decodeStoredResponse decodes a stored response into res. A corrupt one is sent
+// as an internal error, which the caller must return.
+func decodeStoredResponse(ctx context.Context, body []byte, res interface{}) error {
+	if err := json.Unmarshal(body, res); err != nil {
+		return app.JSONErrorResponse(ctx, errs.Wrap(err, "failed to replay the response of the idempotency key"))
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/convert/ptr"
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-env/app"
+	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/audit"
+	"github.com/fabric8-services/fabric8-env/environment"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// LockedError is returned when a mutating call is made on a locked environment, or
+// when a protected environment is deleted, without an override.
+type LockedError struct {
+	Detail string
+}
+
+func (e LockedError) Error() string {
+	return e.Detail
+}
+
+// JSONAPIErrors converts the error to a 423 Locked JSONAPI error object.
+func (e LockedError) JSONAPIErrors() *app.JSONAPIErrors {
+	return &app.JSONAPIErrors{Errors: []*app.JSONAPIError{
+		{
+			Status: ptr.String(strconv.Itoa(http.StatusLocked)),
+			Code:   ptr.String("locked"),
+			Title:  ptr.String("Locked"),
+			Detail: e.Detail,
+		},
+	}}
+}
+
+// checkMutable rejects changes of a locked environment and the deletion of a
+// protected one or the removal of its protection, unless an override justification
+// is given. The caller must have verified the 'manage' scope already. The returned
+// audit entry records the override and must be stored together with the change.
+func checkMutable(ctx context.Context, env *environment.Environment, action string, unprotect bool, override *string) (*audit.Entry, error) {
+	locked := env.IsLocked(time.Now())
+	protected := unprotect && env.Protected
+	if !locked && !protected {
+		return nil, nil
+	}
+
+	if override == nil || strings.TrimSpace(*override) == "" {
+		if locked {
+			return nil, LockedError{Detail: fmt.Sprintf("environment '%s' is locked: %s", env.ID, *env.LockReason)}
+		}
+		if action == audit.ActionDelete {
+			return nil, LockedError{Detail: fmt.Sprintf("environment '%s' is protected against deletion", env.ID)}
+		}
+		return nil, LockedError{Detail: fmt.Sprintf("environment '%s' is protected, removing the protection requires an override", env.ID)}
+	}
+
+	details := audit.Details{
+		"action":        action,
+		"justification": strings.TrimSpace(*override),
+		"protected":     env.Protected,
+	}
+	if locked {
+		details["lock-reason"] = *env.LockReason
+	}
+	return &audit.Entry{
+		EnvironmentID: *env.ID,
+		SpaceID:       *env.SpaceID,
+		Action:        audit.ActionLockOverride,
+		Actor:         actorFromContext(ctx),
+		Details:       details,
+	}, nil
+}
+
+func (c *EnvironmentController) Lock(ctx *app.LockEnvironmentContext) error {
+	reqLock := ctx.Payload.Data
+	if reqLock == nil || reqLock.Attributes == nil {
+		return app.JSONErrorResponse(ctx, errors.NewBadParameterError("data", nil).Expected("not nil"))
+	}
+
+	var verrs ValidationErrors
+	reason := strings.TrimSpace(reqLock.Attributes.Reason)
+	if reason == "" {
+		verrs.add("/data/attributes/reason", "reason must not be empty")
+	}
+	now := time.Now()
+	if reqLock.Attributes.ExpiresAt != nil && !reqLock.Attributes.ExpiresAt.After(now) {
+		verrs.add("/data/attributes/expires-at", "expires-at must be in the future")
+	}
+	if len(verrs) > 0 {
+		return ctx.BadRequest(verrs.JSONAPIErrors())
+	}
+
+	env, err := c.updateWithAudit(ctx, ctx.EnvID, audit.ActionLock, func(env *environment.Environment) (*audit.Entry, audit.Details, error) {
+		// replacing an active lock requires an override like any other change
+		overrideEntry, err := checkMutable(ctx, env, audit.ActionLock, false, ctx.Override)
+		if err != nil {
+			if lockedErr, ok := err.(LockedError); ok {
+				return nil, nil, errors.NewDataConflictError(lockedErr.Detail)
+			}
+			return nil, nil, err
+		}
+
+		actor := actorFromContext(ctx)
+		env.LockedAt = &now
+		env.LockedBy = &actor
+		env.LockReason = &reason
+		env.LockExpiresAt = reqLock.Attributes.ExpiresAt
+
+		details := audit.Details{"reason": reason}
+		if env.LockExpiresAt != nil {
+			details["expires-at"] = env.LockExpiresAt.UTC().Format(time.RFC3339)
+		}
+		return overrideEntry, details, nil
+	})
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+	return ctx.OK(&app.EnvironmentSingle{Data: ConvertEnvironment(env)})
+}
+
+func (c *EnvironmentController) Unlock(ctx *app.UnlockEnvironmentContext) error {
+	justification := strings.TrimSpace(ctx.Justification)
+	if justification == "" {
+		return app.JSONErrorResponse(ctx, errors.NewBadParameterError("justification", ctx.Justification).Expected("not blank"))
+	}
+
+	env, err := c.updateWithAudit(ctx, ctx.EnvID, audit.ActionUnlock, func(env *environment.Environment) (*audit.Entry, audit.Details, error) {
+		details := audit.Details{"justification": justification}
+		if env.LockReason != nil {
+			details["reason"] = *env.LockReason
+		}
+		env.LockedAt = nil
+		env.LockedBy = nil
+		env.LockReason = nil
+		env.LockExpiresAt = nil
+		return nil, details, nil
+	})
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+	return ctx.OK(&app.EnvironmentSingle{Data: ConvertEnvironment(env)})
+}
+
+// updateWithAudit checks the 'manage' scope, then loads and locks the environment
+// in a transaction and applies the change. Then it saves the environment and
+// records the action, preceded by the optional override entry returned by change,
+// in the same transaction.
+func (c *EnvironmentController) updateWithAudit(ctx context.Context, envID uuid.UUID, action string,
+	change func(env *environment.Environment) (*audit.Entry, audit.Details, error)) (*environment.Environment, error) {
+	authorized, err := c.loadAuthorized(ctx, envID, "manage")
+	if err != nil {
+		return nil, err
+	}
+
+	var res *environment.Environment
+	err = application.Transactional(ctx, c.db, func(appl application.Application) error {
+		env, err := loadForUpdate(ctx, appl, authorized)
+		if err != nil {
+			return err
+		}
+
+		overrideEntry, details, err := change(env)
+		if err != nil {
+			return err
+		}
+
+		res, err = appl.Environments().Save(ctx, env)
+		if err != nil {
+			return errs.Wrapf(err, "failed to %s environment: %s", action, env.ID)
+		}
+		return createAuditEntries(ctx, appl, overrideEntry, &audit.Entry{
+			EnvironmentID: *env.ID,
+			SpaceID:       *env.SpaceID,
+			Action:        action,
+			Actor:         actorFromContext(ctx),
+			Details:       details,
+		})
+	})
+	return res, err
+}
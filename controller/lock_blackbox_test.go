@@ -0,0 +1,154 @@
+package controller_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/convert/ptr"
+	"github.com/fabric8-services/fabric8-env/app"
+	"github.com/fabric8-services/fabric8-env/app/test"
+	"github.com/fabric8-services/fabric8-env/audit"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *EnvironmentControllerSuite) TestProtected() {
+	s.T().Run("run_protected_by_default", func(t *testing.T) {
+		_, env := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil, newCreateEnvironmentPayload("osio-run", "run", "cluster1.com"))
+		assert.True(t, *env.Data.Attributes.Protected)
+
+		_, jerrs := test.DeleteEnvironmentLocked(t, s.ctx, s.svc, s.ctrl, *env.Data.ID, nil)
+		require.NotNil(t, jerrs)
+		assert.Equal(t, "423", *jerrs.Errors[0].Status)
+		test.ShowEnvironmentOK(t, s.ctx, s.svc, s.ctrl, *env.Data.ID)
+	})
+
+	s.T().Run("delete_with_override", func(t *testing.T) {
+		_, env := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil, newCreateEnvironmentPayload("osio-run", "run", "cluster1.com"))
+
+		test.DeleteEnvironmentNoContent(t, s.ctx, s.svc, s.ctrl, *env.Data.ID, ptr.String("decommissioned app"))
+		test.ShowEnvironmentNotFound(t, s.ctx, s.svc, s.ctrl, *env.Data.ID)
+
+		entries, err := s.db.AuditLogs().List(s.ctx, *env.Data.ID)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, audit.ActionLockOverride, entries[0].Action)
+		assert.Equal(t, "decommissioned app", entries[0].Details["justification"])
+		assert.Equal(t, audit.ActionDelete, entries[1].Action)
+	})
+
+	s.T().Run("unprotect_with_override", func(t *testing.T) {
+		_, env := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil, newCreateEnvironmentPayload("osio-run", "run", "cluster1.com"))
+		update := newUpdateEnvironmentPayload(&app.EnvironmentUpdateAttributes{Protected: ptr.Bool(false)})
+
+		_, jerrs := test.UpdateEnvironmentLocked(t, s.ctx, s.svc, s.ctrl, *env.Data.ID, nil, update)
+		require.NotNil(t, jerrs)
+
+		_, updated := test.UpdateEnvironmentOK(t, s.ctx, s.svc, s.ctrl, *env.Data.ID, ptr.String("app retired"), update)
+		assert.False(t, *updated.Data.Attributes.Protected)
+
+		entries, err := s.db.AuditLogs().List(s.ctx, *env.Data.ID)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Equal(t, audit.ActionLockOverride, entries[0].Action)
+		assert.Equal(t, "app retired", entries[0].Details["justification"])
+		assert.Equal(t, audit.ActionUpdate, entries[1].Action)
+	})
+
+	s.T().Run("delete_unprotected", func(t *testing.T) {
+		_, env := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil, newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com"))
+		assert.False(t, *env.Data.Attributes.Protected)
+
+		test.DeleteEnvironmentNoContent(t, s.ctx, s.svc, s.ctrl, *env.Data.ID, nil)
+		test.ShowEnvironmentNotFound(t, s.ctx, s.svc, s.ctrl, *env.Data.ID)
+	})
+}
+
+func (s *EnvironmentControllerSuite) TestLock() {
+	_, env := test.CreateEnvironmentCreated(s.T(), s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil, newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com"))
+	envID := *env.Data.ID
+	update := newUpdateEnvironmentPayload(&app.EnvironmentUpdateAttributes{Name: ptr.String("osio-stage2")})
+
+	s.T().Run("lock", func(t *testing.T) {
+		_, locked := test.LockEnvironmentOK(t, s.ctx, s.svc, s.ctrl, envID, nil, newLockEnvironmentPayload("release freeze", nil))
+		require.NotNil(t, locked.Data.Attributes.Lock)
+		assert.Equal(t, "release freeze", locked.Data.Attributes.Lock.Reason)
+	})
+
+	s.T().Run("relock", func(t *testing.T) {
+		_, jerrs := test.LockEnvironmentConflict(t, s.ctx, s.svc, s.ctrl, envID, nil, newLockEnvironmentPayload("maintenance", nil))
+		require.NotNil(t, jerrs)
+		assert.Contains(t, jerrs.Errors[0].Detail, "release freeze")
+
+		_, locked := test.LockEnvironmentOK(t, s.ctx, s.svc, s.ctrl, envID, ptr.String("freeze extended"), newLockEnvironmentPayload("release freeze", nil))
+		assert.Equal(t, "release freeze", locked.Data.Attributes.Lock.Reason)
+	})
+
+	s.T().Run("lock_invalid", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour)
+		_, jerrs := test.LockEnvironmentBadRequest(t, s.ctx, s.svc, s.ctrl, envID, nil, newLockEnvironmentPayload(" ", &past))
+		require.NotNil(t, jerrs)
+		assert.Len(t, jerrs.Errors, 2)
+	})
+
+	s.T().Run("update_locked", func(t *testing.T) {
+		_, jerrs := test.UpdateEnvironmentLocked(t, s.ctx, s.svc, s.ctrl, envID, nil, update)
+		require.NotNil(t, jerrs)
+		assert.Contains(t, jerrs.Errors[0].Detail, "release freeze")
+
+		_, jerrs = test.DeleteEnvironmentLocked(t, s.ctx, s.svc, s.ctrl, envID, ptr.String("  "))
+		require.NotNil(t, jerrs)
+	})
+
+	s.T().Run("update_with_override", func(t *testing.T) {
+		_, updated := test.UpdateEnvironmentOK(t, s.ctx, s.svc, s.ctrl, envID, ptr.String("hotfix"), update)
+		assert.Equal(t, "osio-stage2", updated.Data.Attributes.Name)
+		assert.NotNil(t, updated.Data.Attributes.Lock)
+	})
+
+	s.T().Run("unlock", func(t *testing.T) {
+		_, jerrs := test.UnlockEnvironmentBadRequest(t, s.ctx, s.svc, s.ctrl, envID, " ")
+		require.NotNil(t, jerrs)
+
+		_, unlocked := test.UnlockEnvironmentOK(t, s.ctx, s.svc, s.ctrl, envID, "release done")
+		assert.Nil(t, unlocked.Data.Attributes.Lock)
+		test.UpdateEnvironmentOK(t, s.ctx, s.svc, s.ctrl, envID, nil, update)
+	})
+
+	s.T().Run("expired_lock", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour)
+		test.LockEnvironmentOK(t, s.ctx, s.svc, s.ctrl, envID, nil, newLockEnvironmentPayload("maintenance", &expiresAt))
+
+		stored, err := s.db.Environments().Load(s.ctx, envID)
+		require.NoError(t, err)
+		assert.True(t, stored.IsLocked(time.Now()))
+		assert.False(t, stored.IsLocked(expiresAt.Add(time.Second)))
+	})
+
+	s.T().Run("audit", func(t *testing.T) {
+		entries, err := s.db.AuditLogs().List(s.ctx, envID)
+		require.NoError(t, err)
+		var actions []string
+		for _, entry := range entries {
+			actions = append(actions, entry.Action)
+		}
+		assert.Equal(t, []string{
+			audit.ActionLock, audit.ActionLockOverride, audit.ActionLock, audit.ActionLockOverride, audit.ActionUpdate,
+			audit.ActionUnlock, audit.ActionUpdate, audit.ActionLock,
+		}, actions)
+		assert.Equal(t, "release done", entries[5].Details["justification"])
+	})
+}
+
+func newLockEnvironmentPayload(reason string, expiresAt *time.Time) *app.LockEnvironmentPayload {
+	return &app.LockEnvironmentPayload{
+		Data: &app.EnvironmentLockRequest{
+			Type: "environment-locks",
+			Attributes: &app.EnvironmentLock{
+				Reason:    reason,
+				ExpiresAt: expiresAt,
+			},
+		},
+	}
+}
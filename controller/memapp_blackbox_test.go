@@ -0,0 +1,58 @@
+package controller_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-env/memapp"
+	"github.com/stretchr/testify/suite"
+)
+
+// The controller suites run against the in-memory application as well, so that
+// they need no Postgres and check that both applications behave alike.
+
+// withoutPostgres replaces the hooks of testsuite.DBTestSuite, which use the
+// database, in the suites run against the in-memory application.
+type withoutPostgres struct{}
+
+func (withoutPostgres) SetupTest()     {}
+func (withoutPostgres) TearDownTest()  {}
+func (withoutPostgres) TearDownSuite() {}
+
+type EnvironmentControllerMemorySuite struct {
+	EnvironmentControllerSuite
+	withoutPostgres
+}
+
+func TestEnvironmentControllerInMemory(t *testing.T) {
+	suite.Run(t, &EnvironmentControllerMemorySuite{})
+}
+
+func (s *EnvironmentControllerMemorySuite) SetupSuite() {
+	s.setup(memapp.NewMemoryDB())
+}
+
+type AdminControllerMemorySuite struct {
+	AdminControllerSuite
+	withoutPostgres
+}
+
+func TestAdminControllerInMemory(t *testing.T) {
+	suite.Run(t, &AdminControllerMemorySuite{})
+}
+
+func (s *AdminControllerMemorySuite) SetupSuite() {
+	s.setup(memapp.NewMemoryDB())
+}
+
+type TemplateControllerMemorySuite struct {
+	TemplateControllerSuite
+	withoutPostgres
+}
+
+func TestTemplateControllerInMemory(t *testing.T) {
+	suite.Run(t, &TemplateControllerMemorySuite{})
+}
+
+func (s *TemplateControllerMemorySuite) SetupSuite() {
+	s.setup(memapp.NewMemoryDB())
+}
@@ -0,0 +1,159 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/fabric8-services/fabric8-common/convert/ptr"
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/fabric8-services/fabric8-env/app"
+	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/quota"
+	uuid "github.com/satori/go.uuid"
+)
+
+// APIStringTypeSpaceQuota is the JSONAPI type of a space quota.
+const APIStringTypeSpaceQuota = "space-quotas"
+
+type quotaConfig interface {
+	GetSpaceEnvironmentsQuota() int
+}
+
+// QuotaExceededError is returned when creating environments would exceed the
+// maximum number of environments of a space.
+type QuotaExceededError struct {
+	SpaceID uuid.UUID
+	Limit   int
+	Count   int
+}
+
+func (e QuotaExceededError) Error() string {
+	return fmt.Sprintf("space '%s' reached the limit of %d environments", e.SpaceID, e.Limit)
+}
+
+// JSONAPIErrors converts the error to a 403 Forbidden JSONAPI error object which
+// names the limit in its meta object.
+func (e QuotaExceededError) JSONAPIErrors() *app.JSONAPIErrors {
+	return &app.JSONAPIErrors{Errors: []*app.JSONAPIError{
+		{
+			Status: ptr.String(strconv.Itoa(http.StatusForbidden)),
+			Code:   ptr.String("quota_exceeded"),
+			Title:  ptr.String("Quota exceeded"),
+			Detail: e.Error(),
+			Meta: map[string]interface{}{
+				"limit": e.Limit,
+				"count": e.Count,
+			},
+		},
+	}}
+}
+
+// checkQuota verifies that n more environments fit into the space. It locks the
+// space for the rest of the transaction, so concurrent creates can't exceed the limit.
+func checkQuota(ctx context.Context, appl application.Application, config quotaConfig, spaceID uuid.UUID, n int) error {
+	err := appl.Environments().LockSpace(ctx, spaceID)
+	if err != nil {
+		return err
+	}
+
+	limit := config.GetSpaceEnvironmentsQuota()
+	q, err := appl.SpaceQuotas().Load(ctx, spaceID)
+	if err != nil {
+		return err
+	}
+	if q != nil {
+		limit = q.MaxEnvironments
+	}
+	if limit < 0 {
+		return nil
+	}
+
+	count, err := appl.Environments().Count(ctx, spaceID)
+	if err != nil {
+		return err
+	}
+	if count+n > limit {
+		return QuotaExceededError{SpaceID: spaceID, Limit: limit, Count: count}
+	}
+	return nil
+}
+
+func (c *AdminController) ShowSpaceQuota(ctx *app.ShowSpaceQuotaAdminContext) error {
+	err := c.requireAdmin(ctx)
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	q, err := c.db.SpaceQuotas().Load(ctx, ctx.SpaceID)
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+	return ctx.OK(&app.SpaceQuotaSingle{Data: c.convertSpaceQuota(ctx.SpaceID, q)})
+}
+
+func (c *AdminController) SetSpaceQuota(ctx *app.SetSpaceQuotaAdminContext) error {
+	err := c.requireAdmin(ctx)
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	reqQuota := ctx.Payload.Data
+	if reqQuota == nil || reqQuota.Attributes == nil {
+		return app.JSONErrorResponse(ctx, errors.NewBadParameterError("data", nil).Expected("not nil"))
+	}
+	if reqQuota.Attributes.MaxEnvironments < 0 {
+		var verrs ValidationErrors
+		verrs.add("/data/attributes/max-environments", "max-environments must not be negative")
+		return ctx.BadRequest(verrs.JSONAPIErrors())
+	}
+	q, err := c.db.SpaceQuotas().Save(ctx, &quota.SpaceQuota{
+		SpaceID:         ctx.SpaceID,
+		MaxEnvironments: reqQuota.Attributes.MaxEnvironments,
+	})
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"space_id":         ctx.SpaceID.String(),
+		"max_environments": q.MaxEnvironments,
+	}, "space quota overridden")
+	return ctx.OK(&app.SpaceQuotaSingle{Data: c.convertSpaceQuota(ctx.SpaceID, q)})
+}
+
+func (c *AdminController) DeleteSpaceQuota(ctx *app.DeleteSpaceQuotaAdminContext) error {
+	err := c.requireAdmin(ctx)
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	err = c.db.SpaceQuotas().Delete(ctx, ctx.SpaceID)
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+	return ctx.NoContent()
+}
+
+// convertSpaceQuota converts the override of a space, or the default if q is nil.
+func (c *AdminController) convertSpaceQuota(spaceID uuid.UUID, q *quota.SpaceQuota) *app.SpaceQuota {
+	res := &app.SpaceQuota{
+		ID:   &spaceID,
+		Type: APIStringTypeSpaceQuota,
+		Attributes: &app.SpaceQuotaAttributes{
+			MaxEnvironments: c.config.GetSpaceEnvironmentsQuota(),
+			Default:         ptr.Bool(true),
+		},
+	}
+	if q != nil {
+		res.Attributes.MaxEnvironments = q.MaxEnvironments
+		res.Attributes.Default = ptr.Bool(false)
+	}
+	if res.Attributes.MaxEnvironments < 0 {
+		// only the default can disable the limit
+		res.Attributes.MaxEnvironments = -1
+	}
+	return res
+}
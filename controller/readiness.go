@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"sync/atomic"
+
+	errs "github.com/pkg/errors"
+)
+
+const (
+	readinessStarting int32 = iota
+	readinessReady
+	readinessShuttingDown
+)
+
+// Readiness tracks whether the instance has started up and is not shutting
+// down, i.e. whether it should receive requests. It is safe for concurrent use.
+type Readiness struct {
+	state int32
+}
+
+// NewReadiness returns a Readiness of an instance which is starting up.
+func NewReadiness() *Readiness {
+	return &Readiness{state: readinessStarting}
+}
+
+// SetReady marks the start up as completed, unless the instance is already
+// shutting down.
+func (r *Readiness) SetReady() {
+	atomic.CompareAndSwapInt32(&r.state, readinessStarting, readinessReady)
+}
+
+// SetShuttingDown marks the instance as shutting down, it is never ready again.
+func (r *Readiness) SetShuttingDown() {
+	atomic.StoreInt32(&r.state, readinessShuttingDown)
+}
+
+// Check returns an error unless the instance is ready.
+func (r *Readiness) Check() error {
+	switch atomic.LoadInt32(&r.state) {
+	case readinessStarting:
+		return errs.New("instance is starting up")
+	case readinessShuttingDown:
+		return errs.New("instance is shutting down")
+	}
+	return nil
+}
@@ -0,0 +1,186 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-common/httpsupport"
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/fabric8-services/fabric8-env/app"
+	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/audit"
+	"github.com/fabric8-services/fabric8-env/environment"
+	errs "github.com/pkg/errors"
+)
+
+type spaceConfig interface {
+	GetSpaceServiceAccounts() []string
+	GetSpaceDefaultEnvironments() []string
+}
+
+// CreateDefaults creates the default environments of a new space. Types which
+// exist in the space already are skipped, so the space service can safely retry.
+func (c *EnvironmentController) CreateDefaults(ctx *app.CreateDefaultsEnvironmentContext) error {
+	spaceID := ctx.SpaceID
+	var err error
+	serviceAccount := serviceAccountName(ctx) != ""
+	if serviceAccount {
+		err = requireServiceAccount(ctx, c.config.GetSpaceServiceAccounts())
+	} else {
+		err = c.authService.RequireScope(ctx, spaceID.String(), "manage")
+	}
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	clusterURL, err := c.defaultCluster(ctx, ctx.ClusterURL, serviceAccount)
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	envTypes := c.config.GetSpaceDefaultEnvironments()
+	var envs, created []*environment.Environment
+	err = application.Transactional(ctx, c.db, func(appl application.Application) error {
+		// the transaction may be run again
+		envs, created = nil, nil
+		// concurrent calls must not both see a type as missing
+		err := appl.Environments().LockSpace(ctx, spaceID)
+		if err != nil {
+			return err
+		}
+		existing, err := appl.Environments().List(ctx, spaceID)
+		if err != nil {
+			return err
+		}
+		byType := make(map[string]*environment.Environment, len(envTypes))
+		for _, env := range existing {
+			if _, ok := byType[*env.Type]; !ok {
+				byType[*env.Type] = env
+			}
+		}
+
+		var attrs []*app.EnvironmentAttributes
+		missing := make(map[string]bool, len(envTypes))
+		for _, envType := range envTypes {
+			if _, ok := byType[envType]; ok || missing[envType] {
+				continue
+			}
+			missing[envType] = true
+			attrs = append(attrs, &app.EnvironmentAttributes{
+				Name:       envType,
+				Type:       envType,
+				ClusterURL: clusterURL,
+			})
+		}
+		if len(attrs) > 0 {
+			created, err = c.insertEnvironments(ctx, appl, spaceID, attrs)
+			if err != nil {
+				return err
+			}
+		}
+		for _, env := range created {
+			byType[*env.Type] = env
+		}
+		listed := make(map[string]bool, len(envTypes))
+		for _, envType := range envTypes {
+			if !listed[envType] {
+				envs = append(envs, byType[envType])
+				listed[envType] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		if qerr, ok := errs.Cause(err).(QuotaExceededError); ok {
+			return ctx.Forbidden(qerr.JSONAPIErrors())
+		}
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	res := ConvertEnvironments(envs)
+	if len(created) == 0 {
+		return ctx.OK(res)
+	}
+	log.Info(ctx, map[string]interface{}{
+		"space_id":    spaceID.String(),
+		"cluster_url": clusterURL,
+		"count":       len(created),
+	}, "created the default environments of a space")
+	return ctx.Created(res)
+}
+
+// defaultCluster returns the cluster of the default environments. The space
+// service accounts have no clusters of their own, so they must give the cluster of
+// the space owner, which must be known to the Cluster service. A user gets the given
+// cluster if it is linked with the account, or the first linked one.
+func (c *EnvironmentController) defaultCluster(ctx context.Context, clusterURL *string, serviceAccount bool) (string, error) {
+	if serviceAccount {
+		if clusterURL == nil {
+			return "", errors.NewBadParameterError("cluster-url", nil).Expected("the cluster of the space owner")
+		}
+		url := httpsupport.RemoveTrailingSlashFromURL(*clusterURL)
+		return url, checkClusterKnown(ctx, c.clusters, url, "cluster-url")
+	}
+	if clusterURL != nil {
+		url := httpsupport.RemoveTrailingSlashFromURL(*clusterURL)
+		return url, c.checkClustersUser(ctx, url)
+	}
+	clusters, err := c.clusterService.UserClusters(ctx)
+	if err != nil {
+		return "", err
+	}
+	if clusters == nil || len(clusters.Data) == 0 {
+		return "", errors.NewForbiddenError("no cluster linked with user account")
+	}
+	return httpsupport.RemoveTrailingSlashFromURL(clusters.Data[0].APIURL), nil
+}
+
+// DeleteSpace soft-deletes all environments of a deleted space. It is called by the
+// space service, so the caller is authorized by its service account token and not
+// by the scope of a user in the space, which does not exist anymore.
+func (c *EnvironmentController) DeleteSpace(ctx *app.DeleteSpaceEnvironmentContext) error {
+	err := requireServiceAccount(ctx, c.config.GetSpaceServiceAccounts())
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	count := 0
+	err = application.Transactional(ctx, c.db, func(appl application.Application) error {
+		envs, err := appl.Environments().List(ctx, ctx.SpaceID)
+		if err != nil {
+			return err
+		}
+		actor := actorFromContext(ctx)
+		for _, env := range envs {
+			if err := appl.Environments().Delete(ctx, *env.ID); err != nil {
+				return errs.Wrapf(err, "failed to delete environment: %s", env.ID)
+			}
+			_, err := appl.AuditLogs().Create(ctx, &audit.Entry{
+				EnvironmentID: *env.ID,
+				SpaceID:       *env.SpaceID,
+				Action:        audit.ActionDelete,
+				Actor:         actor,
+				Details: audit.Details{
+					"name":      *env.Name,
+					"reason":    "space deleted",
+					"protected": env.Protected,
+				},
+			})
+			if err != nil {
+				return errs.Wrapf(err, "failed to audit deletion of environment: %s", env.ID)
+			}
+		}
+		count = len(envs)
+		// the quota override is useless without the space
+		return appl.SpaceQuotas().Delete(ctx, ctx.SpaceID)
+	})
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	log.Info(ctx, map[string]interface{}{
+		"space_id": ctx.SpaceID.String(),
+		"count":    count,
+	}, "deleted the environments of a deleted space")
+	return ctx.NoContent()
+}
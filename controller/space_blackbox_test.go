@@ -0,0 +1,128 @@
+package controller_test
+
+import (
+	"testing"
+
+	"github.com/fabric8-services/fabric8-common/convert/ptr"
+	"github.com/fabric8-services/fabric8-env/app/test"
+	"github.com/fabric8-services/fabric8-env/audit"
+	"github.com/fabric8-services/fabric8-env/controller"
+	"github.com/fabric8-services/fabric8-env/quota"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func (s *EnvironmentControllerSuite) TestDeleteSpace() {
+	spaceID := uuid.NewV4()
+	_, stage := test.CreateEnvironmentCreated(s.T(), s.ctx, s.svc, s.ctrl, spaceID, nil, newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com"))
+	_, run := test.CreateEnvironmentCreated(s.T(), s.ctx, s.svc, s.ctrl, spaceID, nil, newCreateEnvironmentPayload("osio-run", "run", "cluster1.com"))
+	_, other := test.CreateEnvironmentCreated(s.T(), s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil, newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com"))
+	_, err := s.db.SpaceQuotas().Save(s.ctx, &quota.SpaceQuota{SpaceID: spaceID, MaxEnvironments: 10})
+	require.NoError(s.T(), err)
+
+	s.T().Run("user_token_forbidden", func(t *testing.T) {
+		_, err := test.DeleteSpaceEnvironmentForbidden(t, s.ctx, s.svc, s.ctrl, spaceID)
+		assert.NotNil(t, err)
+	})
+
+	s.T().Run("unknown_service_account_forbidden", func(t *testing.T) {
+		_, err := test.DeleteSpaceEnvironmentForbidden(t, contextWithServiceAccount("fabric8-tenant"), s.svc, s.ctrl, spaceID)
+		assert.NotNil(t, err)
+		test.ShowEnvironmentOK(t, s.ctx, s.svc, s.ctrl, *stage.Data.ID)
+	})
+
+	s.T().Run("ok", func(t *testing.T) {
+		test.DeleteSpaceEnvironmentNoContent(t, contextWithServiceAccount("fabric8-wit"), s.svc, s.ctrl, spaceID)
+
+		// protected environments are deleted too
+		for _, envID := range []uuid.UUID{*stage.Data.ID, *run.Data.ID} {
+			test.ShowEnvironmentNotFound(t, s.ctx, s.svc, s.ctrl, envID)
+
+			entries, err := s.db.AuditLogs().List(s.ctx, envID)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, audit.ActionDelete, entries[0].Action)
+			assert.Equal(t, "service-account:fabric8-wit", entries[0].Actor)
+			assert.Equal(t, "space deleted", entries[0].Details["reason"])
+		}
+		test.ShowEnvironmentOK(t, s.ctx, s.svc, s.ctrl, *other.Data.ID)
+
+		q, err := s.db.SpaceQuotas().Load(s.ctx, spaceID)
+		require.NoError(t, err)
+		assert.Nil(t, q)
+	})
+
+	s.T().Run("repeated", func(t *testing.T) {
+		test.DeleteSpaceEnvironmentNoContent(t, contextWithServiceAccount("fabric8-wit"), s.svc, s.ctrl, spaceID)
+	})
+}
+
+func (s *EnvironmentControllerSuite) TestCreateDefaults() {
+	spaceCtx := contextWithServiceAccount("fabric8-wit")
+	ownerCluster := ptr.String("cluster1.com/")
+
+	s.T().Run("ok", func(t *testing.T) {
+		spaceID := uuid.NewV4()
+		_, list := test.CreateDefaultsEnvironmentCreated(t, spaceCtx, s.svc, s.ctrl, spaceID, ownerCluster)
+		require.NotNil(t, list)
+		require.Len(t, list.Data, 2)
+		assert.Equal(t, "stage", list.Data[0].Attributes.Type)
+		assert.Equal(t, "run", list.Data[1].Attributes.Type)
+		assert.Equal(t, "cluster1.com", list.Data[0].Attributes.ClusterURL)
+		assert.True(t, *list.Data[1].Attributes.Protected)
+
+		// calling it again is harmless
+		_, again := test.CreateDefaultsEnvironmentOK(t, spaceCtx, s.svc, s.ctrl, spaceID, ownerCluster)
+		require.Len(t, again.Data, 2)
+		assert.Equal(t, *list.Data[0].ID, *again.Data[0].ID)
+		assert.Equal(t, *list.Data[1].ID, *again.Data[1].ID)
+
+		_, envs := test.ListEnvironmentOK(t, s.ctx, s.svc, s.ctrl, spaceID)
+		assert.Len(t, envs.Data, 2)
+	})
+
+	s.T().Run("missing_types_only", func(t *testing.T) {
+		spaceID := uuid.NewV4()
+		_, stage := test.CreateEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, spaceID, nil, newCreateEnvironmentPayload("osio-stage", "stage", "cluster1.com"))
+
+		_, list := test.CreateDefaultsEnvironmentCreated(t, spaceCtx, s.svc, s.ctrl, spaceID, ownerCluster)
+		require.Len(t, list.Data, 2)
+		assert.Equal(t, *stage.Data.ID, *list.Data[0].ID)
+		assert.Equal(t, "run", list.Data[1].Attributes.Type)
+	})
+
+	s.T().Run("user_with_scope", func(t *testing.T) {
+		test.CreateDefaultsEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), nil)
+	})
+
+	s.T().Run("user_cluster", func(t *testing.T) {
+		test.CreateDefaultsEnvironmentCreated(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), ptr.String("cluster1.com"))
+
+		_, err := test.CreateDefaultsEnvironmentForbidden(t, s.ctx, s.svc, s.ctrl, uuid.NewV4(), ptr.String("cluster2.com"))
+		assert.NotNil(t, err)
+	})
+
+	s.T().Run("owner_cluster_required", func(t *testing.T) {
+		_, err := test.CreateDefaultsEnvironmentBadRequest(t, spaceCtx, s.svc, s.ctrl, uuid.NewV4(), nil)
+		assert.NotNil(t, err)
+
+		_, err = test.CreateDefaultsEnvironmentBadRequest(t, spaceCtx, s.svc, s.ctrl, uuid.NewV4(), ptr.String("cluster2.com"))
+		assert.NotNil(t, err)
+	})
+
+	s.T().Run("unknown_service_account_forbidden", func(t *testing.T) {
+		spaceID := uuid.NewV4()
+		_, err := test.CreateDefaultsEnvironmentForbidden(t, contextWithServiceAccount("fabric8-tenant"), s.svc, s.ctrl, spaceID, ownerCluster)
+		assert.NotNil(t, err)
+
+		_, envs := test.ListEnvironmentOK(t, s.ctx, s.svc, s.ctrl, spaceID)
+		assert.Empty(t, envs.Data)
+	})
+}
+
+func (s *EnvironmentControllerSuite) TestValidateEnvironmentTypes() {
+	assert.NoError(s.T(), controller.ValidateEnvironmentTypes([]string{"stage", "run"}))
+	assert.NoError(s.T(), controller.ValidateEnvironmentTypes(nil))
+	assert.Error(s.T(), controller.ValidateEnvironmentTypes([]string{"stage", "prod"}))
+}
@@ -1,30 +1,46 @@
 package controller
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/fabric8-services/fabric8-common/log"
 	"github.com/fabric8-services/fabric8-env/app"
 	"github.com/goadesign/goa"
 	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
 )
 
 type statusConfig interface {
 	DeveloperModeEnabled() bool
 	DefaultConfigError() error
+	GetStatusCheckTimeout() time.Duration
+	GetStatusCacheTTL() time.Duration
 }
 
 type StatusController struct {
 	*goa.Controller
-	dbChecker DBChecker
-	config    statusConfig
+	dbChecker    DBChecker
+	readiness    *Readiness
+	dependencies []Dependency
+	config       statusConfig
+
+	mu        sync.Mutex
+	depChecks []checkResult
+	checkedAt time.Time
 }
 
-func NewStatusController(service *goa.Service, dbChecker DBChecker, config statusConfig) *StatusController {
+func NewStatusController(service *goa.Service, dbChecker DBChecker, readiness *Readiness, config statusConfig, dependencies ...Dependency) *StatusController {
 	return &StatusController{
-		Controller: service.NewController("StatusController"),
-		dbChecker:  dbChecker,
-		config:     config,
+		Controller:   service.NewController("StatusController"),
+		dbChecker:    dbChecker,
+		readiness:    readiness,
+		dependencies: dependencies,
+		config:       config,
 	}
 }
 
@@ -39,7 +55,15 @@ func (c *StatusController) Show(ctx *app.ShowStatusContext) error {
 		res.DevMode = &devMode
 	}
 
-	dbErr := c.dbChecker.Ping()
+	// the database is checked concurrently with the dependencies
+	timeout := c.config.GetStatusCheckTimeout()
+	dbDone := make(chan checkResult, 1)
+	go func() {
+		dbDone <- runCheck(ctx, timeout, c.dbChecker.Ping)
+	}()
+	depResults := c.checkDependencies(ctx, timeout)
+
+	dbErr := (<-dbDone).err
 	if dbErr != nil {
 		log.Error(ctx, map[string]interface{}{
 			"db_error": dbErr.Error(),
@@ -59,6 +83,26 @@ func (c *StatusController) Show(ctx *app.ShowStatusContext) error {
 		res.ConfigurationStatus = "OK"
 	}
 
+	// the environments can still be read while a dependency is unhealthy, so
+	// its failures are reported but do not make the instance unavailable
+	res.Dependencies = make([]*app.DependencyStatus, len(c.dependencies))
+	for i, dep := range c.dependencies {
+		result := depResults[i]
+		status := &app.DependencyStatus{
+			Name:    dep.Name,
+			Status:  "OK",
+			Latency: int(result.latency / time.Millisecond),
+		}
+		if result.err != nil {
+			log.Error(ctx, map[string]interface{}{
+				"dependency": dep.Name,
+				"err":        result.err.Error(),
+			}, "dependency check failed")
+			status.Status = fmt.Sprintf("Error: %s", result.err.Error())
+		}
+		res.Dependencies[i] = status
+	}
+
 	if dbErr != nil || (configErr != nil && !devMode) {
 		return ctx.ServiceUnavailable(res)
 	}
@@ -66,10 +110,171 @@ func (c *StatusController) Show(ctx *app.ShowStatusContext) error {
 	return ctx.OK(res)
 }
 
-type DBChecker interface {
+// Live succeeds as long as the instance can serve requests, it does not depend
+// on the database or any other service, so their failures do not restart it.
+func (c *StatusController) Live(ctx *app.LiveStatusContext) error {
+	return ctx.OK(&app.StatusProbe{Status: "OK"})
+}
+
+// Ready fails while the instance starts up or shuts down, and while it cannot
+// serve requests because the database is unreachable or, outside of the
+// developer mode, the configuration is invalid.
+func (c *StatusController) Ready(ctx *app.ReadyStatusContext) error {
+	if err := c.readiness.Check(); err != nil {
+		return ctx.ServiceUnavailable(&app.StatusProbe{Status: fmt.Sprintf("Error: %s", err.Error())})
+	}
+	result := runCheck(ctx, c.config.GetStatusCheckTimeout(), c.dbChecker.Ping)
+	if result.err != nil {
+		log.Error(ctx, map[string]interface{}{
+			"db_error": result.err.Error(),
+		}, "instance is not ready")
+		return ctx.ServiceUnavailable(&app.StatusProbe{Status: fmt.Sprintf("Error: database: %s", result.err.Error())})
+	}
+	if configErr := c.config.DefaultConfigError(); configErr != nil && !c.config.DeveloperModeEnabled() {
+		return ctx.ServiceUnavailable(&app.StatusProbe{Status: fmt.Sprintf("Error: configuration: %s", configErr.Error())})
+	}
+	return ctx.OK(&app.StatusProbe{Status: "OK"})
+}
+
+// checkDependencies returns the results of the dependency checks, reused for
+// the cache TTL. The concurrent requests wait for the same checks.
+func (c *StatusController) checkDependencies(ctx context.Context, timeout time.Duration) []checkResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ttl := c.config.GetStatusCacheTTL()
+	if c.depChecks != nil && ttl > 0 && time.Since(c.checkedAt) < ttl {
+		return c.depChecks
+	}
+	checks := make([]func(context.Context) error, len(c.dependencies))
+	for i, dep := range c.dependencies {
+		checks[i] = dep.Checker.Check
+	}
+	c.depChecks = runChecks(ctx, timeout, checks)
+	c.checkedAt = time.Now()
+	return c.depChecks
+}
+
+type checkResult struct {
+	err     error
+	latency time.Duration
+}
+
+// runChecks runs the checks concurrently and waits for each at most for the
+// timeout, even if it does not honour the context.
+func runChecks(ctx context.Context, timeout time.Duration, checks []func(context.Context) error) []checkResult {
+	results := make([]checkResult, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func(i int, check func(context.Context) error) {
+			defer wg.Done()
+			results[i] = runCheck(ctx, timeout, check)
+		}(i, check)
+	}
+	wg.Wait()
+	return results
+}
+
+func runCheck(ctx context.Context, timeout time.Duration, check func(context.Context) error) checkResult {
+	start := time.Now()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- check(ctx)
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("no response within %s", timeout)
+	}
+	return checkResult{err: err, latency: time.Since(start)}
+}
+
+// Dependency is a service the instance depends on, reported in the status.
+type Dependency struct {
+	Name    string
+	Checker DependencyChecker
+}
+
+// DependencyChecker checks whether a service the instance depends on is healthy.
+type DependencyChecker interface {
+	Check(ctx context.Context) error
+}
+
+// HTTPChecker checks a fabric8 service by its status endpoint.
+type HTTPChecker struct {
+	statusURL string
+	client    *http.Client
+}
+
+// NewHTTPChecker returns a checker which fails unless the '/api/status'
+// endpoint of the service at serviceURL responds with a 2xx status.
+func NewHTTPChecker(serviceURL string) *HTTPChecker {
+	statusURL := ""
+	if serviceURL != "" {
+		statusURL = strings.TrimSuffix(serviceURL, "/") + "/api/status"
+	}
+	return &HTTPChecker{
+		statusURL: statusURL,
+		client:    http.DefaultClient,
+	}
+}
+
+func (c *HTTPChecker) Check(ctx context.Context) error {
+	if c.statusURL == "" {
+		return errs.New("service url is empty")
+	}
+	req, err := http.NewRequest(http.MethodGet, c.statusURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errs.Errorf("%s responded with status %d", c.statusURL, resp.StatusCode)
+	}
+	return nil
+}
+
+// ClusterChecker reports whether the requests to the Cluster service are failing.
+type ClusterChecker interface {
 	Ping() error
 }
 
+type clusterDependencyChecker struct {
+	service ClusterChecker
+	http    *HTTPChecker
+}
+
+// NewClusterChecker returns a checker which fails if the requests of the
+// service to the Cluster service at serviceURL are failing, or if its status
+// endpoint does not respond.
+func NewClusterChecker(serviceURL string, service ClusterChecker) DependencyChecker {
+	return &clusterDependencyChecker{
+		service: service,
+		http:    NewHTTPChecker(serviceURL),
+	}
+}
+
+func (c *clusterDependencyChecker) Check(ctx context.Context) error {
+	if err := c.service.Ping(); err != nil {
+		return err
+	}
+	return c.http.Check(ctx)
+}
+
+type DBChecker interface {
+	Ping(ctx context.Context) error
+}
+
 type GormDBChecker struct {
 	db *gorm.DB
 }
@@ -80,7 +285,7 @@ func NewGormDBChecker(db *gorm.DB) DBChecker {
 	}
 }
 
-func (c *GormDBChecker) Ping() error {
-	_, err := c.db.DB().Exec("select 1")
-	return err
+// Ping pings the database, it returns when the context is done at the latest.
+func (c *GormDBChecker) Ping(ctx context.Context) error {
+	return c.db.DB().PingContext(ctx)
 }
@@ -1,9 +1,14 @@
 package controller_test
 
 import (
+	"context"
 	"errors"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -30,10 +35,29 @@ type StatusControllerSuite struct {
 type testDBChecker struct {
 }
 
-func (t *testDBChecker) Ping() error {
+func (t *testDBChecker) Ping(ctx context.Context) error {
 	return errors.New("DB is unreachable")
 }
 
+// testDependencyChecker fails with err, or never responds if hang is set.
+type testDependencyChecker struct {
+	err   error
+	hang  bool
+	calls int32
+}
+
+func (t *testDependencyChecker) Check(ctx context.Context) error {
+	atomic.AddInt32(&t.calls, 1)
+	if t.hang {
+		select {}
+	}
+	return t.err
+}
+
+func (t *testDependencyChecker) Ping() error {
+	return t.err
+}
+
 func TestStatusController(t *testing.T) {
 	config, err := configuration.New("")
 	require.NoError(t, err)
@@ -44,7 +68,7 @@ func (s *StatusControllerSuite) UnSecuredController() (*goa.Service, *controller
 	config, err := configuration.New("")
 	require.NoError(s.T(), err)
 	svc := goa.New("status-test")
-	ctrl := controller.NewStatusController(svc, controller.NewGormDBChecker(s.DBTestSuite.DB), config)
+	ctrl := controller.NewStatusController(svc, controller.NewGormDBChecker(s.DBTestSuite.DB), readyReadiness(), config)
 	return svc, ctrl
 }
 
@@ -52,7 +76,7 @@ func (s *StatusControllerSuite) UnSecuredControllerWithUnreachableDB() (*goa.Ser
 	config, err := configuration.New("")
 	require.NoError(s.T(), err)
 	svc := goa.New("status-test")
-	ctrl := controller.NewStatusController(svc, &testDBChecker{}, config)
+	ctrl := controller.NewStatusController(svc, &testDBChecker{}, readyReadiness(), config)
 	return svc, ctrl
 }
 
@@ -72,6 +96,7 @@ func (s *StatusControllerSuite) TestShow() {
 		assert.Equal(t, wantDevMode, *got.DevMode)
 		assert.Equal(t, "OK", got.DatabaseStatus)
 		assert.Equal(t, wantConfigErrMsgForDevMode, got.ConfigurationStatus)
+		assert.Empty(t, got.Dependencies)
 	})
 
 	s.T().Run("ok_with_dev_mode_with_config_issue", func(t *testing.T) {
@@ -119,6 +144,127 @@ func (s *StatusControllerSuite) TestShow() {
 		assert.Equal(t, wantConfigErrMsgForDevMode, got.ConfigurationStatus)
 	})
 
+	s.T().Run("ok_with_dependency_issues", func(t *testing.T) {
+		currDevMode := os.Getenv("F8_DEVELOPER_MODE_ENABLED")
+		currTimeout := os.Getenv("F8_STATUS_CHECK_TIMEOUT")
+		defer func() {
+			os.Setenv("F8_DEVELOPER_MODE_ENABLED", currDevMode)
+			os.Setenv("F8_STATUS_CHECK_TIMEOUT", currTimeout)
+		}()
+
+		os.Setenv("F8_DEVELOPER_MODE_ENABLED", "true")
+		os.Setenv("F8_STATUS_CHECK_TIMEOUT", "50ms")
+		config, err := configuration.New("")
+		require.NoError(t, err)
+		svc := goa.New("status-test")
+		ctrl := controller.NewStatusController(svc, controller.NewGormDBChecker(s.DBTestSuite.DB), readyReadiness(), config,
+			controller.Dependency{Name: "auth", Checker: &testDependencyChecker{}},
+			controller.Dependency{Name: "cluster", Checker: &testDependencyChecker{err: errors.New("circuit breaker is open")}},
+			controller.Dependency{Name: "hung", Checker: &testDependencyChecker{hang: true}},
+		)
+
+		start := time.Now()
+		_, got := test.ShowStatusOK(t, svc.Context, svc, ctrl)
+
+		assert.True(t, time.Since(start) < time.Second, "a hung dependency must not block the status")
+		checkStatus(t, got)
+		assert.Equal(t, "OK", got.DatabaseStatus)
+		require.Len(t, got.Dependencies, 3)
+		assert.Equal(t, "auth", got.Dependencies[0].Name)
+		assert.Equal(t, "OK", got.Dependencies[0].Status)
+		assert.Equal(t, "cluster", got.Dependencies[1].Name)
+		assert.Equal(t, "Error: circuit breaker is open", got.Dependencies[1].Status)
+		assert.Equal(t, "hung", got.Dependencies[2].Name)
+		assert.Equal(t, "Error: no response within 50ms", got.Dependencies[2].Status)
+		assert.True(t, got.Dependencies[2].Latency >= 50)
+	})
+
+	s.T().Run("dependencies_cached", func(t *testing.T) {
+		currDevMode := os.Getenv("F8_DEVELOPER_MODE_ENABLED")
+		currTTL := os.Getenv("F8_STATUS_CACHE_TTL")
+		defer func() {
+			os.Setenv("F8_DEVELOPER_MODE_ENABLED", currDevMode)
+			os.Setenv("F8_STATUS_CACHE_TTL", currTTL)
+		}()
+
+		os.Setenv("F8_DEVELOPER_MODE_ENABLED", "true")
+		os.Setenv("F8_STATUS_CACHE_TTL", "1h")
+		config, err := configuration.New("")
+		require.NoError(t, err)
+		svc := goa.New("status-test")
+		auth := &testDependencyChecker{}
+		ctrl := controller.NewStatusController(svc, controller.NewGormDBChecker(s.DBTestSuite.DB), readyReadiness(), config,
+			controller.Dependency{Name: "auth", Checker: auth},
+		)
+
+		test.ShowStatusOK(t, svc.Context, svc, ctrl)
+		_, got := test.ShowStatusOK(t, svc.Context, svc, ctrl)
+
+		assert.Equal(t, int32(1), atomic.LoadInt32(&auth.calls))
+		require.Len(t, got.Dependencies, 1)
+		assert.Equal(t, "OK", got.Dependencies[0].Status)
+	})
+
+}
+
+func (s *StatusControllerSuite) TestLive() {
+	svc, ctrl := s.UnSecuredControllerWithUnreachableDB()
+
+	_, got := test.LiveStatusOK(s.T(), svc.Context, svc, ctrl)
+
+	assert.Equal(s.T(), "OK", got.Status)
+}
+
+func (s *StatusControllerSuite) TestReady() {
+	currDevMode := os.Getenv("F8_DEVELOPER_MODE_ENABLED")
+	defer os.Setenv("F8_DEVELOPER_MODE_ENABLED", currDevMode)
+	os.Setenv("F8_DEVELOPER_MODE_ENABLED", "true")
+
+	config, err := configuration.New("")
+	require.NoError(s.T(), err)
+	svc := goa.New("status-test")
+
+	s.T().Run("ok", func(t *testing.T) {
+		ctrl := controller.NewStatusController(svc, controller.NewGormDBChecker(s.DBTestSuite.DB), readyReadiness(), config)
+		_, got := test.ReadyStatusOK(t, svc.Context, svc, ctrl)
+		assert.Equal(t, "OK", got.Status)
+	})
+
+	s.T().Run("starting up", func(t *testing.T) {
+		ctrl := controller.NewStatusController(svc, controller.NewGormDBChecker(s.DBTestSuite.DB), controller.NewReadiness(), config)
+		_, got := test.ReadyStatusServiceUnavailable(t, svc.Context, svc, ctrl)
+		assert.Equal(t, "Error: instance is starting up", got.Status)
+	})
+
+	s.T().Run("shutting down", func(t *testing.T) {
+		readiness := readyReadiness()
+		readiness.SetShuttingDown()
+		readiness.SetReady()
+		ctrl := controller.NewStatusController(svc, controller.NewGormDBChecker(s.DBTestSuite.DB), readiness, config)
+		_, got := test.ReadyStatusServiceUnavailable(t, svc.Context, svc, ctrl)
+		assert.Equal(t, "Error: instance is shutting down", got.Status)
+	})
+
+	s.T().Run("db unreachable", func(t *testing.T) {
+		ctrl := controller.NewStatusController(svc, &testDBChecker{}, readyReadiness(), config)
+		_, got := test.ReadyStatusServiceUnavailable(t, svc.Context, svc, ctrl)
+		assert.Equal(t, "Error: database: DB is unreachable", got.Status)
+	})
+
+	s.T().Run("config issue", func(t *testing.T) {
+		os.Setenv("F8_DEVELOPER_MODE_ENABLED", "false")
+		config, err := configuration.New("")
+		require.NoError(t, err)
+		ctrl := controller.NewStatusController(svc, controller.NewGormDBChecker(s.DBTestSuite.DB), readyReadiness(), config)
+		_, got := test.ReadyStatusServiceUnavailable(t, svc.Context, svc, ctrl)
+		assert.Equal(t, "Error: configuration: "+strings.TrimPrefix(wantConfigErrMsgForProdMode, "Error: "), got.Status)
+	})
+}
+
+func readyReadiness() *controller.Readiness {
+	readiness := controller.NewReadiness()
+	readiness.SetReady()
+	return readiness
 }
 
 func checkStatus(t *testing.T, got *app.Status) {
@@ -128,3 +274,38 @@ func checkStatus(t *testing.T, got *app.Status) {
 	_, err := time.Parse("2006-01-02T15:04:05Z", got.StartTime)
 	assert.Nil(t, err, "Incorrect layout of StartTime")
 }
+
+func TestHTTPChecker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/status":
+			w.WriteHeader(http.StatusOK)
+		case "/unhealthy/api/status":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("ok", func(t *testing.T) {
+		assert.NoError(t, controller.NewHTTPChecker(server.URL+"/").Check(context.Background()))
+	})
+
+	t.Run("unhealthy", func(t *testing.T) {
+		err := controller.NewHTTPChecker(server.URL + "/unhealthy").Check(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "responded with status 503")
+	})
+
+	t.Run("empty url", func(t *testing.T) {
+		assert.EqualError(t, controller.NewHTTPChecker("").Check(context.Background()), "service url is empty")
+	})
+
+	t.Run("cluster circuit breaker open", func(t *testing.T) {
+		checker := controller.NewClusterChecker(server.URL, &testDependencyChecker{err: errors.New("circuit breaker is open")})
+		assert.EqualError(t, checker.Check(context.Background()), "circuit breaker is open")
+		checker = controller.NewClusterChecker(server.URL, &testDependencyChecker{})
+		assert.NoError(t, checker.Check(context.Background()))
+	})
+}
@@ -0,0 +1,185 @@
+package controller
+
+import (
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-common/httpsupport"
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/fabric8-services/fabric8-env/app"
+	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/envtemplate"
+	"github.com/goadesign/goa"
+	errs "github.com/pkg/errors"
+)
+
+const (
+	APIStringTypeTemplate = "templates"
+)
+
+type templateConfig interface {
+	GetAdminServiceAccounts() []string
+}
+
+// TemplateController manages the environment templates. The templates are shared
+// by all the spaces, so only the admin service accounts can change them.
+type TemplateController struct {
+	*goa.Controller
+	db     application.DB
+	config templateConfig
+}
+
+func NewTemplateController(service *goa.Service, db application.DB, config templateConfig) *TemplateController {
+	return &TemplateController{
+		Controller: service.NewController("TemplateController"),
+		db:         db,
+		config:     config,
+	}
+}
+
+func ConvertTemplate(tmpl *envtemplate.Template) *app.Template {
+	envs := make([]*app.TemplateEnvironment, len(tmpl.Environments))
+	for ind, item := range tmpl.Environments {
+		envs[ind] = &app.TemplateEnvironment{
+			Name:          item.Name,
+			Type:          item.Type,
+			NamespaceName: item.NamespaceName,
+			ClusterURL:    item.ClusterURL,
+		}
+	}
+	return &app.Template{
+		ID:   tmpl.ID,
+		Type: APIStringTypeTemplate,
+		Attributes: &app.TemplateAttributes{
+			Name:         *tmpl.Name,
+			Description:  tmpl.Description,
+			Environments: envs,
+		},
+	}
+}
+
+func ConvertTemplates(tmpls []*envtemplate.Template) *app.TemplatesList {
+	res := &app.TemplatesList{Data: make([]*app.Template, len(tmpls))}
+	for ind, tmpl := range tmpls {
+		res.Data[ind] = ConvertTemplate(tmpl)
+	}
+	return res
+}
+
+func convertTemplateAttributes(attrs *app.TemplateAttributes) *envtemplate.Template {
+	items := make(envtemplate.Items, 0, len(attrs.Environments))
+	for _, env := range attrs.Environments {
+		if env == nil {
+			continue
+		}
+		items = append(items, envtemplate.Item{
+			Name:          env.Name,
+			Type:          env.Type,
+			NamespaceName: env.NamespaceName,
+			ClusterURL:    env.ClusterURL,
+		})
+	}
+	name := attrs.Name
+	return &envtemplate.Template{
+		Name:         &name,
+		Description:  attrs.Description,
+		Environments: items,
+	}
+}
+
+func (c *TemplateController) Create(ctx *app.CreateTemplateContext) error {
+	err := requireServiceAccount(ctx, c.config.GetAdminServiceAccounts())
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	reqTmpl := ctx.Payload.Data
+	if reqTmpl == nil {
+		return app.JSONErrorResponse(ctx, errors.NewBadParameterError("data", nil).Expected("not nil"))
+	}
+
+	newTmpl := convertTemplateAttributes(reqTmpl.Attributes)
+	if verrs := validateTemplate(newTmpl); len(verrs) > 0 {
+		return ctx.BadRequest(verrs.JSONAPIErrors())
+	}
+
+	var tmpl *envtemplate.Template
+	err = application.Transactional(ctx, c.db, func(appl application.Application) error {
+		var err error
+		tmpl, err = appl.Templates().Create(ctx, newTmpl)
+		if err != nil {
+			log.Error(ctx, map[string]interface{}{"err": err},
+				"failed to create template: %s", *newTmpl.Name)
+			return errs.Wrapf(err, "failed to create template: %s", *newTmpl.Name)
+		}
+		return nil
+	})
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	res := &app.TemplateSingle{
+		Data: ConvertTemplate(tmpl),
+	}
+	ctx.ResponseData.Header().Set("Location", httpsupport.AbsoluteURL(&goa.RequestData{Request: ctx.Request},
+		app.TemplateHref(res.Data.ID), nil))
+	return ctx.Created(res)
+}
+
+func (c *TemplateController) List(ctx *app.ListTemplateContext) error {
+	tmpls, err := c.db.Templates().List(ctx)
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+	return ctx.OK(ConvertTemplates(tmpls))
+}
+
+func (c *TemplateController) Show(ctx *app.ShowTemplateContext) error {
+	tmpl, err := c.db.Templates().Load(ctx, ctx.TemplateID)
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+	return ctx.OK(&app.TemplateSingle{Data: ConvertTemplate(tmpl)})
+}
+
+func (c *TemplateController) Update(ctx *app.UpdateTemplateContext) error {
+	err := requireServiceAccount(ctx, c.config.GetAdminServiceAccounts())
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	reqTmpl := ctx.Payload.Data
+	if reqTmpl == nil {
+		return app.JSONErrorResponse(ctx, errors.NewBadParameterError("data", nil).Expected("not nil"))
+	}
+
+	updTmpl := convertTemplateAttributes(reqTmpl.Attributes)
+	updTmpl.ID = &ctx.TemplateID
+	if verrs := validateTemplate(updTmpl); len(verrs) > 0 {
+		return ctx.BadRequest(verrs.JSONAPIErrors())
+	}
+
+	var tmpl *envtemplate.Template
+	err = application.Transactional(ctx, c.db, func(appl application.Application) error {
+		var err error
+		tmpl, err = appl.Templates().Save(ctx, updTmpl)
+		return err
+	})
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+	return ctx.OK(&app.TemplateSingle{Data: ConvertTemplate(tmpl)})
+}
+
+func (c *TemplateController) Delete(ctx *app.DeleteTemplateContext) error {
+	err := requireServiceAccount(ctx, c.config.GetAdminServiceAccounts())
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+
+	err = application.Transactional(ctx, c.db, func(appl application.Application) error {
+		return appl.Templates().Delete(ctx, ctx.TemplateID)
+	})
+	if err != nil {
+		return app.JSONErrorResponse(ctx, err)
+	}
+	return ctx.NoContent()
+}
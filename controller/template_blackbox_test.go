@@ -0,0 +1,231 @@
+package controller_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-common/convert/ptr"
+	testauth "github.com/fabric8-services/fabric8-common/test/auth"
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/app"
+	"github.com/fabric8-services/fabric8-env/app/test"
+	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/configuration"
+	"github.com/fabric8-services/fabric8-env/controller"
+	"github.com/fabric8-services/fabric8-env/envtemplate"
+	"github.com/fabric8-services/fabric8-env/gormapp"
+	"github.com/goadesign/goa"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type TemplateControllerSuite struct {
+	testsuite.DBTestSuite
+	db application.DB
+
+	svc      *goa.Service
+	ctx      context.Context
+	adminCtx context.Context
+	ctrl     *controller.TemplateController
+	envCtrl  *controller.EnvironmentController
+}
+
+func TestTemplateController(t *testing.T) {
+	config, err := configuration.New("")
+	require.NoError(t, err)
+	suite.Run(t, &TemplateControllerSuite{DBTestSuite: testsuite.NewDBTestSuite(config)})
+}
+
+func (s *TemplateControllerSuite) SetupSuite() {
+	s.DBTestSuite.SetupSuite()
+	s.setup(gormapp.NewGormDB(s.DB))
+}
+
+func (s *TemplateControllerSuite) setup(db application.DB) {
+	s.db = db
+
+	svc := testauth.UnsecuredService("template-test")
+	s.svc = svc
+	s.ctx = s.svc.Context
+	s.adminCtx = contextWithServiceAccount("fabric8-ops")
+	s.ctrl = controller.NewTemplateController(s.svc, s.db, &testAdminConfig{})
+	config, err := configuration.New("")
+	require.NoError(s.T(), err)
+	s.envCtrl = controller.NewEnvironmentController(s.svc, s.db, &testAuthService{}, &testClusterService{}, &testClusterService{}, config)
+}
+
+func (s *TemplateControllerSuite) TestCreate() {
+	s.T().Run("ok", func(t *testing.T) {
+		payload := newCreateTemplatePayload("create-" + uuid.NewV4().String())
+
+		_, newTmpl := test.CreateTemplateCreated(t, s.adminCtx, s.svc, s.ctrl, payload)
+		require.NotNil(t, newTmpl)
+		require.NotNil(t, newTmpl.Data.ID)
+
+		_, tmpl := test.ShowTemplateOK(t, s.ctx, s.svc, s.ctrl, *newTmpl.Data.ID)
+		require.NotNil(t, tmpl)
+		assert.Equal(t, payload.Data.Attributes.Name, tmpl.Data.Attributes.Name)
+		assert.Len(t, tmpl.Data.Attributes.Environments, 2)
+	})
+
+	s.T().Run("not_admin", func(t *testing.T) {
+		payload := newCreateTemplatePayload("not-admin-" + uuid.NewV4().String())
+		_, err := test.CreateTemplateForbidden(t, s.ctx, s.svc, s.ctrl, payload)
+		assert.NotNil(t, err)
+		_, err = test.CreateTemplateForbidden(t, contextWithServiceAccount("fabric8-tenant"), s.svc, s.ctrl, payload)
+		assert.NotNil(t, err)
+	})
+
+	s.T().Run("invalid_environment", func(t *testing.T) {
+		payload := newCreateTemplatePayload("invalid-" + uuid.NewV4().String())
+		payload.Data.Attributes.Environments[1].NamespaceName = ptr.String("Invalid_{type}")
+
+		_, jerrs := test.CreateTemplateBadRequest(t, s.adminCtx, s.svc, s.ctrl, payload)
+		require.NotNil(t, jerrs)
+		require.Len(t, jerrs.Errors, 1)
+		assert.Nil(t, jerrs.Errors[0].Source["parameter"])
+		assert.Equal(t, "/data/attributes/environments/1/namespace-name", jerrs.Errors[0].Source["pointer"])
+	})
+
+	s.T().Run("conflict", func(t *testing.T) {
+		payload := newCreateTemplatePayload("conflict-" + uuid.NewV4().String())
+		test.CreateTemplateCreated(t, s.adminCtx, s.svc, s.ctrl, payload)
+
+		_, err := test.CreateTemplateConflict(t, s.adminCtx, s.svc, s.ctrl, payload)
+		assert.NotNil(t, err)
+	})
+}
+
+func (s *TemplateControllerSuite) TestList() {
+	payload := newCreateTemplatePayload("list-" + uuid.NewV4().String())
+	_, newTmpl := test.CreateTemplateCreated(s.T(), s.adminCtx, s.svc, s.ctrl, payload)
+	require.NotNil(s.T(), newTmpl)
+
+	_, list := test.ListTemplateOK(s.T(), s.ctx, s.svc, s.ctrl)
+	require.NotNil(s.T(), list)
+	found := false
+	for _, tmpl := range list.Data {
+		if *tmpl.ID == *newTmpl.Data.ID {
+			found = true
+		}
+	}
+	assert.True(s.T(), found)
+}
+
+func (s *TemplateControllerSuite) TestUpdateAndDelete() {
+	payload := newCreateTemplatePayload("update-" + uuid.NewV4().String())
+	_, newTmpl := test.CreateTemplateCreated(s.T(), s.adminCtx, s.svc, s.ctrl, payload)
+	require.NotNil(s.T(), newTmpl)
+	tmplID := *newTmpl.Data.ID
+
+	s.T().Run("update_ok", func(t *testing.T) {
+		update := &app.UpdateTemplatePayload{Data: payload.Data}
+		update.Data.Attributes.Description = ptr.String("updated")
+		_, tmpl := test.UpdateTemplateOK(t, s.adminCtx, s.svc, s.ctrl, tmplID, update)
+		require.NotNil(t, tmpl)
+		assert.Equal(t, "updated", *tmpl.Data.Attributes.Description)
+	})
+
+	s.T().Run("update_invalid_environment", func(t *testing.T) {
+		update := newCreateTemplatePayload(payload.Data.Attributes.Name)
+		update.Data.Attributes.Environments[0].Type = "prod"
+		_, jerrs := test.UpdateTemplateBadRequest(t, s.adminCtx, s.svc, s.ctrl, tmplID, &app.UpdateTemplatePayload{Data: update.Data})
+		require.NotNil(t, jerrs)
+		require.Len(t, jerrs.Errors, 1)
+		assert.Equal(t, "/data/attributes/environments/0/type", jerrs.Errors[0].Source["pointer"])
+
+		_, tmpl := test.ShowTemplateOK(t, s.ctx, s.svc, s.ctrl, tmplID)
+		assert.Equal(t, "stage", tmpl.Data.Attributes.Environments[0].Type)
+	})
+
+	s.T().Run("not_admin", func(t *testing.T) {
+		update := &app.UpdateTemplatePayload{Data: payload.Data}
+		_, err := test.UpdateTemplateForbidden(t, s.ctx, s.svc, s.ctrl, tmplID, update)
+		assert.NotNil(t, err)
+		_, err = test.DeleteTemplateForbidden(t, s.ctx, s.svc, s.ctrl, tmplID)
+		assert.NotNil(t, err)
+		test.ShowTemplateOK(t, s.ctx, s.svc, s.ctrl, tmplID)
+	})
+
+	s.T().Run("delete_ok", func(t *testing.T) {
+		test.DeleteTemplateNoContent(t, s.adminCtx, s.svc, s.ctrl, tmplID)
+		test.ShowTemplateNotFound(t, s.ctx, s.svc, s.ctrl, tmplID)
+	})
+
+	s.T().Run("delete_not_found", func(t *testing.T) {
+		test.DeleteTemplateNotFound(t, s.adminCtx, s.svc, s.ctrl, uuid.NewV4())
+	})
+}
+
+func (s *TemplateControllerSuite) TestCreateEnvironmentsFromTemplate() {
+	name := "standard-pipeline-" + uuid.NewV4().String()
+	test.CreateTemplateCreated(s.T(), s.adminCtx, s.svc, s.ctrl, newCreateTemplatePayload(name))
+
+	s.T().Run("ok", func(t *testing.T) {
+		spaceID := uuid.NewV4()
+		_, list := test.CreateFromTemplateEnvironmentCreated(t, s.ctx, s.svc, s.envCtrl, spaceID, name, nil)
+		require.NotNil(t, list)
+		require.Len(t, list.Data, 2)
+		assert.Equal(t, "stage", list.Data[0].Attributes.Type)
+		assert.Equal(t, spaceID.String()+"-stage", *list.Data[0].Attributes.NamespaceName)
+		assert.Equal(t, spaceID.String()+"-run", *list.Data[1].Attributes.NamespaceName)
+
+		_, envs := test.ListEnvironmentOK(t, s.ctx, s.svc, s.envCtrl, spaceID)
+		assert.Len(t, envs.Data, 2)
+	})
+
+	s.T().Run("template_not_found", func(t *testing.T) {
+		_, err := test.CreateFromTemplateEnvironmentNotFound(t, s.ctx, s.svc, s.envCtrl, uuid.NewV4(), "unknown", nil)
+		assert.NotNil(t, err)
+	})
+
+	s.T().Run("invalid_item", func(t *testing.T) {
+		// stored before the templates were validated on save
+		name := "invalid-" + uuid.NewV4().String()
+		_, err := s.db.Templates().Create(s.ctx, &envtemplate.Template{
+			Name: &name,
+			Environments: envtemplate.Items{
+				{Name: "{space}-{type}", Type: "stage", ClusterURL: "cluster1.com"},
+				{Name: "{space}-{type}", Type: "run", ClusterURL: "cluster1.com", NamespaceName: ptr.String("Invalid_{type}")},
+			},
+		})
+		require.NoError(t, err)
+
+		_, jerrs := test.CreateFromTemplateEnvironmentBadRequest(t, s.ctx, s.svc, s.envCtrl, uuid.NewV4(), name, nil)
+		require.NotNil(t, jerrs)
+		require.Len(t, jerrs.Errors, 1)
+		assert.Equal(t, "template", jerrs.Errors[0].Source["parameter"])
+		assert.Equal(t, "/data/attributes/environments/1/namespace-name", jerrs.Errors[0].Source["pointer"])
+	})
+
+	s.T().Run("cluster_not_linked", func(t *testing.T) {
+		payload := newCreateTemplatePayload("unlinked-" + uuid.NewV4().String())
+		payload.Data.Attributes.Environments[1].ClusterURL = "cluster2.com"
+		test.CreateTemplateCreated(t, s.adminCtx, s.svc, s.ctrl, payload)
+
+		spaceID := uuid.NewV4()
+		_, err := test.CreateFromTemplateEnvironmentForbidden(t, s.ctx, s.svc, s.envCtrl, spaceID, payload.Data.Attributes.Name, nil)
+		assert.NotNil(t, err)
+
+		// nothing is created when one of the environments fails
+		_, envs := test.ListEnvironmentOK(t, s.ctx, s.svc, s.envCtrl, spaceID)
+		assert.Empty(t, envs.Data)
+	})
+}
+
+func newCreateTemplatePayload(name string) *app.CreateTemplatePayload {
+	return &app.CreateTemplatePayload{
+		Data: &app.Template{
+			Type: "templates",
+			Attributes: &app.TemplateAttributes{
+				Name: name,
+				Environments: []*app.TemplateEnvironment{
+					{Name: "{space}-{type}", Type: "stage", ClusterURL: "cluster1.com", NamespaceName: ptr.String("{space}-{type}")},
+					{Name: "{space}-{type}", Type: "run", ClusterURL: "cluster1.com", NamespaceName: ptr.String("{space}-{type}")},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,47 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-env/authz"
+)
+
+func usernameFromContext(ctx context.Context) string {
+	return authz.TokenClaim(ctx, "preferred_username")
+}
+
+// serviceAccountName returns the name of the service account the token in the
+// context was issued for, or an empty string for user tokens.
+func serviceAccountName(ctx context.Context) string {
+	return authz.ServiceAccountName(ctx)
+}
+
+// requireServiceAccount checks that the caller uses a token of one of the given
+// service accounts.
+func requireServiceAccount(ctx context.Context, accounts []string) error {
+	name := serviceAccountName(ctx)
+	if name == "" {
+		return errors.NewForbiddenError("service account token required")
+	}
+	for _, account := range accounts {
+		if account == name {
+			return nil
+		}
+	}
+	return errors.NewForbiddenError("service account '" + name + "' is not allowed")
+}
+
+// actorFromContext returns the name recorded in the audit log for the caller.
+func actorFromContext(ctx context.Context) string {
+	if name := serviceAccountName(ctx); name != "" {
+		return "service-account:" + name
+	}
+	if name := usernameFromContext(ctx); name != "" {
+		return name
+	}
+	if sub := authz.Subject(ctx); sub != "" {
+		return sub
+	}
+	return "unknown"
+}
@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fabric8-services/fabric8-common/convert/ptr"
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-env/app"
+	"github.com/fabric8-services/fabric8-env/environment"
+	"github.com/fabric8-services/fabric8-env/envtemplate"
+	uuid "github.com/satori/go.uuid"
+)
+
+// EnvironmentNameMaxLength is the maximum length of an environment name.
+const EnvironmentNameMaxLength = 63
+
+var envTypes = []string{"dev", "build", "stage", "run"}
+
+// FieldError is a problem with a single attribute of the request document.
+type FieldError struct {
+	// Parameter is the query parameter naming the document of the attribute when it
+	// is not in the request document, e.g. "template".
+	Parameter string
+	// Pointer is a JSON Pointer [RFC6901] to the attribute, e.g. "/data/attributes/name".
+	Pointer string
+	Detail  string
+}
+
+// ValidationErrors collects all the problems found in a request document so they
+// can be reported together.
+type ValidationErrors []FieldError
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for ind, fe := range e {
+		msgs[ind] = fmt.Sprintf("%s: %s", fe.Pointer, fe.Detail)
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationErrors) add(pointer, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Pointer: pointer, Detail: fmt.Sprintf(format, args...)})
+}
+
+// JSONAPIErrors converts the problems to JSONAPI error objects with the
+// source.pointer set to the offending attribute.
+func (e ValidationErrors) JSONAPIErrors() *app.JSONAPIErrors {
+	res := &app.JSONAPIErrors{Errors: make([]*app.JSONAPIError, len(e))}
+	for ind, fe := range e {
+		source := map[string]interface{}{"pointer": fe.Pointer}
+		if fe.Parameter != "" {
+			source["parameter"] = fe.Parameter
+		}
+		res.Errors[ind] = &app.JSONAPIError{
+			Status: ptr.String(strconv.Itoa(http.StatusBadRequest)),
+			Code:   ptr.String("invalid_attribute"),
+			Title:  ptr.String("Invalid attribute"),
+			Detail: fe.Detail,
+			Source: source,
+		}
+	}
+	return res
+}
+
+// ValidateEnvironmentTypes checks that all the given types are environment types,
+// e.g. the configured types of the default environments of a space.
+func ValidateEnvironmentTypes(types []string) error {
+	for _, envType := range types {
+		if !isEnvironmentType(envType) {
+			return errors.NewBadParameterError("type", envType).Expected("one of " + strings.Join(envTypes, ", "))
+		}
+	}
+	return nil
+}
+
+func isEnvironmentType(envType string) bool {
+	for _, t := range envTypes {
+		if envType == t {
+			return true
+		}
+	}
+	return false
+}
+
+// validateEnvironmentAttributes checks all the attributes of an environment and
+// returns every problem found. The pointer is the location of the attributes in the
+// request document.
+func validateEnvironmentAttributes(attrs *app.EnvironmentAttributes, pointer string) ValidationErrors {
+	var verrs ValidationErrors
+	if attrs == nil {
+		verrs.add(pointer, "attributes are required")
+		return verrs
+	}
+
+	verrs = append(verrs, validateEnvironmentName(attrs.Name, pointer+"/name")...)
+
+	if !isEnvironmentType(attrs.Type) {
+		verrs.add(pointer+"/type", "type must be one of %s", strings.Join(envTypes, ", "))
+	}
+
+	if strings.TrimSpace(attrs.ClusterURL) == "" {
+		verrs.add(pointer+"/cluster-url", "cluster-url must not be empty")
+	}
+
+	verrs = append(verrs, validateExpiry(attrs.ExpiresAt, attrs.TTL, pointer, time.Now())...)
+
+	if attrs.NamespaceName != nil {
+		if err := environment.ValidateNamespaceName(*attrs.NamespaceName); err != nil {
+			verrs.add(pointer+"/namespaceName", "namespaceName must be a DNS-1123 label: at most %d lowercase alphanumeric characters or '-', starting and ending with an alphanumeric character", environment.NamespaceNameMaxLength)
+		}
+	}
+	return verrs
+}
+
+// validateTemplate checks the environments of the template, expanded for an
+// example space and user. The environments are checked again with the actual space
+// and user when they are created from the template.
+func validateTemplate(tmpl *envtemplate.Template) ValidationErrors {
+	var verrs ValidationErrors
+	for ind, item := range tmpl.Expand(uuid.NewV4(), "user") {
+		verrs = append(verrs, validateTemplateItem(templateItemAttributes(item), ind, "")...)
+	}
+	return verrs
+}
+
+// validateTemplateItem checks the attributes of the ind-th environment of a
+// template. The pointers locate the item in the template document, the parameter
+// names the request parameter giving the template, if it is not the request document.
+func validateTemplateItem(attrs *app.EnvironmentAttributes, ind int, parameter string) ValidationErrors {
+	pointer := fmt.Sprintf("/data/attributes/environments/%d", ind)
+	verrs := validateEnvironmentAttributes(attrs, pointer)
+	for i := range verrs {
+		verrs[i].Parameter = parameter
+		// the templates use kebab-case keys
+		verrs[i].Pointer = strings.Replace(verrs[i].Pointer, "/namespaceName", "/namespace-name", 1)
+	}
+	return verrs
+}
+
+func templateItemAttributes(item envtemplate.Item) *app.EnvironmentAttributes {
+	return &app.EnvironmentAttributes{
+		Name:          item.Name,
+		Type:          item.Type,
+		NamespaceName: item.NamespaceName,
+		ClusterURL:    item.ClusterURL,
+	}
+}
+
+// validateEnvironmentUpdateAttributes checks the attributes of an environment update.
+func validateEnvironmentUpdateAttributes(attrs *app.EnvironmentUpdateAttributes, pointer string) ValidationErrors {
+	var verrs ValidationErrors
+	if attrs.Name != nil {
+		verrs = append(verrs, validateEnvironmentName(*attrs.Name, pointer+"/name")...)
+	}
+	if attrs.TTL != nil && *attrs.TTL == 0 && attrs.ExpiresAt == nil {
+		// a ttl of 0 clears the expiry
+		return verrs
+	}
+	return append(verrs, validateExpiry(attrs.ExpiresAt, attrs.TTL, pointer, time.Now())...)
+}
+
+func validateEnvironmentName(name, pointer string) ValidationErrors {
+	var verrs ValidationErrors
+	trimmed := strings.TrimSpace(name)
+	switch {
+	case trimmed == "":
+		verrs.add(pointer, "name must not be empty")
+	case trimmed != name:
+		verrs.add(pointer, "name must not start or end with whitespace")
+	}
+	if utf8.RuneCountInString(name) > EnvironmentNameMaxLength {
+		verrs.add(pointer, "name must have at most %d characters", EnvironmentNameMaxLength)
+	}
+	return verrs
+}
+
+func validateExpiry(expiresAt *time.Time, ttl *int, pointer string, now time.Time) ValidationErrors {
+	var verrs ValidationErrors
+	if expiresAt != nil && ttl != nil {
+		verrs.add(pointer+"/ttl", "only one of expires-at and ttl may be set")
+	}
+	if ttl != nil && *ttl <= 0 {
+		verrs.add(pointer+"/ttl", "ttl must be a positive number of seconds")
+	}
+	if expiresAt != nil && !expiresAt.After(now) {
+		verrs.add(pointer+"/expires-at", "expires-at must be in the future")
+	}
+	return verrs
+}
+
+// expiryTime returns the expiry time set by either expires-at or ttl, or nil if
+// none is set.
+func expiryTime(expiresAt *time.Time, ttl *int, now time.Time) *time.Time {
+	if ttl != nil {
+		t := now.Add(time.Duration(*ttl) * time.Second)
+		return &t
+	}
+	return expiresAt
+}
@@ -0,0 +1,162 @@
+package design
+
+import (
+	d "github.com/goadesign/goa/design"
+	a "github.com/goadesign/goa/design/apidsl"
+)
+
+var clusterMoveAttrs = a.Type("ClusterMoveAttributes", func() {
+	a.Description(`JSONAPI store for all the "attributes" of a cluster move.`)
+	a.Attribute("old-cluster-url", d.String, "The url of the retired cluster", func() {
+		a.Example("https://api.starter-us-east-2.openshift.com")
+	})
+	a.Attribute("new-cluster-url", d.String, "The url of the cluster the environments are moved to", func() {
+		a.Example("https://api.starter-us-east-2a.openshift.com")
+	})
+	a.Attribute("dry-run", d.Boolean, "If true, only the affected environments are listed")
+	a.Required("old-cluster-url", "new-cluster-url")
+})
+
+var clusterMove = a.Type("ClusterMove", func() {
+	a.Description(`JSONAPI store for data of a cluster move.`)
+	a.Attribute("type", d.String, func() {
+		a.Enum("cluster-moves")
+	})
+	a.Attribute("attributes", clusterMoveAttrs)
+	a.Required("type", "attributes")
+})
+
+var clusterMoveSingle = JSONSingle(
+	"ClusterMove", "Holds a cluster move request",
+	clusterMove,
+	nil)
+
+var spaceQuotaAttrs = a.Type("SpaceQuotaAttributes", func() {
+	a.Description(`JSONAPI store for all the "attributes" of a space quota.`)
+	a.Attribute("max-environments", d.Integer, "The maximum number of environments of the space, -1 if unlimited", func() {
+		a.Example(50)
+	})
+	a.Attribute("default", d.Boolean, "True if the space uses the default quota")
+	a.Required("max-environments")
+})
+
+var spaceQuota = a.Type("SpaceQuota", func() {
+	a.Description(`JSONAPI store for data of a space quota.`)
+	a.Attribute("type", d.String, func() {
+		a.Enum("space-quotas")
+	})
+	a.Attribute("id", d.UUID, "ID of the space", func() {
+		a.Example("40bbdd3d-8b5d-4fd6-ac90-7236b669af04")
+	})
+	a.Attribute("attributes", spaceQuotaAttrs)
+	a.Required("type", "attributes")
+})
+
+var spaceQuotaSingle = JSONSingle(
+	"SpaceQuota", "Holds the environment quota of a space",
+	spaceQuota,
+	nil)
+
+var _ = a.Resource("admin", func() {
+	a.BasePath("/admin")
+
+	a.Action("moveCluster", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST("/environments/move-cluster"),
+		)
+		a.Description(`Repoint all environments from one cluster to another. Only allowed for admin
+service accounts. Returns the affected environments, locked environments are left unchanged
+and listed in the skipped meta attribute.`)
+		a.Payload(clusterMoveSingle)
+		a.Response(d.OK, envList)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.Conflict, JSONAPIErrors)
+	})
+
+	a.Action("listEnvironments", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/environments"),
+		)
+		a.Description(`List the environments of all spaces. Only allowed for admin service accounts.
+With format=csv the environments are exported as a CSV file, all matching environments
+unless page[limit] is set.`)
+		a.Params(func() {
+			a.Param("cluster", d.String, "Only environments on the cluster with this URL")
+			a.Param("type", d.String, "Only environments of this type", func() {
+				a.Enum("dev", "build", "stage", "run")
+			})
+			a.Param("created-after", d.DateTime, "Only environments created at or after this time")
+			a.Param("created-before", d.DateTime, "Only environments created before this time")
+			a.Param("page[offset]", d.Integer, "Paging offset", func() {
+				a.Minimum(0)
+			})
+			a.Param("page[limit]", d.Integer, "Paging size, at most 1000", func() {
+				a.Minimum(1)
+				a.Maximum(1000)
+			})
+			a.Param("format", d.String, "Format of the response", func() {
+				a.Enum("json", "csv")
+				a.Default("json")
+			})
+		})
+		a.Response(d.OK, envList)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+	})
+
+	a.Action("showSpaceQuota", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/spaces/:spaceID/quota"),
+		)
+		a.Description("Show the maximum number of environments of a space.")
+		a.Params(func() {
+			a.Param("spaceID", d.UUID, "ID of the space")
+		})
+		a.Response(d.OK, spaceQuotaSingle)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+	})
+
+	a.Action("setSpaceQuota", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.PUT("/spaces/:spaceID/quota"),
+		)
+		a.Description("Override the maximum number of environments of a space.")
+		a.Params(func() {
+			a.Param("spaceID", d.UUID, "ID of the space")
+		})
+		a.Payload(spaceQuotaSingle)
+		a.Response(d.OK, spaceQuotaSingle)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+	})
+
+	a.Action("deleteSpaceQuota", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.DELETE("/spaces/:spaceID/quota"),
+		)
+		a.Description("Remove the override, the space uses the default quota again.")
+		a.Params(func() {
+			a.Param("spaceID", d.UUID, "ID of the space")
+		})
+		a.Response(d.NoContent)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+	})
+})
@@ -32,9 +32,82 @@ var envAttrs = a.Type("EnvironmentAttributes", func() {
 	a.Attribute("cluster-url", d.String, "The cluster url", func() {
 		a.Example("https://api.starter-us-east-2a.openshift.com")
 	})
+	a.Attribute("expires-at", d.DateTime, "The time after which the environment is deleted automatically")
+	a.Attribute("ttl", d.Integer, "Time to live in seconds, sets expires-at relative to now", func() {
+		a.Example(86400)
+	})
+	a.Attribute("protected", d.Boolean, "Protected environments can't be deleted without an override, 'run' environments are protected by default")
+	a.Attribute("lock", envLock, "The active lock of the environment, read-only")
+	a.Attribute("space-id", d.UUID, "ID of the space of the environment, read-only")
+	a.Attribute("created-at", d.DateTime, "The creation time of the environment, read-only")
 	a.Required("name", "type", "cluster-url")
 })
 
+var envLock = a.Type("EnvironmentLock", func() {
+	a.Description(`JSONAPI store for the lock of an environment. Mutating calls on a locked
+environment are rejected unless overridden.`)
+	a.Attribute("reason", d.String, "Why the environment is locked", func() {
+		a.Example("release freeze")
+	})
+	a.Attribute("locked-by", d.String, "Who locked the environment")
+	a.Attribute("locked-at", d.DateTime, "When the environment was locked")
+	a.Attribute("expires-at", d.DateTime, "When the lock expires, never if not set")
+	a.Required("reason")
+})
+
+var envLockRequest = a.Type("EnvironmentLockRequest", func() {
+	a.Description(`JSONAPI store for data of an environment lock request.`)
+	a.Attribute("type", d.String, func() {
+		a.Enum("environment-locks")
+	})
+	a.Attribute("attributes", envLock)
+	a.Required("type", "attributes")
+})
+
+var envUpdateAttrs = a.Type("EnvironmentUpdateAttributes", func() {
+	a.Description(`JSONAPI store for the "attributes" of environment which can be updated.`)
+	a.Attribute("name", d.String, "The environment name", func() {
+		a.Example("myapp-stage")
+	})
+	a.Attribute("expires-at", d.DateTime, "The time after which the environment is deleted automatically")
+	a.Attribute("ttl", d.Integer, "Time to live in seconds, sets expires-at relative to now, 0 clears the expiry", func() {
+		a.Example(86400)
+	})
+	a.Attribute("protected", d.Boolean, "Protected environments can't be deleted without an override")
+})
+
+var envUpdate = a.Type("EnvironmentUpdate", func() {
+	a.Description(`JSONAPI store for data of an environment update.`)
+	a.Attribute("type", d.String, func() {
+		a.Enum("environments")
+	})
+	a.Attribute("attributes", envUpdateAttrs)
+	a.Required("type", "attributes")
+})
+
+var envCloneAttrs = a.Type("EnvironmentCloneAttributes", func() {
+	a.Description(`JSONAPI store for the overrides applied when cloning an environment.`)
+	a.Attribute("space-id", d.UUID, "ID of the target space, defaults to the space of the source environment")
+	a.Attribute("cluster-url", d.String, "The target cluster url, defaults to the cluster of the source environment", func() {
+		a.Example("https://api.starter-us-east-2a.openshift.com")
+	})
+	a.Attribute("name", d.String, "The name of the clone, defaults to the name of the source environment", func() {
+		a.Example("myfork-stage")
+	})
+	a.Attribute("namespaceName", d.String, "The namespace name of the clone, generated for the target space and cluster if not set", func() {
+		a.Example("myfork-stage")
+	})
+})
+
+var envClone = a.Type("EnvironmentClone", func() {
+	a.Description(`JSONAPI store for data of an environment clone request.`)
+	a.Attribute("type", d.String, func() {
+		a.Enum("environments")
+	})
+	a.Attribute("attributes", envCloneAttrs)
+	a.Required("type")
+})
+
 // var envRelationships = a.Type("EnvironmentRelations", func() {
 // a.Attribute("space", relationGeneric, "Environment associated with one space")
 // TODO for type
@@ -42,6 +115,7 @@ var envAttrs = a.Type("EnvironmentAttributes", func() {
 
 var envListMeta = a.Type("EnvironmentListMeta", func() {
 	a.Attribute("totalCount", d.Integer)
+	a.Attribute("skipped", a.ArrayOf(d.UUID), "IDs of the locked environments left unchanged by a cluster move")
 	a.Required("totalCount")
 })
 
@@ -56,6 +130,21 @@ var envSingle = JSONSingle(
 	env,
 	nil)
 
+var envCloneSingle = JSONSingle(
+	"EnvironmentClone", "Holds the overrides of an environment clone",
+	envClone,
+	nil)
+
+var envUpdateSingle = JSONSingle(
+	"EnvironmentUpdate", "Holds the updated attributes of an environment",
+	envUpdate,
+	nil)
+
+var envLockSingle = JSONSingle(
+	"EnvironmentLock", "Holds an environment lock request",
+	envLockRequest,
+	nil)
+
 var _ = a.Resource("environment", func() {
 
 	a.Action("list", func() {
@@ -79,17 +168,45 @@ var _ = a.Resource("environment", func() {
 		a.Routing(
 			a.POST("/spaces/:spaceID/environments"),
 		)
-		a.Description("Create environment")
+		a.Description(`Create environment. A retried request with the same Idempotency-Key
+header gets the original response replayed.`)
 		a.Params(func() {
 			a.Param("spaceID", d.UUID, "ID of the space")
 		})
+		idempotencyKeyHeader()
 		a.Payload(envSingle)
 		a.Response(d.Created, envSingle)
 		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
 		a.Response(d.InternalServerError, JSONAPIErrors)
 		a.Response(d.Unauthorized, JSONAPIErrors)
 		a.Response(d.Forbidden, JSONAPIErrors)
 		a.Response(d.MethodNotAllowed, JSONAPIErrors)
+		a.Response(d.Conflict, JSONAPIErrors)
+		a.Response(d.UnprocessableEntity, JSONAPIErrors)
+	})
+
+	a.Action("createFromTemplate", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST("/spaces/:spaceID/environments/from-template/:template"),
+		)
+		a.Description(`Create all the environments of the named template and return the list
+of created environments. A retried request with the same Idempotency-Key header gets
+the original response replayed.`)
+		a.Params(func() {
+			a.Param("spaceID", d.UUID, "ID of the space")
+			a.Param("template", d.String, "Name of the template to create the environments from")
+		})
+		idempotencyKeyHeader()
+		a.Response(d.Created, envList)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.Conflict, JSONAPIErrors)
+		a.Response(d.UnprocessableEntity, JSONAPIErrors)
 	})
 
 	a.Action("show", func() {
@@ -108,4 +225,151 @@ var _ = a.Resource("environment", func() {
 		a.Response(d.Forbidden, JSONAPIErrors)
 	})
 
+	a.Action("update", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.PATCH("/environments/:envID"),
+		)
+		a.Description("Update the environment for the given ID, e.g. to extend its time to live.")
+		a.Params(func() {
+			a.Param("envID", d.UUID, "ID of the environment")
+			a.Param("override", d.String, "Justification to bypass the lock of the environment or to remove its protection, requires 'manage' scope")
+		})
+		a.Payload(envUpdateSingle)
+		a.Response(d.OK, envSingle)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.Locked, JSONAPIErrors)
+	})
+
+	a.Action("delete", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.DELETE("/environments/:envID"),
+		)
+		a.Description("Delete the environment for the given ID.")
+		a.Params(func() {
+			a.Param("envID", d.UUID, "ID of the environment")
+			a.Param("override", d.String, "Justification to bypass the lock or the protection of the environment, requires 'manage' scope")
+		})
+		a.Response(d.NoContent)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.Locked, JSONAPIErrors)
+	})
+
+	a.Action("lock", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST("/environments/:envID/lock"),
+		)
+		a.Description(`Lock the environment for the given ID against changes and deletion. Replacing
+an active lock requires an override.`)
+		a.Params(func() {
+			a.Param("envID", d.UUID, "ID of the environment")
+			a.Param("override", d.String, "Justification to replace the active lock of the environment")
+		})
+		a.Payload(envLockSingle)
+		a.Response(d.OK, envSingle)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.Conflict, JSONAPIErrors)
+	})
+
+	a.Action("unlock", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST("/environments/:envID/unlock"),
+		)
+		a.Description("Remove the lock of the environment for the given ID.")
+		a.Params(func() {
+			a.Param("envID", d.UUID, "ID of the environment")
+			a.Param("justification", d.String, "Why the lock is removed, recorded in the audit log")
+			a.Required("justification")
+		})
+		a.Response(d.OK, envSingle)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+	})
+
+	a.Action("createDefaults", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST("/spaces/:spaceID/environments/defaults"),
+		)
+		a.Description(`Create the default environments of a new space on the cluster of the space
+owner. Allowed for the space service accounts, which must give the cluster, and users with
+'manage' scope, whose first cluster is used by default. Environments of a default type
+which exist already are kept, so calling it again is harmless. Returns the default
+environments of the space, with 201 if any was created.`)
+		a.Params(func() {
+			a.Param("spaceID", d.UUID, "ID of the space")
+			a.Param("cluster-url", d.String, "Cluster of the space owner, required for the space service accounts")
+		})
+		a.Response(d.Created, envList)
+		a.Response(d.OK, envList)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+	})
+
+	a.Action("deleteSpace", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.DELETE("/spaces/:spaceID/environments"),
+		)
+		a.Description(`Delete all environments of a space which was deleted. Only allowed for the
+space service accounts, locks and deletion protection are ignored.`)
+		a.Params(func() {
+			a.Param("spaceID", d.UUID, "ID of the deleted space")
+		})
+		a.Response(d.NoContent)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+	})
+
+	a.Action("clone", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST("/environments/:envID/clone"),
+		)
+		a.Description(`Clone the environment for the given ID into another space or cluster.
+Requires 'contribute' on the source space and 'manage' on the target space.`)
+		a.Params(func() {
+			a.Param("envID", d.UUID, "ID of the environment to clone")
+		})
+		a.OptionalPayload(envCloneSingle)
+		a.Response(d.Created, envSingle)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.Conflict, JSONAPIErrors)
+	})
+
 })
+
+// idempotencyKeyHeader declares the header of the actions creating environments.
+func idempotencyKeyHeader() {
+	a.Headers(func() {
+		a.Header("Idempotency-Key", d.String, "Unique key of the request, retries must send the same key and body", func() {
+			a.MinLength(1)
+			a.MaxLength(255)
+		})
+	})
+}
@@ -5,6 +5,18 @@ import (
 	a "github.com/goadesign/goa/design/apidsl"
 )
 
+var dependencyStatus = a.Type("DependencyStatus", func() {
+	a.Description("The health of a service the instance depends on")
+	a.Attribute("name", d.String, "The name of the service", func() {
+		a.Example("auth")
+	})
+	a.Attribute("status", d.String, "'OK' or an error message if the service is unreachable or unhealthy.")
+	a.Attribute("latency", d.Integer, "How long the check took, in milliseconds", func() {
+		a.Example(12)
+	})
+	a.Required("name", "status", "latency")
+})
+
 // Status defines the status of the current running instance
 var Status = a.MediaType("application/vnd.status+json", func() {
 	a.Description("The status of the current running instance")
@@ -21,7 +33,8 @@ var Status = a.MediaType("application/vnd.status+json", func() {
 		a.Attribute("devMode", d.Boolean, "'True' if the Developer Mode is enabled")
 		a.Attribute("databaseStatus", d.String, "The status of Database connection. 'OK' or an error message is displayed.")
 		a.Attribute("configurationStatus", d.String, "The status of the used configuration. 'OK' or an error message if there is something wrong with the configuration used by service.")
-		a.Required("commit", "buildTime", "startTime", "databaseStatus", "configurationStatus")
+		a.Attribute("dependencies", a.ArrayOf(dependencyStatus), "The health of the Auth and the Cluster services. Unhealthy services are reported but do not make the instance unavailable.")
+		a.Required("commit", "buildTime", "startTime", "databaseStatus", "configurationStatus", "dependencies")
 	})
 	a.View("default", func() {
 		a.Attribute("commit")
@@ -30,6 +43,22 @@ var Status = a.MediaType("application/vnd.status+json", func() {
 		a.Attribute("devMode")
 		a.Attribute("databaseStatus")
 		a.Attribute("configurationStatus")
+		a.Attribute("dependencies")
+	})
+})
+
+// StatusProbe defines the result of a liveness or readiness probe
+var StatusProbe = a.MediaType("application/vnd.status-probe+json", func() {
+	a.TypeName("StatusProbe")
+	a.Description("The result of a liveness or readiness probe of the current running instance")
+	a.Attributes(func() {
+		a.Attribute("status", d.String, "'OK' or the reason why the instance is not live or ready.", func() {
+			a.Example("OK")
+		})
+		a.Required("status")
+	})
+	a.View("default", func() {
+		a.Attribute("status")
 	})
 })
 
@@ -47,4 +76,21 @@ var _ = a.Resource("status", func() {
 		a.Response(d.ServiceUnavailable, Status)
 	})
 
+	a.Action("live", func() {
+		a.Routing(
+			a.GET("/live"),
+		)
+		a.Description("Liveness probe, succeeds as long as the instance is able to serve requests at all")
+		a.Response(d.OK, StatusProbe)
+	})
+
+	a.Action("ready", func() {
+		a.Routing(
+			a.GET("/ready"),
+		)
+		a.Description("Readiness probe, fails while the instance starts up or shuts down, and while the database is unreachable")
+		a.Response(d.OK, StatusProbe)
+		a.Response(d.ServiceUnavailable, StatusProbe)
+	})
+
 })
@@ -0,0 +1,138 @@
+package design
+
+import (
+	d "github.com/goadesign/goa/design"
+	a "github.com/goadesign/goa/design/apidsl"
+)
+
+var tmpl = a.Type("Template", func() {
+	a.Description(`JSONAPI store for data of environment template.`)
+	a.Attribute("type", d.String, func() {
+		a.Enum("templates")
+	})
+	a.Attribute("id", d.UUID, "ID of template", func() {
+		a.Example("6b2c1bc4-3cc7-4c1b-9b65-7f3d4b9c2a1e")
+	})
+	a.Attribute("attributes", tmplAttrs)
+	a.Attribute("links", genericLinks)
+	a.Required("type", "attributes")
+})
+
+var tmplAttrs = a.Type("TemplateAttributes", func() {
+	a.Description(`JSONAPI store for all the "attributes" of environment template.`)
+	a.Attribute("name", d.String, "The template name", func() {
+		a.Example("standard-pipeline")
+	})
+	a.Attribute("description", d.String, "The template description")
+	a.Attribute("environments", a.ArrayOf(tmplEnv), "The environments created by the template")
+	a.Required("name", "environments")
+})
+
+var tmplEnv = a.Type("TemplateEnvironment", func() {
+	a.Description(`An environment definition of a template. The name and namespace name
+may contain the placeholders {space}, {user}, {type} and {template}.`)
+	a.Attribute("name", d.String, "The environment name pattern", func() {
+		a.Example("{space}-{type}")
+	})
+	a.Attribute("type", d.String, "The environment type", func() {
+		a.Enum("dev", "build", "stage", "run")
+	})
+	a.Attribute("namespace-name", d.String, "The namespace name pattern", func() {
+		a.Example("{space}-{type}")
+	})
+	a.Attribute("cluster-url", d.String, "The cluster url", func() {
+		a.Example("https://api.starter-us-east-2a.openshift.com")
+	})
+	a.Required("name", "type", "cluster-url")
+})
+
+var tmplList = JSONList(
+	"Templates", "Holds the list of environment templates",
+	tmpl,
+	pagingLinks,
+	nil)
+
+var tmplSingle = JSONSingle(
+	"Template", "Holds a single environment template",
+	tmpl,
+	nil)
+
+var _ = a.Resource("template", func() {
+
+	a.Action("list", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/templates"),
+		)
+		a.Description("List environment templates.")
+		a.Response(d.OK, tmplList)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+	})
+
+	a.Action("create", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.POST("/templates"),
+		)
+		a.Description("Create environment template. Only allowed for admin service accounts.")
+		a.Payload(tmplSingle)
+		a.Response(d.Created, tmplSingle)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.Conflict, JSONAPIErrors)
+	})
+
+	a.Action("show", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.GET("/templates/:templateID"),
+		)
+		a.Description("Retrieve environment template (as JSONAPI) for the given ID.")
+		a.Params(func() {
+			a.Param("templateID", d.UUID, "ID of the template")
+		})
+		a.Response(d.OK, tmplSingle)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+	})
+
+	a.Action("update", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.PATCH("/templates/:templateID"),
+		)
+		a.Description("Update environment template for the given ID. Only allowed for admin service accounts.")
+		a.Params(func() {
+			a.Param("templateID", d.UUID, "ID of the template")
+		})
+		a.Payload(tmplSingle)
+		a.Response(d.OK, tmplSingle)
+		a.Response(d.BadRequest, JSONAPIErrors)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+		a.Response(d.Conflict, JSONAPIErrors)
+	})
+
+	a.Action("delete", func() {
+		a.Security("jwt")
+		a.Routing(
+			a.DELETE("/templates/:templateID"),
+		)
+		a.Description("Delete environment template for the given ID. Only allowed for admin service accounts.")
+		a.Params(func() {
+			a.Param("templateID", d.UUID, "ID of the template")
+		})
+		a.Response(d.NoContent)
+		a.Response(d.InternalServerError, JSONAPIErrors)
+		a.Response(d.NotFound, JSONAPIErrors)
+		a.Response(d.Unauthorized, JSONAPIErrors)
+		a.Response(d.Forbidden, JSONAPIErrors)
+	})
+
+})
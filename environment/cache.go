@@ -0,0 +1,272 @@
+package environment
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/fabric8-services/fabric8-env/cache"
+	"github.com/fabric8-services/fabric8-env/pubsub"
+	"github.com/prometheus/client_golang/prometheus"
+	uuid "github.com/satori/go.uuid"
+)
+
+// cacheTopic carries the IDs of the environments changed by an instance, which
+// the other instances remove from their cache. The IDs are prefixed with the
+// instance of the cache which published them, followed by a colon.
+const cacheTopic = "environment_cache_invalidations"
+
+// maxIDsPerMessage keeps the messages below the size limit of the notifications.
+const maxIDsPerMessage = 100
+
+var (
+	cacheHits = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fabric8_env_environment_cache_hits_total",
+		Help: "Number of environments loaded from the cache.",
+	})
+	cacheMisses = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fabric8_env_environment_cache_misses_total",
+		Help: "Number of environments loaded from the database.",
+	})
+	cacheInvalidations = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "fabric8_env_environment_cache_invalidations_total",
+		Help: "Number of environments removed from the cache because they changed.",
+	})
+)
+
+func init() {
+	prometheus.MustRegister(cacheHits, cacheMisses, cacheInvalidations)
+}
+
+// Cache holds the environments loaded by ID. An environment changed by any
+// instance is removed from the cache of all the instances, the others expire
+// after the TTL. The least recently used environments are evicted when the
+// cache holds more than maxEntries.
+type Cache struct {
+	pubsub   pubsub.PubSub
+	instance string
+	ttl      time.Duration
+	now      func() time.Time
+	entries  *cache.LRU
+}
+
+// CacheOption configures the cache created by NewCache.
+type CacheOption func(c *Cache)
+
+// WithCacheClock replaces the clock used to expire the cache entries.
+func WithCacheClock(now func() time.Time) CacheOption {
+	return func(c *Cache) {
+		c.now = now
+	}
+}
+
+// NewCache returns an empty cache, which publishes its invalidations on ps.
+func NewCache(ps pubsub.PubSub, ttl time.Duration, maxEntries int, options ...CacheOption) *Cache {
+	c := &Cache{
+		pubsub:   ps,
+		instance: uuid.NewV4().String(),
+		ttl:      ttl,
+		now:      time.Now,
+	}
+	for _, opt := range options {
+		opt(c)
+	}
+	c.entries = cache.New(maxEntries, cache.WithClock(c.now))
+	return c
+}
+
+// Listen removes the environments changed by the other instances from the
+// cache, until ctx is done.
+func (c *Cache) Listen(ctx context.Context) error {
+	return c.pubsub.Subscribe(ctx, cacheTopic, c.receive)
+}
+
+// Repository returns next with the environments loaded through the cache. The
+// environments changed through it are invalidated.
+func (c *Cache) Repository(next Repository) Repository {
+	return &cachingRepository{Repository: next, cache: c}
+}
+
+// BeginTransaction returns a CacheTransaction recording the environments
+// changed in a database transaction.
+func (c *Cache) BeginTransaction() *CacheTransaction {
+	return &CacheTransaction{cache: c}
+}
+
+// Invalidate removes the environments from the cache of all the instances.
+func (c *Cache) Invalidate(ids ...uuid.UUID) {
+	if len(ids) == 0 {
+		return
+	}
+	c.remove(ids)
+	for start := 0; start < len(ids); start += maxIDsPerMessage {
+		end := start + maxIDsPerMessage
+		if end > len(ids) {
+			end = len(ids)
+		}
+		parts := make([]string, 0, end-start)
+		for _, id := range ids[start:end] {
+			parts = append(parts, id.String())
+		}
+		if err := c.pubsub.Publish(cacheTopic, c.instance+":"+strings.Join(parts, ",")); err != nil {
+			log.Error(nil, map[string]interface{}{"err": err},
+				"unable to publish the invalidation of cached environments")
+		}
+	}
+}
+
+// receive removes the environments of a message, or all of them if messages
+// may have been lost. The messages of this cache are ignored, it removed their
+// environments when it published them.
+func (c *Cache) receive(message string) {
+	if message == "" {
+		c.purge()
+		return
+	}
+	if i := strings.Index(message, ":"); i >= 0 {
+		if message[:i] == c.instance {
+			return
+		}
+		message = message[i+1:]
+	}
+	var ids []uuid.UUID
+	for _, part := range strings.Split(message, ",") {
+		id, err := uuid.FromString(part)
+		if err != nil {
+			log.Warn(nil, map[string]interface{}{"err": err, "id": part},
+				"invalid environment ID in a cache invalidation")
+			continue
+		}
+		ids = append(ids, id)
+	}
+	c.remove(ids)
+}
+
+// get returns a copy of the unexpired environment, or nil, and the current
+// generation.
+func (c *Cache) get(id uuid.UUID) (*Environment, uint64) {
+	// the generation is read first, an environment invalidated meanwhile is not
+	// put back
+	generation := c.entries.Generation()
+	cached, ok := c.entries.Get(id)
+	if !ok {
+		return nil, generation
+	}
+	env := *cached.(*Environment)
+	return &env, generation
+}
+
+// put caches a copy of the environment, unless it was invalidated since the
+// given generation.
+func (c *Cache) put(env *Environment, generation uint64) {
+	cached := *env
+	c.entries.PutIfGeneration(generation, *env.ID, &cached, c.ttl)
+}
+
+func (c *Cache) remove(ids []uuid.UUID) {
+	keys := make([]interface{}, len(ids))
+	for i, id := range ids {
+		keys[i] = id
+	}
+	c.entries.Remove(keys...)
+	cacheInvalidations.Add(float64(len(ids)))
+}
+
+func (c *Cache) purge() {
+	cacheInvalidations.Add(float64(c.entries.Purge()))
+}
+
+type cachingRepository struct {
+	Repository
+	cache *Cache
+}
+
+func (r *cachingRepository) Load(ctx context.Context, envID uuid.UUID) (*Environment, error) {
+	env, generation := r.cache.get(envID)
+	if env != nil {
+		cacheHits.Inc()
+		return env, nil
+	}
+	cacheMisses.Inc()
+
+	env, err := r.Repository.Load(ctx, envID)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.put(env, generation)
+	return env, nil
+}
+
+func (r *cachingRepository) Save(ctx context.Context, env *Environment) (*Environment, error) {
+	defer r.cache.Invalidate(*env.ID)
+	return r.Repository.Save(ctx, env)
+}
+
+func (r *cachingRepository) MoveCluster(ctx context.Context, oldClusterURL, newClusterURL string, now time.Time) ([]*Environment, error) {
+	envs, err := r.Repository.MoveCluster(ctx, oldClusterURL, newClusterURL, now)
+	for _, env := range envs {
+		r.cache.Invalidate(*env.ID)
+	}
+	return envs, err
+}
+
+func (r *cachingRepository) Delete(ctx context.Context, envID uuid.UUID) error {
+	defer r.cache.Invalidate(envID)
+	return r.Repository.Delete(ctx, envID)
+}
+
+// CacheTransaction records the environments changed in a database
+// transaction, which are invalidated once it ended.
+type CacheTransaction struct {
+	cache *Cache
+
+	mu  sync.Mutex
+	ids []uuid.UUID
+}
+
+// Repository returns next, the environments changed through it are recorded.
+// The environments are not loaded through the cache, the transaction must see
+// its own changes.
+func (t *CacheTransaction) Repository(next Repository) Repository {
+	return &recordingRepository{Repository: next, tx: t}
+}
+
+// End invalidates the environments changed in the transaction, it must be
+// called once the transaction is committed.
+func (t *CacheTransaction) End() {
+	t.mu.Lock()
+	ids := t.ids
+	t.ids = nil
+	t.mu.Unlock()
+	t.cache.Invalidate(ids...)
+}
+
+func (t *CacheTransaction) record(id uuid.UUID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.ids = append(t.ids, id)
+}
+
+type recordingRepository struct {
+	Repository
+	tx *CacheTransaction
+}
+
+func (r *recordingRepository) Save(ctx context.Context, env *Environment) (*Environment, error) {
+	r.tx.record(*env.ID)
+	return r.Repository.Save(ctx, env)
+}
+
+func (r *recordingRepository) MoveCluster(ctx context.Context, oldClusterURL, newClusterURL string, now time.Time) ([]*Environment, error) {
+	envs, err := r.Repository.MoveCluster(ctx, oldClusterURL, newClusterURL, now)
+	for _, env := range envs {
+		r.tx.record(*env.ID)
+	}
+	return envs, err
+}
+
+func (r *recordingRepository) Delete(ctx context.Context, envID uuid.UUID) error {
+	r.tx.record(envID)
+	return r.Repository.Delete(ctx, envID)
+}
@@ -0,0 +1,261 @@
+package environment_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/errors"
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/environment"
+	"github.com/fabric8-services/fabric8-env/pubsub"
+	"github.com/prometheus/client_golang/prometheus"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type CacheSuite struct {
+	testsuite.UnitTestSuite
+}
+
+func TestCache(t *testing.T) {
+	suite.Run(t, &CacheSuite{})
+}
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+// testRepository counts the loads of its environments, onLoad is called during
+// each load if set.
+type testRepository struct {
+	environment.Repository
+	envs   map[uuid.UUID]*environment.Environment
+	loads  int
+	onLoad func()
+}
+
+func newTestRepository(envs ...*environment.Environment) *testRepository {
+	r := &testRepository{envs: map[uuid.UUID]*environment.Environment{}}
+	for _, env := range envs {
+		r.envs[*env.ID] = env
+	}
+	return r
+}
+
+func (r *testRepository) Load(ctx context.Context, envID uuid.UUID) (*environment.Environment, error) {
+	r.loads++
+	if r.onLoad != nil {
+		r.onLoad()
+	}
+	env, ok := r.envs[envID]
+	if !ok {
+		return nil, errors.NewNotFoundError("environment", envID.String())
+	}
+	c := *env
+	return &c, nil
+}
+
+func (r *testRepository) Save(ctx context.Context, env *environment.Environment) (*environment.Environment, error) {
+	c := *env
+	r.envs[*env.ID] = &c
+	return env, nil
+}
+
+func (r *testRepository) Delete(ctx context.Context, envID uuid.UUID) error {
+	delete(r.envs, envID)
+	return nil
+}
+
+func testEnvironment(name string) *environment.Environment {
+	id := uuid.NewV4()
+	return &environment.Environment{ID: &id, Name: &name}
+}
+
+func (s *CacheSuite) TestLoad() {
+	clock := &testClock{now: time.Now()}
+	env := testEnvironment("osio-stage")
+	next := newTestRepository(env)
+	repo := environment.NewCache(pubsub.NewLocal(), time.Minute, 100, environment.WithCacheClock(clock.Now)).Repository(next)
+	ctx := context.Background()
+
+	s.T().Run("cached", func(t *testing.T) {
+		hits, misses := counterValue(t, "fabric8_env_environment_cache_hits_total"), counterValue(t, "fabric8_env_environment_cache_misses_total")
+		loaded, err := repo.Load(ctx, *env.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "osio-stage", *loaded.Name)
+		loaded, err = repo.Load(ctx, *env.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "osio-stage", *loaded.Name)
+		assert.Equal(t, 1, next.loads)
+		assert.Equal(t, hits+1, counterValue(t, "fabric8_env_environment_cache_hits_total"))
+		assert.Equal(t, misses+1, counterValue(t, "fabric8_env_environment_cache_misses_total"))
+	})
+
+	s.T().Run("copies", func(t *testing.T) {
+		loaded, err := repo.Load(ctx, *env.ID)
+		require.NoError(t, err)
+		name := "changed"
+		loaded.Name = &name
+		loaded, err = repo.Load(ctx, *env.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "osio-stage", *loaded.Name)
+	})
+
+	s.T().Run("expired", func(t *testing.T) {
+		next.loads = 0
+		clock.now = clock.now.Add(time.Minute)
+		_, err := repo.Load(ctx, *env.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, next.loads)
+	})
+
+	s.T().Run("not found not cached", func(t *testing.T) {
+		next.loads = 0
+		id := uuid.NewV4()
+		_, err := repo.Load(ctx, id)
+		assert.IsType(t, errors.NotFoundError{}, err)
+		_, err = repo.Load(ctx, id)
+		assert.IsType(t, errors.NotFoundError{}, err)
+		assert.Equal(t, 2, next.loads)
+	})
+}
+
+func (s *CacheSuite) TestEviction() {
+	env1, env2, env3 := testEnvironment("env1"), testEnvironment("env2"), testEnvironment("env3")
+	next := newTestRepository(env1, env2, env3)
+	repo := environment.NewCache(pubsub.NewLocal(), time.Minute, 2).Repository(next)
+	ctx := context.Background()
+
+	for _, env := range []*environment.Environment{env1, env2, env1, env3} {
+		_, err := repo.Load(ctx, *env.ID)
+		require.NoError(s.T(), err)
+	}
+	require.Equal(s.T(), 3, next.loads)
+
+	// env2 was the least recently used
+	_, err := repo.Load(ctx, *env1.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 3, next.loads)
+	_, err = repo.Load(ctx, *env2.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 4, next.loads)
+}
+
+func (s *CacheSuite) TestInvalidation() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	notifications := pubsub.NewLocal()
+
+	env := testEnvironment("osio-stage")
+	next := newTestRepository(env)
+	cache := environment.NewCache(notifications, time.Minute, 100)
+	require.NoError(s.T(), cache.Listen(ctx))
+	repo := cache.Repository(next)
+	// another instance, sharing the database
+	otherNext := newTestRepository(env)
+	otherCache := environment.NewCache(notifications, time.Minute, 100)
+	require.NoError(s.T(), otherCache.Listen(ctx))
+	otherRepo := otherCache.Repository(otherNext)
+
+	load := func(t *testing.T, repo environment.Repository) *environment.Environment {
+		loaded, err := repo.Load(ctx, *env.ID)
+		require.NoError(t, err)
+		return loaded
+	}
+
+	s.T().Run("save", func(t *testing.T) {
+		load(t, repo)
+		load(t, otherRepo)
+		name := "osio-run"
+		changed := *env
+		changed.Name = &name
+		_, err := repo.Save(ctx, &changed)
+		require.NoError(t, err)
+		otherNext.envs[*env.ID] = &changed
+
+		assert.Equal(t, "osio-run", *load(t, repo).Name)
+		assert.Equal(t, "osio-run", *load(t, otherRepo).Name, "invalidated in the other instance")
+		assert.Equal(t, 2, next.loads)
+		assert.Equal(t, 2, otherNext.loads)
+	})
+
+	s.T().Run("own invalidations ignored", func(t *testing.T) {
+		invalidations := counterValue(t, "fabric8_env_environment_cache_invalidations_total")
+		cache.Invalidate(*env.ID)
+		// removed once when published and once when received by the other instance
+		assert.Equal(t, invalidations+2, counterValue(t, "fabric8_env_environment_cache_invalidations_total"))
+	})
+
+	s.T().Run("delete", func(t *testing.T) {
+		require.NoError(t, repo.Delete(ctx, *env.ID))
+		delete(otherNext.envs, *env.ID)
+		_, err := repo.Load(ctx, *env.ID)
+		assert.IsType(t, errors.NotFoundError{}, err)
+		_, err = otherRepo.Load(ctx, *env.ID)
+		assert.IsType(t, errors.NotFoundError{}, err)
+	})
+}
+
+func (s *CacheSuite) TestTransaction() {
+	env := testEnvironment("osio-stage")
+	next := newTestRepository(env)
+	cache := environment.NewCache(pubsub.NewLocal(), time.Minute, 100)
+	repo := cache.Repository(next)
+	ctx := context.Background()
+	_, err := repo.Load(ctx, *env.ID)
+	require.NoError(s.T(), err)
+
+	tx := cache.BeginTransaction()
+	name := "osio-run"
+	changed := *env
+	changed.Name = &name
+	_, err = tx.Repository(next).Save(ctx, &changed)
+	require.NoError(s.T(), err)
+
+	// the change is not committed yet
+	loaded, err := repo.Load(ctx, *env.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "osio-stage", *loaded.Name)
+
+	tx.End()
+	loaded, err = repo.Load(ctx, *env.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "osio-run", *loaded.Name)
+}
+
+func (s *CacheSuite) TestLoadDuringInvalidation() {
+	env := testEnvironment("osio-stage")
+	next := newTestRepository(env)
+	cache := environment.NewCache(pubsub.NewLocal(), time.Minute, 100)
+	repo := cache.Repository(next)
+	ctx := context.Background()
+
+	// the loaded environment may be older than the change being invalidated
+	next.onLoad = func() {
+		cache.Invalidate(*env.ID)
+	}
+	_, err := repo.Load(ctx, *env.ID)
+	require.NoError(s.T(), err)
+	next.onLoad = nil
+	_, err = repo.Load(ctx, *env.ID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 2, next.loads, "not cached")
+}
+
+func counterValue(t *testing.T, name string) float64 {
+	families, err := prometheus.DefaultGatherer.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == name {
+			return family.GetMetric()[0].GetCounter().GetValue()
+		}
+	}
+	return 0
+}
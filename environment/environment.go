@@ -2,17 +2,24 @@ package environment
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/fabric8-services/fabric8-common/errors"
 	"github.com/fabric8-services/fabric8-common/gormsupport"
+	"github.com/fabric8-services/fabric8-common/httpsupport"
 	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/fabric8-services/fabric8-env/gormctx"
 	"github.com/goadesign/goa"
 	"github.com/jinzhu/gorm"
 	errs "github.com/pkg/errors"
 	uuid "github.com/satori/go.uuid"
 )
 
+// namespaceNameUniqueConstraint prevents two environments from using the same
+// namespace of a cluster.
+const namespaceNameUniqueConstraint = "environments_namespace_name_idx"
+
 type Environment struct {
 	gormsupport.Lifecycle
 	ID            *uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key"`
@@ -21,16 +28,45 @@ type Environment struct {
 	SpaceID       *uuid.UUID `sql:"type:uuid"`
 	NamespaceName *string
 	ClusterURL    *string
+	ExpiresAt     *time.Time
+	Protected     bool
+	LockedAt      *time.Time
+	LockedBy      *string
+	LockReason    *string
+	LockExpiresAt *time.Time
 }
 
 func (e Environment) TableName() string {
 	return "environments"
 }
 
+// IsLocked returns true if the environment has a lock which did not expire at the given time.
+func (e Environment) IsLocked(now time.Time) bool {
+	return e.LockedAt != nil && (e.LockExpiresAt == nil || e.LockExpiresAt.After(now))
+}
+
 type Repository interface {
 	Create(ctx context.Context, env *Environment) (*Environment, error)
+	Save(ctx context.Context, env *Environment) (*Environment, error)
 	List(ctx context.Context, spaceID uuid.UUID) ([]*Environment, error)
+	Count(ctx context.Context, spaceID uuid.UUID) (int, error)
+	LockSpace(ctx context.Context, spaceID uuid.UUID) error
+	ListByCluster(ctx context.Context, clusterURL string) ([]*Environment, error)
+	MoveCluster(ctx context.Context, oldClusterURL, newClusterURL string, now time.Time) ([]*Environment, error)
+	UsedNamespaceNames(ctx context.Context, clusterURL string, names []string) ([]string, error)
+	ListAll(ctx context.Context, filter Filter, offset, limit int) ([]*Environment, int, error)
+	ListExpired(ctx context.Context, before time.Time, limit int) ([]*Environment, error)
 	Load(ctx context.Context, envID uuid.UUID) (*Environment, error)
+	LoadForUpdate(ctx context.Context, envID uuid.UUID) (*Environment, error)
+	Delete(ctx context.Context, envID uuid.UUID) error
+}
+
+// Filter selects environments of all spaces, nil fields match every environment.
+type Filter struct {
+	ClusterURL    *string
+	Type          *string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
 }
 
 type GormRepository struct {
@@ -43,11 +79,20 @@ func NewRepository(db *gorm.DB) *GormRepository {
 	}
 }
 
+// bind returns the database of the repository running its statements with ctx,
+// so that they are cancelled with it.
+func (r *GormRepository) bind(ctx context.Context) *gorm.DB {
+	return gormctx.Bind(ctx, r.db)
+}
+
 func (r *GormRepository) Create(ctx context.Context, env *Environment) (*Environment, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "environment", "create"}, time.Now())
 
-	err := r.db.Create(env).Error
+	err := r.bind(ctx).Create(env).Error
 	if err != nil {
+		if gormsupport.IsUniqueViolation(err, namespaceNameUniqueConstraint) {
+			return nil, namespaceNameConflict(env)
+		}
 		log.Error(ctx, map[string]interface{}{"err": err},
 			"unable to create the environment")
 		return nil, errs.WithStack(err)
@@ -56,10 +101,40 @@ func (r *GormRepository) Create(ctx context.Context, env *Environment) (*Environ
 	return env, nil
 }
 
+func (r *GormRepository) Save(ctx context.Context, env *Environment) (*Environment, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "environment", "save"}, time.Now())
+
+	tx := r.bind(ctx).Model(&Environment{}).Where("id = ?", env.ID).Updates(map[string]interface{}{
+		"name":            env.Name,
+		"type":            env.Type,
+		"namespace_name":  env.NamespaceName,
+		"cluster_url":     env.ClusterURL,
+		"expires_at":      env.ExpiresAt,
+		"protected":       env.Protected,
+		"locked_at":       env.LockedAt,
+		"locked_by":       env.LockedBy,
+		"lock_reason":     env.LockReason,
+		"lock_expires_at": env.LockExpiresAt,
+	})
+	if tx.Error != nil {
+		if gormsupport.IsUniqueViolation(tx.Error, namespaceNameUniqueConstraint) {
+			return nil, namespaceNameConflict(env)
+		}
+		log.Error(ctx, map[string]interface{}{"err": tx.Error, "env_id": env.ID.String()},
+			"unable to save the environment")
+		return nil, errs.WithStack(tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return nil, errors.NewNotFoundError("environment", env.ID.String())
+	}
+
+	return r.Load(ctx, *env.ID)
+}
+
 func (r *GormRepository) List(ctx context.Context, spaceID uuid.UUID) ([]*Environment, error) {
 	var rows []*Environment
 
-	err := r.db.Model(&Environment{}).Where("space_id = ?", spaceID).Find(&rows).Error
+	err := r.bind(ctx).Model(&Environment{}).Where("space_id = ?", spaceID).Find(&rows).Error
 	if err != nil && err != gorm.ErrRecordNotFound {
 		log.Error(ctx, map[string]interface{}{"space_id": spaceID.String(), "err": err},
 			"unable to list the environments")
@@ -69,11 +144,177 @@ func (r *GormRepository) List(ctx context.Context, spaceID uuid.UUID) ([]*Enviro
 	return rows, nil
 }
 
+func (r *GormRepository) Count(ctx context.Context, spaceID uuid.UUID) (int, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "environment", "count"}, time.Now())
+
+	var count int
+	err := r.bind(ctx).Model(&Environment{}).Where("space_id = ?", spaceID).Count(&count).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{"space_id": spaceID.String(), "err": err},
+			"unable to count the environments")
+		return 0, errs.WithStack(err)
+	}
+	return count, nil
+}
+
+// LockSpace takes a transaction scoped lock on the given space, so concurrent
+// transactions checking and creating environments of the space are serialized.
+// It must be called inside a transaction.
+func (r *GormRepository) LockSpace(ctx context.Context, spaceID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "environment", "lock_space"}, time.Now())
+
+	err := r.bind(ctx).Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "environments/"+spaceID.String()).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{"space_id": spaceID.String(), "err": err},
+			"unable to lock the space")
+		return errs.WithStack(err)
+	}
+	return nil
+}
+
+// ListAll returns a page of the environments of all spaces matching the filter,
+// oldest first, and the total number of matching environments. A negative limit
+// returns all of them.
+func (r *GormRepository) ListAll(ctx context.Context, filter Filter, offset, limit int) ([]*Environment, int, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "environment", "list_all"}, time.Now())
+
+	db := r.bind(ctx).Model(&Environment{})
+	if filter.ClusterURL != nil {
+		db = db.Where("rtrim(cluster_url, '/') = ?", httpsupport.RemoveTrailingSlashFromURL(*filter.ClusterURL))
+	}
+	if filter.Type != nil {
+		db = db.Where("type = ?", *filter.Type)
+	}
+	if filter.CreatedAfter != nil {
+		db = db.Where("created_at >= ?", *filter.CreatedAfter)
+	}
+	if filter.CreatedBefore != nil {
+		db = db.Where("created_at < ?", *filter.CreatedBefore)
+	}
+
+	var count int
+	err := db.Count(&count).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{"err": err},
+			"unable to count the environments")
+		return nil, 0, errs.WithStack(err)
+	}
+
+	var rows []*Environment
+	err = db.Order("created_at, id").Offset(offset).Limit(limit).Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		log.Error(ctx, map[string]interface{}{"err": err},
+			"unable to list the environments")
+		return nil, 0, errs.WithStack(err)
+	}
+	return rows, count, nil
+}
+
+// ListByCluster returns the environments of all spaces on the given cluster. A
+// trailing slash of the cluster URL is ignored.
+func (r *GormRepository) ListByCluster(ctx context.Context, clusterURL string) ([]*Environment, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "environment", "list_by_cluster"}, time.Now())
+
+	var rows []*Environment
+	err := r.bind(ctx).Model(&Environment{}).
+		Where("rtrim(cluster_url, '/') = ?", httpsupport.RemoveTrailingSlashFromURL(clusterURL)).
+		Order("created_at").Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		log.Error(ctx, map[string]interface{}{"cluster_url": clusterURL, "err": err},
+			"unable to list the environments by cluster")
+		return nil, errs.WithStack(err)
+	}
+
+	return rows, nil
+}
+
+// MoveCluster moves the environments on the old cluster which are not locked at the
+// given time to the new cluster and returns them. A trailing slash of the cluster
+// URLs is ignored. A single statement checks the lock and moves, so an environment
+// locked concurrently is either moved before or left unchanged.
+func (r *GormRepository) MoveCluster(ctx context.Context, oldClusterURL, newClusterURL string, now time.Time) ([]*Environment, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "environment", "move_cluster"}, time.Now())
+
+	var rows []*Environment
+	err := r.bind(ctx).Raw(`WITH moved AS (
+			UPDATE environments SET cluster_url = ?, updated_at = ?
+			WHERE rtrim(cluster_url, '/') = ? AND deleted_at IS NULL
+			AND (locked_at IS NULL OR lock_expires_at <= ?)
+			RETURNING *
+		) SELECT * FROM moved ORDER BY created_at`,
+		newClusterURL, now, httpsupport.RemoveTrailingSlashFromURL(oldClusterURL), now).Scan(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		if gormsupport.IsUniqueViolation(err, namespaceNameUniqueConstraint) {
+			return nil, errors.NewDataConflictError(fmt.Sprintf("a namespace of cluster '%s' is already used on cluster '%s'",
+				oldClusterURL, newClusterURL))
+		}
+		log.Error(ctx, map[string]interface{}{"old_cluster_url": oldClusterURL, "new_cluster_url": newClusterURL, "err": err},
+			"unable to move the environments between clusters")
+		return nil, errs.WithStack(err)
+	}
+
+	return rows, nil
+}
+
+// UsedNamespaceNames returns the given namespace names which are used by an
+// environment on the given cluster. A trailing slash of the cluster URL is ignored.
+func (r *GormRepository) UsedNamespaceNames(ctx context.Context, clusterURL string, names []string) ([]string, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "environment", "used_namespace_names"}, time.Now())
+
+	used := []string{}
+	if len(names) == 0 {
+		return used, nil
+	}
+	err := r.bind(ctx).Model(&Environment{}).
+		Where("rtrim(cluster_url, '/') = ? AND namespace_name IN (?)", httpsupport.RemoveTrailingSlashFromURL(clusterURL), names).
+		Pluck("namespace_name", &used).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{"cluster_url": clusterURL, "err": err},
+			"unable to find the used namespace names")
+		return nil, errs.WithStack(err)
+	}
+	return used, nil
+}
+
+// ListExpired returns at most limit environments which expired before the given
+// time. Protected and locked environments are never returned. The rows are locked
+// until the end of the transaction and rows locked by other transactions are
+// skipped, so concurrent callers get distinct environments.
+func (r *GormRepository) ListExpired(ctx context.Context, before time.Time, limit int) ([]*Environment, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "environment", "list_expired"}, time.Now())
+
+	var rows []*Environment
+	err := r.bind(ctx).Model(&Environment{}).Set("gorm:query_option", "FOR UPDATE SKIP LOCKED").
+		Where("expires_at IS NOT NULL AND expires_at <= ?", before).
+		Where("NOT protected AND (locked_at IS NULL OR lock_expires_at <= ?)", before).
+		Order("expires_at").Limit(limit).Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		log.Error(ctx, map[string]interface{}{"err": err},
+			"unable to list the expired environments")
+		return nil, errs.WithStack(err)
+	}
+
+	return rows, nil
+}
+
 func (r *GormRepository) Load(ctx context.Context, envID uuid.UUID) (*Environment, error) {
 	defer goa.MeasureSince([]string{"goa", "db", "environment", "load"}, time.Now())
 
+	return r.load(ctx, r.bind(ctx), envID)
+}
+
+// LoadForUpdate loads the environment with the given ID and locks its row until
+// the end of the transaction, so that concurrent changes are serialized. It must be
+// called inside a transaction.
+func (r *GormRepository) LoadForUpdate(ctx context.Context, envID uuid.UUID) (*Environment, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "environment", "load_for_update"}, time.Now())
+
+	return r.load(ctx, r.bind(ctx).Set("gorm:query_option", "FOR UPDATE"), envID)
+}
+
+func (r *GormRepository) load(ctx context.Context, db *gorm.DB, envID uuid.UUID) (*Environment, error) {
 	env := Environment{}
-	tx := r.db.Model(&Environment{}).Where("id = ?", envID).First(&env)
+	tx := db.Model(&Environment{}).Where("id = ?", envID).First(&env)
 	if tx.RecordNotFound() {
 		log.Error(ctx, map[string]interface{}{"env_id": envID.String()},
 			"state or known referer was empty")
@@ -87,3 +328,24 @@ func (r *GormRepository) Load(ctx context.Context, envID uuid.UUID) (*Environmen
 
 	return &env, nil
 }
+
+// Delete soft-deletes the environment with the given ID.
+func (r *GormRepository) Delete(ctx context.Context, envID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "environment", "delete"}, time.Now())
+
+	tx := r.bind(ctx).Where("id = ?", envID).Delete(&Environment{})
+	if tx.Error != nil {
+		log.Error(ctx, map[string]interface{}{"err": tx.Error, "env_id": envID.String()},
+			"unable to delete the environment")
+		return errs.WithStack(tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return errors.NewNotFoundError("environment", envID.String())
+	}
+	return nil
+}
+
+func namespaceNameConflict(env *Environment) error {
+	return errors.NewDataConflictError(fmt.Sprintf("namespace '%s' is already used on cluster '%s'",
+		*env.NamespaceName, *env.ClusterURL))
+}
@@ -2,8 +2,11 @@ package environment_test
 
 import (
 	"context"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/fabric8-services/fabric8-common/errors"
 	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
 	"github.com/fabric8-services/fabric8-env/configuration"
 	"github.com/fabric8-services/fabric8-env/environment"
@@ -79,6 +82,77 @@ func (s *EnvironmentRepositorySuite) TestShow() {
 	assert.Equal(s.T(), newEnv.ID, env.ID)
 }
 
+func (s *EnvironmentRepositorySuite) TestLockSpace() {
+	spaceID := uuid.NewV4()
+	limit := 3
+
+	// concurrent transactions check the count under the space lock, so no more
+	// than limit environments are created
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tx := s.DB.Begin()
+			repo := environment.NewRepository(tx)
+			err := repo.LockSpace(context.Background(), spaceID)
+			if err != nil {
+				tx.Rollback()
+				return
+			}
+			count, err := repo.Count(context.Background(), spaceID)
+			if err != nil || count >= limit {
+				tx.Rollback()
+				return
+			}
+			_, err = repo.Create(context.Background(), newEnvironment("osio-stage", "stage", "cluster1.com", spaceID))
+			if err != nil {
+				tx.Rollback()
+				return
+			}
+			tx.Commit()
+		}()
+	}
+	wg.Wait()
+
+	count, err := s.envRepo.Count(context.Background(), spaceID)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), limit, count)
+}
+
+func (s *EnvironmentRepositorySuite) TestContextCancellation() {
+	env, err := s.envRepo.Create(context.Background(), newEnvironment("osio-stage", "stage", "cluster1.com", uuid.NewV4()))
+	require.NoError(s.T(), err)
+
+	s.T().Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := s.envRepo.Load(ctx, *env.ID)
+		require.Error(t, err)
+		assert.IsType(t, errors.InternalError{}, err)
+		_, err = s.envRepo.List(ctx, *env.SpaceID)
+		assert.Error(t, err)
+		_, err = s.envRepo.Create(ctx, newEnvironment("osio-run", "run", "cluster1.com", *env.SpaceID))
+		assert.Error(t, err)
+	})
+
+	s.T().Run("deadline", func(t *testing.T) {
+		// another transaction holds the lock of the space
+		holder := s.DB.Begin()
+		defer holder.Rollback()
+		require.NoError(t, environment.NewRepository(holder).LockSpace(context.Background(), *env.SpaceID))
+
+		tx := s.DB.Begin()
+		defer tx.Rollback()
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := environment.NewRepository(tx).LockSpace(ctx, *env.SpaceID)
+		assert.Error(t, err)
+		assert.True(t, time.Since(start) < 5*time.Second, "waiting for the lock must end with the deadline")
+	})
+}
+
 func newEnvironment(name, envType, clusterURL string, spaceID uuid.UUID) *environment.Environment {
 	env := &environment.Environment{
 		Name:       &name,
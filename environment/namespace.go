@@ -0,0 +1,62 @@
+package environment
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/fabric8-services/fabric8-common/errors"
+)
+
+// NamespaceNameMaxLength is the maximum length of a Kubernetes namespace name (DNS-1123 label).
+const NamespaceNameMaxLength = 63
+
+var (
+	namespaceNameRegexp     = regexp.MustCompile("^[a-z0-9]([-a-z0-9]*[a-z0-9])?$")
+	namespaceInvalidChars   = regexp.MustCompile("[^a-z0-9-]+")
+	namespaceRepeatedDashes = regexp.MustCompile("-{2,}")
+)
+
+// ValidateNamespaceName checks that the given name is a valid DNS-1123 label as
+// required by Kubernetes for namespace names.
+func ValidateNamespaceName(name string) error {
+	if len(name) > NamespaceNameMaxLength {
+		return errors.NewBadParameterError("namespaceName", name).
+			Expected(fmt.Sprintf("at most %d characters", NamespaceNameMaxLength))
+	}
+	if !namespaceNameRegexp.MatchString(name) {
+		return errors.NewBadParameterError("namespaceName", name).
+			Expected("lowercase alphanumeric characters or '-', starting and ending with an alphanumeric character")
+	}
+	return nil
+}
+
+// NamespaceNameCandidate returns the i-th namespace name derived from the given base
+// (space or user name) and the environment type. The candidates are deterministic:
+// the first one has no numeric suffix, the following ones are suffixed with i.
+func NamespaceNameCandidate(base, envType string, i int) string {
+	prefix := sanitizeNamespaceName(base)
+	envType = sanitizeNamespaceName(envType)
+	if prefix == "" {
+		prefix = "env"
+	}
+	suffix := "-" + envType
+	if envType == "" {
+		suffix = ""
+	}
+	if i > 0 {
+		suffix += "-" + strconv.Itoa(i)
+	}
+	if len(prefix)+len(suffix) > NamespaceNameMaxLength {
+		prefix = strings.TrimRight(prefix[:NamespaceNameMaxLength-len(suffix)], "-")
+	}
+	return prefix + suffix
+}
+
+func sanitizeNamespaceName(name string) string {
+	name = strings.ToLower(name)
+	name = namespaceInvalidChars.ReplaceAllString(name, "-")
+	name = namespaceRepeatedDashes.ReplaceAllString(name, "-")
+	return strings.Trim(name, "-")
+}
@@ -0,0 +1,55 @@
+package environment_test
+
+import (
+	"strings"
+	"testing"
+
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/environment"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/suite"
+)
+
+type NamespaceNameSuite struct {
+	testsuite.UnitTestSuite
+}
+
+func TestNamespaceName(t *testing.T) {
+	suite.Run(t, &NamespaceNameSuite{})
+}
+
+func (s *NamespaceNameSuite) TestValidate() {
+	s.T().Run("ok", func(t *testing.T) {
+		for _, name := range []string{"a", "osio-stage", "0-9", strings.Repeat("a", 63)} {
+			assert.NoError(t, environment.ValidateNamespaceName(name), name)
+		}
+	})
+
+	s.T().Run("invalid", func(t *testing.T) {
+		for _, name := range []string{"", "-stage", "stage-", "OSIO-stage", "osio_stage", "osio.stage", "osio stage", strings.Repeat("a", 64)} {
+			assert.Error(t, environment.ValidateNamespaceName(name), name)
+		}
+	})
+}
+
+func (s *NamespaceNameSuite) TestCandidate() {
+	s.T().Run("ok", func(t *testing.T) {
+		assert.Equal(t, "john-doe-stage", environment.NamespaceNameCandidate("John.Doe", "stage", 0))
+		assert.Equal(t, "env-run", environment.NamespaceNameCandidate("__", "run", 0))
+	})
+
+	s.T().Run("suffixed", func(t *testing.T) {
+		assert.Equal(t, "user1-stage-2", environment.NamespaceNameCandidate("user1", "stage", 2))
+	})
+
+	s.T().Run("too_long", func(t *testing.T) {
+		name := environment.NamespaceNameCandidate(strings.Repeat("a", 100), "stage", 0)
+		assert.Len(t, name, 63)
+		assert.True(t, strings.HasSuffix(name, "-stage"))
+		assert.NoError(t, environment.ValidateNamespaceName(name))
+
+		name = environment.NamespaceNameCandidate(strings.Repeat("a", 100), "stage", 12)
+		assert.Len(t, name, 63)
+		assert.True(t, strings.HasSuffix(name, "-stage-12"))
+	})
+}
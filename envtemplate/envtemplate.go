@@ -0,0 +1,219 @@
+package envtemplate
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-common/gormsupport"
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/fabric8-services/fabric8-env/gormctx"
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Placeholders which can be used in the name and namespace name of a template item.
+const (
+	PlaceholderSpace    = "{space}"
+	PlaceholderUser     = "{user}"
+	PlaceholderType     = "{type}"
+	PlaceholderTemplate = "{template}"
+)
+
+const nameUniqueConstraint = "environment_templates_name_idx"
+
+// Item is a single environment definition of a template.
+type Item struct {
+	Name          string  `json:"name"`
+	Type          string  `json:"type"`
+	ClusterURL    string  `json:"cluster-url"`
+	NamespaceName *string `json:"namespace-name,omitempty"`
+}
+
+// Items is stored as a JSON document in the environments column.
+type Items []Item
+
+func (i Items) Value() (driver.Value, error) {
+	if i == nil {
+		return []byte("[]"), nil
+	}
+	return json.Marshal(i)
+}
+
+func (i *Items) Scan(src interface{}) error {
+	var data []byte
+	switch v := src.(type) {
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	case nil:
+		*i = Items{}
+		return nil
+	default:
+		return errs.Errorf("unable to scan %T into template items", src)
+	}
+	return json.Unmarshal(data, i)
+}
+
+type Template struct {
+	gormsupport.Lifecycle
+	ID           *uuid.UUID `sql:"type:uuid default uuid_generate_v4()" gorm:"primary_key"`
+	Name         *string
+	Description  *string
+	Environments Items `sql:"type:jsonb"`
+}
+
+func (t Template) TableName() string {
+	return "environment_templates"
+}
+
+// Expand returns the template items with all placeholders replaced. The
+// {type} placeholder is replaced by the type of each item.
+func (t *Template) Expand(spaceID uuid.UUID, username string) Items {
+	res := make(Items, len(t.Environments))
+	for ind, item := range t.Environments {
+		r := strings.NewReplacer(
+			PlaceholderSpace, spaceID.String(),
+			PlaceholderUser, username,
+			PlaceholderType, item.Type,
+			PlaceholderTemplate, *t.Name,
+		)
+		expanded := Item{
+			Name:       r.Replace(item.Name),
+			Type:       item.Type,
+			ClusterURL: item.ClusterURL,
+		}
+		if item.NamespaceName != nil {
+			namespaceName := r.Replace(*item.NamespaceName)
+			expanded.NamespaceName = &namespaceName
+		}
+		res[ind] = expanded
+	}
+	return res
+}
+
+type Repository interface {
+	Create(ctx context.Context, tmpl *Template) (*Template, error)
+	Save(ctx context.Context, tmpl *Template) (*Template, error)
+	Delete(ctx context.Context, tmplID uuid.UUID) error
+	List(ctx context.Context) ([]*Template, error)
+	Load(ctx context.Context, tmplID uuid.UUID) (*Template, error)
+	LoadByName(ctx context.Context, name string) (*Template, error)
+}
+
+type GormRepository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *GormRepository {
+	return &GormRepository{
+		db: db,
+	}
+}
+
+func (r *GormRepository) bind(ctx context.Context) *gorm.DB {
+	return gormctx.Bind(ctx, r.db)
+}
+
+func (r *GormRepository) Create(ctx context.Context, tmpl *Template) (*Template, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "template", "create"}, time.Now())
+
+	err := r.bind(ctx).Create(tmpl).Error
+	if err != nil {
+		if gormsupport.IsUniqueViolation(err, nameUniqueConstraint) {
+			return nil, errors.NewDataConflictError(fmt.Sprintf("template with name '%s' already exists", *tmpl.Name))
+		}
+		log.Error(ctx, map[string]interface{}{"err": err},
+			"unable to create the template")
+		return nil, errs.WithStack(err)
+	}
+
+	return tmpl, nil
+}
+
+func (r *GormRepository) Save(ctx context.Context, tmpl *Template) (*Template, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "template", "save"}, time.Now())
+
+	tx := r.bind(ctx).Model(&Template{}).Where("id = ?", tmpl.ID).Updates(map[string]interface{}{
+		"name":         tmpl.Name,
+		"description":  tmpl.Description,
+		"environments": tmpl.Environments,
+	})
+	if tx.Error != nil {
+		if gormsupport.IsUniqueViolation(tx.Error, nameUniqueConstraint) {
+			return nil, errors.NewDataConflictError(fmt.Sprintf("template with name '%s' already exists", *tmpl.Name))
+		}
+		log.Error(ctx, map[string]interface{}{"err": tx.Error, "template_id": tmpl.ID.String()},
+			"unable to save the template")
+		return nil, errs.WithStack(tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return nil, errors.NewNotFoundError("template", tmpl.ID.String())
+	}
+
+	return r.Load(ctx, *tmpl.ID)
+}
+
+func (r *GormRepository) Delete(ctx context.Context, tmplID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "template", "delete"}, time.Now())
+
+	tx := r.bind(ctx).Where("id = ?", tmplID).Delete(&Template{})
+	if tx.Error != nil {
+		log.Error(ctx, map[string]interface{}{"err": tx.Error, "template_id": tmplID.String()},
+			"unable to delete the template")
+		return errs.WithStack(tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return errors.NewNotFoundError("template", tmplID.String())
+	}
+	return nil
+}
+
+func (r *GormRepository) List(ctx context.Context) ([]*Template, error) {
+	var rows []*Template
+
+	err := r.bind(ctx).Model(&Template{}).Order("name").Find(&rows).Error
+	if err != nil && err != gorm.ErrRecordNotFound {
+		log.Error(ctx, map[string]interface{}{"err": err},
+			"unable to list the templates")
+		return nil, errs.WithStack(err)
+	}
+
+	return rows, nil
+}
+
+func (r *GormRepository) Load(ctx context.Context, tmplID uuid.UUID) (*Template, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "template", "load"}, time.Now())
+
+	return r.load(ctx, "id = ?", tmplID, tmplID.String())
+}
+
+func (r *GormRepository) LoadByName(ctx context.Context, name string) (*Template, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "template", "load_by_name"}, time.Now())
+
+	return r.load(ctx, "name = ?", name, name)
+}
+
+func (r *GormRepository) load(ctx context.Context, query string, arg interface{}, key string) (*Template, error) {
+	tmpl := Template{}
+	tx := r.bind(ctx).Model(&Template{}).Where(query, arg).First(&tmpl)
+	if tx.RecordNotFound() {
+		log.Error(ctx, map[string]interface{}{"template": key},
+			"template not found")
+		return nil, errors.NewNotFoundError("template", key)
+	}
+	if tx.Error != nil {
+		log.Error(ctx, map[string]interface{}{"err": tx.Error, "template": key},
+			"unable to load the template")
+		return nil, errors.NewInternalError(ctx, tx.Error)
+	}
+
+	return &tmpl, nil
+}
@@ -0,0 +1,116 @@
+package envtemplate_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/fabric8-services/fabric8-common/convert/ptr"
+	"github.com/fabric8-services/fabric8-common/errors"
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/configuration"
+	"github.com/fabric8-services/fabric8-env/envtemplate"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type TemplateRepositorySuite struct {
+	testsuite.DBTestSuite
+	tmplRepo *envtemplate.GormRepository
+}
+
+func TestTemplateRepository(t *testing.T) {
+	config, err := configuration.New("")
+	require.NoError(t, err)
+	suite.Run(t, &TemplateRepositorySuite{DBTestSuite: testsuite.NewDBTestSuite(config)})
+}
+
+func (s *TemplateRepositorySuite) SetupSuite() {
+	s.DBTestSuite.SetupSuite()
+
+	s.tmplRepo = envtemplate.NewRepository(s.DB)
+}
+
+func (s *TemplateRepositorySuite) TestCreate() {
+	s.T().Run("ok", func(t *testing.T) {
+		tmpl, err := s.tmplRepo.Create(context.Background(), newTemplate("create-"+uuid.NewV4().String()))
+		require.NoError(t, err)
+		require.NotNil(t, tmpl.ID)
+
+		loaded, err := s.tmplRepo.Load(context.Background(), *tmpl.ID)
+		require.NoError(t, err)
+		assert.Equal(t, *tmpl.Name, *loaded.Name)
+		require.Len(t, loaded.Environments, 2)
+		assert.Equal(t, "{space}-{type}", *loaded.Environments[0].NamespaceName)
+	})
+
+	s.T().Run("duplicate_name", func(t *testing.T) {
+		name := "duplicate-" + uuid.NewV4().String()
+		_, err := s.tmplRepo.Create(context.Background(), newTemplate(name))
+		require.NoError(t, err)
+
+		_, err = s.tmplRepo.Create(context.Background(), newTemplate(name))
+		require.Error(t, err)
+		assert.IsType(t, errors.DataConflictError{}, err)
+	})
+}
+
+func (s *TemplateRepositorySuite) TestLoadByName() {
+	name := "by-name-" + uuid.NewV4().String()
+	tmpl, err := s.tmplRepo.Create(context.Background(), newTemplate(name))
+	require.NoError(s.T(), err)
+
+	loaded, err := s.tmplRepo.LoadByName(context.Background(), name)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), tmpl.ID, loaded.ID)
+
+	_, err = s.tmplRepo.LoadByName(context.Background(), "unknown-"+uuid.NewV4().String())
+	require.Error(s.T(), err)
+	assert.IsType(s.T(), errors.NotFoundError{}, err)
+}
+
+func (s *TemplateRepositorySuite) TestSaveAndDelete() {
+	tmpl, err := s.tmplRepo.Create(context.Background(), newTemplate("save-"+uuid.NewV4().String()))
+	require.NoError(s.T(), err)
+
+	tmpl.Description = ptr.String("updated")
+	tmpl.Environments = tmpl.Environments[:1]
+	saved, err := s.tmplRepo.Save(context.Background(), tmpl)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), "updated", *saved.Description)
+	assert.Len(s.T(), saved.Environments, 1)
+
+	err = s.tmplRepo.Delete(context.Background(), *tmpl.ID)
+	require.NoError(s.T(), err)
+	_, err = s.tmplRepo.Load(context.Background(), *tmpl.ID)
+	assert.IsType(s.T(), errors.NotFoundError{}, err)
+
+	err = s.tmplRepo.Delete(context.Background(), *tmpl.ID)
+	assert.IsType(s.T(), errors.NotFoundError{}, err)
+}
+
+func (s *TemplateRepositorySuite) TestExpand() {
+	spaceID := uuid.NewV4()
+	tmpl := newTemplate("standard-pipeline")
+
+	items := tmpl.Expand(spaceID, "user1")
+
+	require.Len(s.T(), items, 2)
+	assert.Equal(s.T(), "user1-stage", items[0].Name)
+	assert.Equal(s.T(), spaceID.String()+"-stage", *items[0].NamespaceName)
+	assert.Equal(s.T(), "standard-pipeline-run", items[1].Name)
+	assert.Nil(s.T(), items[1].NamespaceName)
+	// the template itself is left untouched
+	assert.Equal(s.T(), "{user}-{type}", tmpl.Environments[0].Name)
+}
+
+func newTemplate(name string) *envtemplate.Template {
+	return &envtemplate.Template{
+		Name: &name,
+		Environments: envtemplate.Items{
+			{Name: "{user}-{type}", Type: "stage", ClusterURL: "cluster1.com", NamespaceName: ptr.String("{space}-{type}")},
+			{Name: "{template}-{type}", Type: "run", ClusterURL: "cluster1.com"},
+		},
+	}
+}
@@ -1,11 +1,17 @@
 package gormapp
 
 import (
+	"context"
 	"fmt"
 	"strconv"
 
 	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/audit"
 	"github.com/fabric8-services/fabric8-env/environment"
+	"github.com/fabric8-services/fabric8-env/envtemplate"
+	"github.com/fabric8-services/fabric8-env/gormctx"
+	"github.com/fabric8-services/fabric8-env/idempotency"
+	"github.com/fabric8-services/fabric8-env/quota"
 	"github.com/jinzhu/gorm"
 	"github.com/pkg/errors"
 )
@@ -25,10 +31,33 @@ var _ application.DB = &GormDB{}
 
 var _ application.Transaction = &GormTransaction{}
 
-func NewGormDB(db *gorm.DB) *GormDB {
+// Option configures a GormDB.
+type Option func(g *GormDB)
+
+// WithReplica sends the reads of environments made outside of transactions to
+// the replica while it is healthy.
+func WithReplica(replica *Replica) Option {
+	return func(g *GormDB) {
+		g.replica = replica
+	}
+}
+
+// WithEnvironmentCache loads the environments through the cache outside of
+// transactions, and invalidates the environments changed in transactions once
+// they are committed.
+func WithEnvironmentCache(cache *environment.Cache) Option {
+	return func(g *GormDB) {
+		g.cache = cache
+	}
+}
+
+func NewGormDB(db *gorm.DB, options ...Option) *GormDB {
 	g := new(GormDB)
 	g.db = db.Set("gorm:save_associations", false)
 	g.txIsoLevel = ""
+	for _, opt := range options {
+		opt(g)
+	}
 	return g
 }
 
@@ -39,16 +68,23 @@ type GormBase struct {
 type GormDB struct {
 	GormBase
 	txIsoLevel string
+	replica    *Replica
+	cache      *environment.Cache
 }
 
 type GormTransaction struct {
 	GormBase
+	cache *environment.CacheTransaction
 }
 
 func (g *GormBase) DB() *gorm.DB {
 	return g.db
 }
 
+// SetTransactionIsolationLevel sets the isolation level of the transactions
+// begun afterwards. It stays opt-in: the service runs at the default READ
+// COMMITTED level and locks the rows it updates (SELECT ... FOR UPDATE), while
+// Transactional retries the serialization failures of a stricter level.
 // See https://www.postgresql.org/docs/9.3/static/sql-set-transaction.html
 func (g *GormDB) SetTransactionIsolationLevel(level TXIsoLevel) error {
 	switch level {
@@ -66,24 +102,31 @@ func (g *GormDB) SetTransactionIsolationLevel(level TXIsoLevel) error {
 	return nil
 }
 
-func (g *GormDB) BeginTransaction() (application.Transaction, error) {
-	tx := g.db.Begin()
+func (g *GormDB) BeginTransaction(ctx context.Context) (application.Transaction, error) {
+	tx := gormctx.Bind(ctx, g.db).Begin()
 	if tx.Error != nil {
 		return nil, tx.Error
 	}
 	if len(g.txIsoLevel) != 0 {
-		tx := tx.Exec(fmt.Sprintf("set transaction isolation level %s", g.txIsoLevel))
-		if tx.Error != nil {
-			return nil, tx.Error
+		if err := tx.Exec(fmt.Sprintf("set transaction isolation level %s", g.txIsoLevel)).Error; err != nil {
+			tx.Rollback()
+			return nil, err
 		}
-		return &GormTransaction{GormBase{tx}}, nil
 	}
-	return &GormTransaction{GormBase{tx}}, nil
+	res := &GormTransaction{GormBase: GormBase{tx}}
+	if g.cache != nil {
+		res.cache = g.cache.BeginTransaction()
+	}
+	return res, nil
 }
 
 func (g *GormTransaction) Commit() error {
 	err := g.db.Commit().Error
 	g.db = nil
+	if g.cache != nil {
+		// also when the commit failed, its outcome is unknown
+		g.cache.End()
+	}
 	return errors.WithStack(err)
 }
 
@@ -96,3 +139,42 @@ func (g *GormTransaction) Rollback() error {
 func (g *GormBase) Environments() environment.Repository {
 	return environment.NewRepository(g.db)
 }
+
+// Environments returns a repository reading through the cache and from the
+// replica if there are, the transactions always read from the primary.
+func (g *GormDB) Environments() environment.Repository {
+	primary := environment.NewRepository(g.db)
+	var repo environment.Repository = primary
+	if g.replica != nil {
+		repo = &replicaRepository{GormRepository: primary, replica: g.replica}
+	}
+	if g.cache != nil {
+		// an environment loaded from a lagging replica would stay stale in the
+		// cache until it expires, so the cache misses are loaded from the primary
+		repo = g.cache.Repository(&primaryLoadRepository{Repository: repo, primary: primary})
+	}
+	return repo
+}
+
+func (g *GormTransaction) Environments() environment.Repository {
+	if g.cache == nil {
+		return g.GormBase.Environments()
+	}
+	return g.cache.Repository(environment.NewRepository(g.db))
+}
+
+func (g *GormBase) Templates() envtemplate.Repository {
+	return envtemplate.NewRepository(g.db)
+}
+
+func (g *GormBase) AuditLogs() audit.Repository {
+	return audit.NewRepository(g.db)
+}
+
+func (g *GormBase) SpaceQuotas() quota.Repository {
+	return quota.NewRepository(g.db)
+}
+
+func (g *GormBase) IdempotencyKeys() idempotency.Repository {
+	return idempotency.NewRepository(g.db)
+}
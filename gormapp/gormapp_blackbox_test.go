@@ -0,0 +1,29 @@
+package gormapp_test
+
+import (
+	"testing"
+
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/application/apptest"
+	"github.com/fabric8-services/fabric8-env/configuration"
+	"github.com/fabric8-services/fabric8-env/gormapp"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type GormDBSuite struct {
+	testsuite.DBTestSuite
+}
+
+func TestGormDB(t *testing.T) {
+	config, err := configuration.New("")
+	require.NoError(t, err)
+	suite.Run(t, &GormDBSuite{DBTestSuite: testsuite.NewDBTestSuite(config)})
+}
+
+func (s *GormDBSuite) TestConformance() {
+	apptest.RunConformanceTests(s.T(), func() application.DB {
+		return gormapp.NewGormDB(s.DB)
+	})
+}
@@ -0,0 +1,198 @@
+package gormapp
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/fabric8-services/fabric8-env/environment"
+	"github.com/fabric8-services/fabric8-env/gormctx"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// lagQuery returns how many seconds the replica is behind the primary. A
+// replica which replayed all it received is not lagging, even if the primary
+// had no transaction for a while. A server which is not a replica has no lag.
+const lagQuery = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() OR pg_last_xlog_receive_location() = pg_last_xlog_replay_location() THEN 0
+	ELSE COALESCE(EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp()), 0)
+	END`
+
+// Replica is a read replica of the database. It is used for reads only while
+// it is healthy, i.e. while it answers and does not lag behind the primary by
+// more than the maximum lag.
+type Replica struct {
+	open   func() (*gorm.DB, error)
+	maxLag time.Duration
+
+	mu      sync.RWMutex
+	db      *gorm.DB
+	healthy bool
+}
+
+// NewReplica returns a Replica connected with open, which is called again by
+// the checks until it succeeds. The replica is unhealthy until the first check.
+func NewReplica(open func() (*gorm.DB, error), maxLag time.Duration) *Replica {
+	return &Replica{
+		open:   open,
+		maxLag: maxLag,
+	}
+}
+
+// Check connects to the replica if needed and measures its lag. It returns
+// an error and marks the replica as unhealthy if it does not answer or lags
+// too much.
+func (r *Replica) Check(ctx context.Context) error {
+	db, err := r.connect()
+	if err == nil {
+		err = r.checkLag(ctx, db)
+	}
+	r.setHealthy(ctx, err)
+	return err
+}
+
+// Watch checks the replica now and then every interval in the background,
+// until ctx is done.
+func (r *Replica) Watch(ctx context.Context, interval time.Duration) {
+	go func() {
+		r.Check(ctx)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.Check(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Healthy returns true if the reads are sent to the replica.
+func (r *Replica) Healthy() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.healthy
+}
+
+// Close closes the connections to the replica.
+func (r *Replica) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.healthy = false
+	if r.db == nil {
+		return nil
+	}
+	err := r.db.Close()
+	r.db = nil
+	return errs.WithStack(err)
+}
+
+// connect returns the connection to the replica, opening it if needed. The
+// reads are not blocked while it is opened.
+func (r *Replica) connect() (*gorm.DB, error) {
+	r.mu.RLock()
+	db := r.db
+	r.mu.RUnlock()
+	if db != nil {
+		return db, nil
+	}
+	db, err := r.open()
+	if err != nil {
+		return nil, errs.Wrap(err, "unable to connect to the replica")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.db != nil {
+		// opened by a concurrent check
+		db.Close()
+		return r.db, nil
+	}
+	r.db = db.Set("gorm:save_associations", false)
+	return r.db, nil
+}
+
+func (r *Replica) checkLag(ctx context.Context, db *gorm.DB) error {
+	var lag float64
+	if err := gormctx.Bind(ctx, db).Raw(lagQuery).Row().Scan(&lag); err != nil {
+		return errs.Wrap(err, "unable to measure the lag of the replica")
+	}
+	if d := time.Duration(lag * float64(time.Second)); r.maxLag > 0 && d > r.maxLag {
+		return errs.Errorf("replica lags %v behind the primary, more than %v", d, r.maxLag)
+	}
+	return nil
+}
+
+func (r *Replica) setHealthy(ctx context.Context, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	healthy := err == nil && r.db != nil
+	if healthy == r.healthy {
+		return
+	}
+	r.healthy = healthy
+	if healthy {
+		log.Info(ctx, nil, "reading from the replica")
+	} else {
+		log.Warn(ctx, map[string]interface{}{"err": err},
+			"reading from the primary, the replica is unhealthy")
+	}
+}
+
+// get returns the replica if it is healthy, or nil.
+func (r *Replica) get() *gorm.DB {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.healthy {
+		return nil
+	}
+	return r.db
+}
+
+// replicaRepository reads the environments from the replica while it is
+// healthy and falls back to the primary otherwise.
+type replicaRepository struct {
+	*environment.GormRepository
+	replica *Replica
+}
+
+func (r *replicaRepository) List(ctx context.Context, spaceID uuid.UUID) ([]*environment.Environment, error) {
+	if db := r.replica.get(); db != nil {
+		envs, err := environment.NewRepository(db).List(ctx, spaceID)
+		if err == nil || ctx.Err() != nil {
+			return envs, err
+		}
+		r.replica.setHealthy(ctx, err)
+	}
+	return r.GormRepository.List(ctx, spaceID)
+}
+
+func (r *replicaRepository) Load(ctx context.Context, envID uuid.UUID) (*environment.Environment, error) {
+	if db := r.replica.get(); db != nil {
+		env, err := environment.NewRepository(db).Load(ctx, envID)
+		if err == nil || ctx.Err() != nil {
+			return env, err
+		}
+		// an environment which was just created may not be replicated yet
+		if _, notFound := errs.Cause(err).(errors.NotFoundError); !notFound {
+			r.replica.setHealthy(ctx, err)
+		}
+	}
+	return r.GormRepository.Load(ctx, envID)
+}
+
+// primaryLoadRepository loads the environments by ID from the primary and
+// reads the others from next.
+type primaryLoadRepository struct {
+	environment.Repository
+	primary *environment.GormRepository
+}
+
+func (r *primaryLoadRepository) Load(ctx context.Context, envID uuid.UUID) (*environment.Environment, error) {
+	return r.primary.Load(ctx, envID)
+}
@@ -0,0 +1,149 @@
+package gormapp_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/errors"
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/configuration"
+	"github.com/fabric8-services/fabric8-env/environment"
+	"github.com/fabric8-services/fabric8-env/gormapp"
+	"github.com/fabric8-services/fabric8-env/pubsub"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ReplicaSuite struct {
+	testsuite.DBTestSuite
+	config *configuration.Registry
+}
+
+func TestReplica(t *testing.T) {
+	config, err := configuration.New("")
+	require.NoError(t, err)
+	suite.Run(t, &ReplicaSuite{DBTestSuite: testsuite.NewDBTestSuite(config), config: config})
+}
+
+// newReplica returns a replica connected to the test database, which is not
+// lagging. The extra connection parameters are appended to the DSN.
+func (s *ReplicaSuite) newReplica(params string) *gormapp.Replica {
+	return gormapp.NewReplica(func() (*gorm.DB, error) {
+		return gorm.Open("postgres", s.config.GetPostgresConfigString()+params)
+	}, time.Second)
+}
+
+func (s *ReplicaSuite) createEnvironment() *environment.Environment {
+	spaceID := uuid.NewV4()
+	name, envType, clusterURL := "osio-stage", "stage", "cluster1.com"
+	env, err := environment.NewRepository(s.DB).Create(context.Background(), &environment.Environment{
+		Name:       &name,
+		Type:       &envType,
+		SpaceID:    &spaceID,
+		ClusterURL: &clusterURL,
+	})
+	require.NoError(s.T(), err)
+	return env
+}
+
+func (s *ReplicaSuite) TestCheck() {
+	s.T().Run("healthy", func(t *testing.T) {
+		replica := s.newReplica("")
+		defer replica.Close()
+		assert.False(t, replica.Healthy(), "unhealthy until checked")
+		require.NoError(t, replica.Check(context.Background()))
+		assert.True(t, replica.Healthy())
+	})
+
+	s.T().Run("unreachable", func(t *testing.T) {
+		replica := gormapp.NewReplica(func() (*gorm.DB, error) {
+			return nil, errs.New("connection refused")
+		}, time.Second)
+		err := replica.Check(context.Background())
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "unable to connect to the replica")
+		assert.False(t, replica.Healthy())
+	})
+}
+
+func (s *ReplicaSuite) TestReadFromReplica() {
+	replica := s.newReplica("")
+	defer replica.Close()
+	require.NoError(s.T(), replica.Check(context.Background()))
+	db := gormapp.NewGormDB(s.DB, gormapp.WithReplica(replica))
+	env := s.createEnvironment()
+
+	s.T().Run("load", func(t *testing.T) {
+		loaded, err := db.Environments().Load(context.Background(), *env.ID)
+		require.NoError(t, err)
+		assert.Equal(t, *env.ID, *loaded.ID)
+		assert.True(t, replica.Healthy())
+	})
+
+	s.T().Run("list", func(t *testing.T) {
+		envs, err := db.Environments().List(context.Background(), *env.SpaceID)
+		require.NoError(t, err)
+		require.Len(t, envs, 1)
+		assert.True(t, replica.Healthy())
+	})
+
+	s.T().Run("not found", func(t *testing.T) {
+		_, err := db.Environments().Load(context.Background(), uuid.NewV4())
+		require.Error(t, err)
+		assert.IsType(t, errors.NotFoundError{}, errs.Cause(err))
+		assert.True(t, replica.Healthy(), "a missing environment may not be replicated yet")
+	})
+}
+
+func (s *ReplicaSuite) TestFallbackToPrimary() {
+	// the replica answers the checks but has no environments table
+	replica := s.newReplica(" search_path=missing")
+	defer replica.Close()
+	db := gormapp.NewGormDB(s.DB, gormapp.WithReplica(replica))
+	env := s.createEnvironment()
+
+	s.T().Run("unhealthy replica", func(t *testing.T) {
+		loaded, err := db.Environments().Load(context.Background(), *env.ID)
+		require.NoError(t, err)
+		assert.Equal(t, *env.ID, *loaded.ID)
+	})
+
+	s.T().Run("transactions read from the primary", func(t *testing.T) {
+		require.NoError(t, replica.Check(context.Background()))
+		err := application.Transactional(context.Background(), db, func(appl application.Application) error {
+			_, err := appl.Environments().Load(context.Background(), *env.ID)
+			return err
+		})
+		require.NoError(t, err)
+		assert.True(t, replica.Healthy())
+	})
+
+	s.T().Run("cache misses loaded from the primary", func(t *testing.T) {
+		cached := gormapp.NewGormDB(s.DB, gormapp.WithReplica(replica),
+			gormapp.WithEnvironmentCache(environment.NewCache(pubsub.NewLocal(), time.Minute, 100)))
+		require.NoError(t, replica.Check(context.Background()))
+		loaded, err := cached.Environments().Load(context.Background(), *env.ID)
+		require.NoError(t, err)
+		assert.Equal(t, *env.ID, *loaded.ID)
+		assert.True(t, replica.Healthy(), "the replica is not read")
+	})
+
+	s.T().Run("failing replica", func(t *testing.T) {
+		require.NoError(t, replica.Check(context.Background()))
+		envs, err := db.Environments().List(context.Background(), *env.SpaceID)
+		require.NoError(t, err)
+		require.Len(t, envs, 1)
+		assert.False(t, replica.Healthy(), "the failed read marks the replica as unhealthy")
+
+		require.NoError(t, replica.Check(context.Background()))
+		_, err = db.Environments().Load(context.Background(), *env.ID)
+		require.NoError(t, err)
+		assert.False(t, replica.Healthy())
+	})
+}
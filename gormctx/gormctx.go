@@ -0,0 +1,112 @@
+package gormctx
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/jinzhu/gorm"
+)
+
+// Bind returns a copy of db running its statements with ctx, so that they are
+// cancelled when ctx is done or its deadline expires. Transactions begun with
+// the copy are bound to ctx as well and rolled back when it is done. The copy
+// keeps the settings, callbacks and values of db. db is returned as is if ctx is
+// nil.
+func Bind(ctx context.Context, db *gorm.DB) *gorm.DB {
+	if ctx == nil {
+		return db
+	}
+	var common gorm.SQLCommon
+	switch c := db.CommonDB().(type) {
+	case *sql.DB:
+		common = &conn{ctx: ctx, db: c}
+	case *sql.Tx:
+		common = &tx{ctx: ctx, tx: c}
+	case *conn:
+		common = &conn{ctx: ctx, db: c.db}
+	case *tx:
+		common = &tx{ctx: ctx, tx: c.tx}
+	default:
+		return db
+	}
+	bound := db.New()
+	if !setCommonDB(bound, common) {
+		log.Error(ctx, map[string]interface{}{"type": fmt.Sprintf("%T", db)},
+			"unable to bind the database to the context")
+		return db
+	}
+	return bound
+}
+
+// setCommonDB replaces the connection of db, which gorm does not allow to set
+// on a clone. It returns false if the gorm version has no such field.
+func setCommonDB(db *gorm.DB, common gorm.SQLCommon) bool {
+	field := reflect.ValueOf(db).Elem().FieldByName("db")
+	if !field.IsValid() || !reflect.TypeOf(common).AssignableTo(field.Type()) {
+		return false
+	}
+	reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem().Set(reflect.ValueOf(common))
+	return true
+}
+
+// conn runs the statements of a connection pool with a context.
+type conn struct {
+	ctx context.Context
+	db  *sql.DB
+}
+
+func (c *conn) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.db.ExecContext(c.ctx, query, args...)
+}
+
+func (c *conn) Prepare(query string) (*sql.Stmt, error) {
+	return c.db.PrepareContext(c.ctx, query)
+}
+
+func (c *conn) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(c.ctx, query, args...)
+}
+
+func (c *conn) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRowContext(c.ctx, query, args...)
+}
+
+// Begin is called by gorm.DB.Begin.
+func (c *conn) Begin() (*sql.Tx, error) {
+	return c.db.BeginTx(c.ctx, nil)
+}
+
+// tx runs the statements of a transaction with a context.
+type tx struct {
+	ctx context.Context
+	tx  *sql.Tx
+}
+
+func (t *tx) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.tx.ExecContext(t.ctx, query, args...)
+}
+
+func (t *tx) Prepare(query string) (*sql.Stmt, error) {
+	return t.tx.PrepareContext(t.ctx, query)
+}
+
+func (t *tx) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.tx.QueryContext(t.ctx, query, args...)
+}
+
+func (t *tx) QueryRow(query string, args ...interface{}) *sql.Row {
+	return t.tx.QueryRowContext(t.ctx, query, args...)
+}
+
+// Commit and Rollback are called by gorm.DB.Commit and gorm.DB.Rollback.
+func (t *tx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t *tx) Rollback() error {
+	return t.tx.Rollback()
+}
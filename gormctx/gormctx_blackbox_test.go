@@ -0,0 +1,64 @@
+package gormctx_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/configuration"
+	"github.com/fabric8-services/fabric8-env/gormctx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type GormContextSuite struct {
+	testsuite.DBTestSuite
+}
+
+func TestGormContext(t *testing.T) {
+	config, err := configuration.New("")
+	require.NoError(t, err)
+	suite.Run(t, &GormContextSuite{DBTestSuite: testsuite.NewDBTestSuite(config)})
+}
+
+func (s *GormContextSuite) TestBind() {
+	s.T().Run("ok", func(t *testing.T) {
+		var result struct{ Answer int }
+		err := gormctx.Bind(context.Background(), s.DB).Raw("SELECT 42 AS answer").Scan(&result).Error
+		require.NoError(t, err)
+		assert.Equal(t, 42, result.Answer)
+	})
+
+	s.T().Run("deadline cancels the statement", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err := gormctx.Bind(ctx, s.DB).Exec("SELECT pg_sleep(10)").Error
+		require.Error(t, err)
+		assert.True(t, time.Since(start) < 5*time.Second)
+	})
+
+	s.T().Run("transaction bound to the context", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		tx := gormctx.Bind(ctx, s.DB).Begin()
+		require.NoError(t, tx.Error)
+		require.NoError(t, tx.Exec("SELECT 1").Error)
+		cancel()
+		// the transaction is rolled back when the context is done
+		time.Sleep(10 * time.Millisecond)
+		assert.Error(t, tx.Commit().Error)
+	})
+
+	s.T().Run("values kept", func(t *testing.T) {
+		db := s.DB.Set("gorm:save_associations", false)
+		value, ok := gormctx.Bind(context.Background(), db).Get("gorm:save_associations")
+		require.True(t, ok)
+		assert.Equal(t, false, value)
+	})
+
+	s.T().Run("nil context", func(t *testing.T) {
+		assert.Equal(t, s.DB, gormctx.Bind(nil, s.DB))
+	})
+}
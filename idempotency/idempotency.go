@@ -0,0 +1,122 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-common/gormsupport"
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/fabric8-services/fabric8-env/gormctx"
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// Record is the response stored for an idempotency key sent by a client, so
+// retries of the same request can be answered without repeating it.
+type Record struct {
+	gormsupport.Lifecycle
+	SpaceID        uuid.UUID `sql:"type:uuid" gorm:"primary_key"`
+	Key            string    `gorm:"primary_key"`
+	RequestHash    string
+	ResponseStatus int
+	ResponseBody   string
+	ExpiresAt      time.Time
+}
+
+func (r Record) TableName() string {
+	return "idempotency_keys"
+}
+
+// Hash returns the hash of the given request parts, which is compared to detect a
+// key reused for a different request.
+func Hash(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		// the length prefix keeps ("ab", "c") and ("a", "bc") apart
+		fmt.Fprintf(h, "%d:", len(part))
+		h.Write(part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+type Repository interface {
+	// Load returns the record of the given key, or a NotFoundError if there is
+	// none or it expired.
+	Load(ctx context.Context, spaceID uuid.UUID, key string, now time.Time) (*Record, error)
+	// Create stores the record, or returns a DataConflictError if an unexpired
+	// record with the same key exists.
+	Create(ctx context.Context, r *Record, now time.Time) error
+	DeleteExpired(ctx context.Context, before time.Time) (int, error)
+}
+
+type GormRepository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *GormRepository {
+	return &GormRepository{
+		db: db,
+	}
+}
+
+func (r *GormRepository) bind(ctx context.Context) *gorm.DB {
+	return gormctx.Bind(ctx, r.db)
+}
+
+func (r *GormRepository) Load(ctx context.Context, spaceID uuid.UUID, key string, now time.Time) (*Record, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "idempotency", "load"}, time.Now())
+
+	rec := Record{}
+	tx := r.bind(ctx).Model(&Record{}).Where("space_id = ? AND key = ? AND expires_at > ?", spaceID, key, now).First(&rec)
+	if tx.RecordNotFound() {
+		return nil, errors.NewNotFoundError("idempotency key", key)
+	}
+	if tx.Error != nil {
+		log.Error(ctx, map[string]interface{}{"err": tx.Error, "space_id": spaceID.String()},
+			"unable to load the idempotency key")
+		return nil, errs.WithStack(tx.Error)
+	}
+	return &rec, nil
+}
+
+func (r *GormRepository) Create(ctx context.Context, rec *Record, now time.Time) error {
+	defer goa.MeasureSince([]string{"goa", "db", "idempotency", "create"}, time.Now())
+
+	// an expired record of the same key is replaced
+	tx := r.bind(ctx).Exec(`INSERT INTO idempotency_keys (created_at, updated_at, space_id, key, request_hash, response_status, response_body, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (space_id, key) DO UPDATE SET created_at = EXCLUDED.created_at, updated_at = EXCLUDED.updated_at, deleted_at = NULL,
+			request_hash = EXCLUDED.request_hash, response_status = EXCLUDED.response_status,
+			response_body = EXCLUDED.response_body, expires_at = EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= ?`,
+		now, now, rec.SpaceID, rec.Key, rec.RequestHash, rec.ResponseStatus, rec.ResponseBody, rec.ExpiresAt, now)
+	if tx.Error != nil {
+		log.Error(ctx, map[string]interface{}{"err": tx.Error, "space_id": rec.SpaceID.String()},
+			"unable to create the idempotency key")
+		return errs.WithStack(tx.Error)
+	}
+	if tx.RowsAffected == 0 {
+		return errors.NewDataConflictError(fmt.Sprintf("idempotency key '%s' is already used", rec.Key))
+	}
+	return nil
+}
+
+// DeleteExpired removes the records which expired before the given time and
+// returns their number.
+func (r *GormRepository) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "idempotency", "delete_expired"}, time.Now())
+
+	tx := r.bind(ctx).Unscoped().Where("expires_at <= ?", before).Delete(&Record{})
+	if tx.Error != nil {
+		log.Error(ctx, map[string]interface{}{"err": tx.Error},
+			"unable to delete the expired idempotency keys")
+		return 0, errs.WithStack(tx.Error)
+	}
+	return int(tx.RowsAffected), nil
+}
@@ -0,0 +1,106 @@
+package idempotency_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/errors"
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/configuration"
+	"github.com/fabric8-services/fabric8-env/idempotency"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type IdempotencyRepositorySuite struct {
+	testsuite.DBTestSuite
+	repo *idempotency.GormRepository
+}
+
+func TestIdempotencyRepository(t *testing.T) {
+	config, err := configuration.New("")
+	require.NoError(t, err)
+	suite.Run(t, &IdempotencyRepositorySuite{DBTestSuite: testsuite.NewDBTestSuite(config)})
+}
+
+func (s *IdempotencyRepositorySuite) SetupSuite() {
+	s.DBTestSuite.SetupSuite()
+
+	s.repo = idempotency.NewRepository(s.DB)
+}
+
+func (s *IdempotencyRepositorySuite) TestCreateAndLoad() {
+	ctx := context.Background()
+	now := time.Now()
+	spaceID := uuid.NewV4()
+	key := uuid.NewV4().String()
+
+	err := s.repo.Create(ctx, newRecord(spaceID, key, "hash1", now.Add(time.Hour)), now)
+	require.NoError(s.T(), err)
+
+	s.T().Run("load_ok", func(t *testing.T) {
+		rec, err := s.repo.Load(ctx, spaceID, key, now)
+		require.NoError(t, err)
+		assert.Equal(t, "hash1", rec.RequestHash)
+		assert.Equal(t, 201, rec.ResponseStatus)
+	})
+
+	s.T().Run("load_other_space", func(t *testing.T) {
+		_, err := s.repo.Load(ctx, uuid.NewV4(), key, now)
+		assert.IsType(t, errors.NotFoundError{}, err)
+	})
+
+	s.T().Run("create_conflict", func(t *testing.T) {
+		err := s.repo.Create(ctx, newRecord(spaceID, key, "hash2", now.Add(time.Hour)), now)
+		assert.IsType(t, errors.DataConflictError{}, err)
+	})
+
+	s.T().Run("expired", func(t *testing.T) {
+		later := now.Add(2 * time.Hour)
+		_, err := s.repo.Load(ctx, spaceID, key, later)
+		assert.IsType(t, errors.NotFoundError{}, err)
+
+		// an expired key can be used again
+		err = s.repo.Create(ctx, newRecord(spaceID, key, "hash2", later.Add(time.Hour)), later)
+		require.NoError(t, err)
+		rec, err := s.repo.Load(ctx, spaceID, key, later)
+		require.NoError(t, err)
+		assert.Equal(t, "hash2", rec.RequestHash)
+	})
+}
+
+func (s *IdempotencyRepositorySuite) TestDeleteExpired() {
+	ctx := context.Background()
+	now := time.Now()
+	spaceID := uuid.NewV4()
+	err := s.repo.Create(ctx, newRecord(spaceID, "expired", "hash", now.Add(-time.Minute)), now.Add(-time.Hour))
+	require.NoError(s.T(), err)
+	err = s.repo.Create(ctx, newRecord(spaceID, "valid", "hash", now.Add(time.Hour)), now)
+	require.NoError(s.T(), err)
+
+	count, err := s.repo.DeleteExpired(ctx, now)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), count >= 1)
+
+	_, err = s.repo.Load(ctx, spaceID, "valid", now)
+	require.NoError(s.T(), err)
+}
+
+func TestHash(t *testing.T) {
+	assert.Equal(t, idempotency.Hash([]byte("a"), []byte("b")), idempotency.Hash([]byte("a"), []byte("b")))
+	assert.NotEqual(t, idempotency.Hash([]byte("ab"), []byte("c")), idempotency.Hash([]byte("a"), []byte("bc")))
+}
+
+func newRecord(spaceID uuid.UUID, key, hash string, expiresAt time.Time) *idempotency.Record {
+	return &idempotency.Record{
+		SpaceID:        spaceID,
+		Key:            key,
+		RequestHash:    hash,
+		ResponseStatus: 201,
+		ResponseBody:   "{}",
+		ExpiresAt:      expiresAt,
+	}
+}
@@ -2,11 +2,15 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"flag"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"os/user"
 	"runtime"
+	"syscall"
 	"time"
 
 	clusterclient "github.com/fabric8-services/fabric8-cluster-client/service"
@@ -19,10 +23,16 @@ import (
 	"github.com/fabric8-services/fabric8-common/sentry"
 	"github.com/fabric8-services/fabric8-env/app"
 	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/authz"
+	"github.com/fabric8-services/fabric8-env/clustersvc"
 	"github.com/fabric8-services/fabric8-env/configuration"
 	"github.com/fabric8-services/fabric8-env/controller"
+	"github.com/fabric8-services/fabric8-env/environment"
 	"github.com/fabric8-services/fabric8-env/gormapp"
 	"github.com/fabric8-services/fabric8-env/migration"
+	"github.com/fabric8-services/fabric8-env/pubsub"
+	"github.com/fabric8-services/fabric8-env/reaper"
+	"github.com/fabric8-services/fabric8-env/server"
 	"github.com/goadesign/goa"
 	goalogrus "github.com/goadesign/goa/logging/logrus"
 	"github.com/goadesign/goa/middleware"
@@ -72,13 +82,16 @@ func main() {
 	}
 	setupDB(db, config)
 
-	// Migrate the schema
-	err = migration.Migrate(db.DB(), config.GetPostgresDatabase())
-	if err != nil {
-		log.Panic(nil, map[string]interface{}{"err": err},
-			"failed migration")
+	var replica *gormapp.Replica
+	if config.GetPostgresReplicaConfigString() != "" {
+		replica = gormapp.NewReplica(func() (*gorm.DB, error) {
+			return openReplica(config)
+		}, config.GetPostgresReplicaMaxLag())
+		defer replica.Close()
 	}
+
 	if migrateDB {
+		migrateSchema(db, config)
 		os.Exit(0)
 	}
 
@@ -104,24 +117,60 @@ func main() {
 	// ---
 
 	// Used services
-	authService, err := auth.NewAuthService(config.GetAuthServiceURL())
+	userAuthService, err := auth.NewAuthService(config.GetAuthServiceURL())
 	if err != nil {
 		log.Panic(nil, map[string]interface{}{"url": config.GetAuthServiceURL(), "err": err},
 			"could not create Auth client")
 	}
 
-	clusterService, err := clusterclient.NewClusterService(config.GetClusterServiceURL())
+	var scopeAuthService auth.AuthService = userAuthService
+	if config.IsAuthCacheEnabled() {
+		scopeAuthService = authz.NewCachingAuthService(userAuthService, config.GetAuthCacheTTL(),
+			config.GetAuthCacheNegativeTTL(), config.GetAuthCacheSize())
+	}
+	authService := authz.NewServiceAccountAuthService(scopeAuthService, config.GetServiceAccountPermissions())
+
+	clusterClient, err := clusterclient.NewClusterService(config.GetClusterServiceURL())
 	if err != nil {
 		log.Panic(nil, map[string]interface{}{"url": config.GetClusterServiceURL(), "err": err},
 			"could not create Cluster client")
 	}
+	clusterService := clustersvc.New(clusterClient, config)
+	clusterLister := clustersvc.NewLister(config.GetClusterServiceURL(), config.GetClusterTimeout())
 
-	appDB := gormapp.NewGormDB(db)
+	err = controller.ValidateEnvironmentTypes(config.GetSpaceDefaultEnvironments())
+	if err != nil {
+		log.Panic(nil, map[string]interface{}{"err": err},
+			"invalid default environments of the spaces")
+	}
+
+	var dbOptions []gormapp.Option
+	dependencies := []controller.Dependency{
+		{Name: "auth", Checker: controller.NewHTTPChecker(config.GetAuthServiceURL())},
+		{Name: "cluster", Checker: controller.NewClusterChecker(config.GetClusterServiceURL(), clusterService)},
+	}
+	if replica != nil {
+		dbOptions = append(dbOptions, gormapp.WithReplica(replica))
+		dependencies = append(dependencies, controller.Dependency{Name: "replica", Checker: replica})
+	}
+	var envCache *environment.Cache
+	if config.IsEnvironmentCacheEnabled() {
+		notifications := pubsub.NewPostgres(db.DB(), config.GetPostgresConfigString())
+		defer notifications.Close()
+		envCache = environment.NewCache(notifications, config.GetEnvironmentCacheTTL(), config.GetEnvironmentCacheSize())
+		dbOptions = append(dbOptions, gormapp.WithEnvironmentCache(envCache))
+	}
+	appDB := gormapp.NewGormDB(db, dbOptions...)
 	// ---
 
+	// The instance is not ready before the schema is migrated, nor once it shuts down
+	readiness := controller.NewReadiness()
+
 	// Mount controllers
-	app.MountStatusController(service, controller.NewStatusController(service, controller.NewGormDBChecker(db), config))
-	app.MountEnvironmentController(service, controller.NewEnvironmentController(service, appDB, authService, clusterService))
+	app.MountStatusController(service, controller.NewStatusController(service, controller.NewGormDBChecker(db), readiness, config, dependencies...))
+	app.MountEnvironmentController(service, controller.NewEnvironmentController(service, appDB, authService, clusterService, clusterLister, config))
+	app.MountTemplateController(service, controller.NewTemplateController(service, appDB, config))
+	app.MountAdminController(service, controller.NewAdminController(service, appDB, clusterLister, config))
 	// ---
 
 	log.Logger().Infoln("Git Commit SHA: ", app.Commit)
@@ -139,12 +188,88 @@ func main() {
 
 	registerMetrics(config, service)
 
-	// Start http
-	if err := http.ListenAndServe(config.GetHTTPAddress(), nil); err != nil {
+	// Start http, until SIGTERM or SIGINT
+	if config.GetHTTPShutdownDrainDelay() > 0 && config.GetHTTPShutdownDrainDelay() >= config.GetHTTPShutdownTimeout() {
+		log.Panic(nil, map[string]interface{}{
+			"drain_delay": config.GetHTTPShutdownDrainDelay().String(),
+			"timeout":     config.GetHTTPShutdownTimeout().String(),
+		}, "the shutdown drain delay must be shorter than the shutdown timeout")
+	}
+	listener, err := net.Listen("tcp", config.GetHTTPAddress())
+	if err != nil {
 		log.Error(nil, map[string]interface{}{"addr": config.GetHTTPAddress(), "err": err},
 			"unable to connect to server")
 		service.LogError("startup", "err", err)
+		return
+	}
+	ctx := shutdownOnSignal()
+	var handler http.Handler = http.DefaultServeMux
+	if config.IsHTTPTLSEnabled() {
+		certs, err := server.LoadCertificates(config.GetHTTPTLSCertFile(), config.GetHTTPTLSKeyFile(), config.GetHTTPTLSClientCAFile())
+		if err != nil {
+			log.Panic(nil, map[string]interface{}{"err": err},
+				"failed to setup TLS")
+		}
+		certs.Watch(ctx, config.GetHTTPTLSReloadInterval())
+		listener = tls.NewListener(listener, certs.TLSConfig())
+		if config.GetHTTPTLSClientCAFile() != "" {
+			// the platform calls the probes and collects the metrics without a certificate
+			handler = server.RequireClientCert(handler, "/api/status/live", "/api/status/ready", "/metrics")
+		}
+		log.Logger().Infoln("Serving HTTPS, client certificates required:", config.GetHTTPTLSClientCAFile() != "")
+	}
+	if replica != nil {
+		replica.Watch(ctx, config.GetPostgresReplicaCheckInterval())
+	}
+	if envCache != nil {
+		if err := envCache.Listen(ctx); err != nil {
+			log.Panic(nil, map[string]interface{}{"err": err},
+				"failed to listen to the invalidations of the environment cache")
+		}
+	}
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, listener, handler, readiness, config.GetHTTPShutdownDrainDelay(), config.GetHTTPShutdownTimeout())
+	}()
+
+	// The probes are answered while the schema is migrated, the instance is not
+	// ready before the migration succeeded and a failed one stops the process
+	migrateSchema(db, config)
+	var envReaper *reaper.Reaper
+	if config.GetReaperInterval() > 0 || config.GetIdempotencyPurgeInterval() > 0 {
+		envReaper = reaper.New(appDB, config.GetReaperInterval(),
+			reaper.WithPurgeInterval(config.GetIdempotencyPurgeInterval()))
+		envReaper.Start()
 	}
+	readiness.SetReady()
+	log.Logger().Infoln("Ready to serve requests")
+	// ---
+
+	if err := <-served; err != nil {
+		log.Error(nil, map[string]interface{}{"addr": config.GetHTTPAddress(), "err": err},
+			"server stopped")
+	}
+
+	// Stop background workers, the DB pool is closed afterwards
+	if envReaper != nil {
+		envReaper.Stop()
+	}
+	log.Logger().Infoln("Shut down")
+}
+
+// shutdownOnSignal returns a context which is done when the process receives
+// SIGTERM or SIGINT.
+func shutdownOnSignal() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		sig := <-signals
+		log.Info(nil, map[string]interface{}{"signal": sig.String()}, "received signal")
+		signal.Stop(signals)
+		cancel()
+	}()
+	return ctx
 }
 
 func configFileFromFlags(flagName string, envVarName string) string {
@@ -208,6 +333,29 @@ func openDB(config *configuration.Registry) *gorm.DB {
 	}
 }
 
+// openReplica connects to the read replica with the pool settings of the primary.
+func openReplica(config *configuration.Registry) (*gorm.DB, error) {
+	db, err := gorm.Open("postgres", config.GetPostgresReplicaConfigString())
+	if err != nil {
+		return nil, err
+	}
+	if config.GetPostgresConnectionMaxIdle() > 0 {
+		db.DB().SetMaxIdleConns(config.GetPostgresConnectionMaxIdle())
+	}
+	if config.GetPostgresConnectionMaxOpen() > 0 {
+		db.DB().SetMaxOpenConns(config.GetPostgresConnectionMaxOpen())
+	}
+	return db, nil
+}
+
+func migrateSchema(db *gorm.DB, config *configuration.Registry) {
+	err := migration.Migrate(db.DB(), config.GetPostgresDatabase())
+	if err != nil {
+		log.Panic(nil, map[string]interface{}{"err": err},
+			"failed migration")
+	}
+}
+
 func setupDB(db *gorm.DB, config *configuration.Registry) {
 	if config.IsPostgresDeveloperModeEnabled() && log.IsDebug() {
 		db = db.Debug()
@@ -222,6 +370,7 @@ func setupDB(db *gorm.DB, config *configuration.Registry) {
 		log.Logger().Infof("Configured connection pool max open %v", config.GetPostgresConnectionMaxOpen())
 	}
 	application.SetDatabaseTransactionTimeout(config.GetPostgresTransactionTimeout())
+	application.SetDatabaseTransactionRetries(config.GetPostgresTransactionRetries())
 }
 
 func getTokenManager(config *configuration.Registry) auth.Manager {
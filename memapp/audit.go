@@ -0,0 +1,57 @@
+package memapp
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-env/audit"
+	uuid "github.com/satori/go.uuid"
+)
+
+type auditRepository struct {
+	exec executor
+}
+
+func (r *auditRepository) Create(ctx context.Context, entry *audit.Entry) (*audit.Entry, error) {
+	err := r.exec.write(ctx, func(d *data) error {
+		if entry.ID == nil {
+			id := uuid.NewV4()
+			entry.ID = &id
+		}
+		now := time.Now()
+		entry.CreatedAt = now
+		entry.UpdatedAt = now
+		d.auditLogs[entry.EnvironmentID] = append(d.auditLogs[entry.EnvironmentID], copyEntry(entry))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// List returns the entries of the environment in the order they were created.
+func (r *auditRepository) List(ctx context.Context, envID uuid.UUID) ([]*audit.Entry, error) {
+	res := []*audit.Entry{}
+	err := r.exec.read(ctx, func(d *data) error {
+		for _, entry := range d.auditLogs[envID] {
+			res = append(res, copyEntry(entry))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// copyEntry copies the entry, the details are read back from the database as
+// an empty object if they are nil.
+func copyEntry(entry *audit.Entry) *audit.Entry {
+	c := *entry
+	c.Details = audit.Details{}
+	for k, v := range entry.Details {
+		c.Details[k] = v
+	}
+	return &c
+}
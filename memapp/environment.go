@@ -0,0 +1,323 @@
+package memapp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-common/httpsupport"
+	"github.com/fabric8-services/fabric8-env/environment"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+type environmentRepository struct {
+	exec executor
+}
+
+func (r *environmentRepository) Create(ctx context.Context, env *environment.Environment) (*environment.Environment, error) {
+	err := r.exec.write(ctx, func(d *data) error {
+		if err := checkEnvironment(env); err != nil {
+			return err
+		}
+		if env.ID == nil {
+			id := uuid.NewV4()
+			env.ID = &id
+		} else if _, ok := d.environments[*env.ID]; ok {
+			return errs.Errorf("duplicate key value violates unique constraint \"environments_pkey\": %s", env.ID)
+		}
+		if err := checkNamespaceName(d, env); err != nil {
+			return err
+		}
+		now := time.Now()
+		env.CreatedAt = now
+		env.UpdatedAt = now
+		row := *env
+		d.environments[*env.ID] = &row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+func (r *environmentRepository) Save(ctx context.Context, env *environment.Environment) (*environment.Environment, error) {
+	var res *environment.Environment
+	err := r.exec.write(ctx, func(d *data) error {
+		current, ok := d.environments[*env.ID]
+		if !ok {
+			return errors.NewNotFoundError("environment", env.ID.String())
+		}
+		// only the columns updated by the Gorm repository are saved
+		row := *current
+		row.Name = env.Name
+		row.Type = env.Type
+		row.NamespaceName = env.NamespaceName
+		row.ClusterURL = env.ClusterURL
+		row.ExpiresAt = env.ExpiresAt
+		row.Protected = env.Protected
+		row.LockedAt = env.LockedAt
+		row.LockedBy = env.LockedBy
+		row.LockReason = env.LockReason
+		row.LockExpiresAt = env.LockExpiresAt
+		row.UpdatedAt = time.Now()
+		if err := checkEnvironment(&row); err != nil {
+			return err
+		}
+		if err := checkNamespaceName(d, &row); err != nil {
+			return err
+		}
+		d.environments[*env.ID] = &row
+		res = copyEnvironment(&row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r *environmentRepository) List(ctx context.Context, spaceID uuid.UUID) ([]*environment.Environment, error) {
+	return r.find(ctx, func(env *environment.Environment) bool {
+		return *env.SpaceID == spaceID
+	})
+}
+
+func (r *environmentRepository) Count(ctx context.Context, spaceID uuid.UUID) (int, error) {
+	envs, err := r.List(ctx, spaceID)
+	if err != nil {
+		return 0, err
+	}
+	return len(envs), nil
+}
+
+// LockSpace does nothing, the transactions are serialized.
+func (r *environmentRepository) LockSpace(ctx context.Context, spaceID uuid.UUID) error {
+	return r.exec.read(ctx, func(d *data) error {
+		return nil
+	})
+}
+
+func (r *environmentRepository) ListByCluster(ctx context.Context, clusterURL string) ([]*environment.Environment, error) {
+	clusterURL = httpsupport.RemoveTrailingSlashFromURL(clusterURL)
+	return r.find(ctx, func(env *environment.Environment) bool {
+		return httpsupport.RemoveTrailingSlashFromURL(*env.ClusterURL) == clusterURL
+	})
+}
+
+func (r *environmentRepository) MoveCluster(ctx context.Context, oldClusterURL, newClusterURL string, now time.Time) ([]*environment.Environment, error) {
+	var res []*environment.Environment
+	err := r.exec.write(ctx, func(d *data) error {
+		oldClusterURL = httpsupport.RemoveTrailingSlashFromURL(oldClusterURL)
+		moved := make(map[uuid.UUID]*environment.Environment)
+		for id, current := range d.environments {
+			if httpsupport.RemoveTrailingSlashFromURL(*current.ClusterURL) != oldClusterURL || current.IsLocked(now) {
+				continue
+			}
+			row := *current
+			row.ClusterURL = &newClusterURL
+			row.UpdatedAt = now
+			moved[id] = &row
+		}
+		// the namespace names are checked once all the environments moved, as by
+		// the single statement of the Gorm repository
+		after := &data{environments: make(map[uuid.UUID]*environment.Environment, len(d.environments))}
+		for id, env := range d.environments {
+			after.environments[id] = env
+		}
+		for id, row := range moved {
+			after.environments[id] = row
+		}
+		for _, row := range moved {
+			if err := checkNamespaceName(after, row); err != nil {
+				return err
+			}
+		}
+		for id, row := range moved {
+			d.environments[id] = row
+			res = append(res, copyEnvironment(row))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].CreatedAt.Before(res[j].CreatedAt)
+	})
+	return res, nil
+}
+
+func (r *environmentRepository) UsedNamespaceNames(ctx context.Context, clusterURL string, names []string) ([]string, error) {
+	clusterURL = httpsupport.RemoveTrailingSlashFromURL(clusterURL)
+	candidates := map[string]bool{}
+	for _, name := range names {
+		candidates[name] = true
+	}
+	envs, err := r.find(ctx, func(env *environment.Environment) bool {
+		return env.NamespaceName != nil && candidates[*env.NamespaceName] &&
+			httpsupport.RemoveTrailingSlashFromURL(*env.ClusterURL) == clusterURL
+	})
+	if err != nil {
+		return nil, err
+	}
+	used := []string{}
+	for _, env := range envs {
+		used = append(used, *env.NamespaceName)
+	}
+	return used, nil
+}
+
+func (r *environmentRepository) ListAll(ctx context.Context, filter environment.Filter, offset, limit int) ([]*environment.Environment, int, error) {
+	envs, err := r.find(ctx, func(env *environment.Environment) bool {
+		if filter.ClusterURL != nil && httpsupport.RemoveTrailingSlashFromURL(*env.ClusterURL) != httpsupport.RemoveTrailingSlashFromURL(*filter.ClusterURL) {
+			return false
+		}
+		if filter.Type != nil && *env.Type != *filter.Type {
+			return false
+		}
+		if filter.CreatedAfter != nil && env.CreatedAt.Before(*filter.CreatedAfter) {
+			return false
+		}
+		if filter.CreatedBefore != nil && !env.CreatedAt.Before(*filter.CreatedBefore) {
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return page(envs, offset, limit), len(envs), nil
+}
+
+func (r *environmentRepository) ListExpired(ctx context.Context, before time.Time, limit int) ([]*environment.Environment, error) {
+	envs, err := r.find(ctx, func(env *environment.Environment) bool {
+		if env.ExpiresAt == nil || env.ExpiresAt.After(before) || env.Protected {
+			return false
+		}
+		// like in SQL, a lock without expiry never expires
+		return env.LockedAt == nil || (env.LockExpiresAt != nil && !env.LockExpiresAt.After(before))
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(envs, func(i, j int) bool {
+		return envs[i].ExpiresAt.Before(*envs[j].ExpiresAt)
+	})
+	return page(envs, 0, limit), nil
+}
+
+func (r *environmentRepository) Load(ctx context.Context, envID uuid.UUID) (*environment.Environment, error) {
+	var res *environment.Environment
+	err := r.exec.read(ctx, func(d *data) error {
+		env, ok := d.environments[envID]
+		if !ok {
+			return errors.NewNotFoundError("environment", envID.String())
+		}
+		res = copyEnvironment(env)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// LoadForUpdate is Load, the transactions are serialized.
+func (r *environmentRepository) LoadForUpdate(ctx context.Context, envID uuid.UUID) (*environment.Environment, error) {
+	return r.Load(ctx, envID)
+}
+
+func (r *environmentRepository) Delete(ctx context.Context, envID uuid.UUID) error {
+	return r.exec.write(ctx, func(d *data) error {
+		if _, ok := d.environments[envID]; !ok {
+			return errors.NewNotFoundError("environment", envID.String())
+		}
+		delete(d.environments, envID)
+		return nil
+	})
+}
+
+// find returns the environments matching the filter, oldest first.
+func (r *environmentRepository) find(ctx context.Context, match func(env *environment.Environment) bool) ([]*environment.Environment, error) {
+	res := []*environment.Environment{}
+	err := r.exec.read(ctx, func(d *data) error {
+		for _, env := range d.environments {
+			if match(env) {
+				res = append(res, copyEnvironment(env))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if !res[i].CreatedAt.Equal(res[j].CreatedAt) {
+			return res[i].CreatedAt.Before(res[j].CreatedAt)
+		}
+		return res[i].ID.String() < res[j].ID.String()
+	})
+	return res, nil
+}
+
+// checkEnvironment enforces the NOT NULL constraints of the environments table.
+func checkEnvironment(env *environment.Environment) error {
+	switch {
+	case env.SpaceID == nil:
+		return notNullViolation("space_id")
+	case env.Name == nil:
+		return notNullViolation("name")
+	case env.Type == nil:
+		return notNullViolation("type")
+	case env.ClusterURL == nil:
+		return notNullViolation("cluster_url")
+	}
+	return nil
+}
+
+// checkNamespaceName enforces the unique index on the namespace names of each
+// cluster, empty names are not indexed.
+func checkNamespaceName(d *data, env *environment.Environment) error {
+	if env.NamespaceName == nil || *env.NamespaceName == "" {
+		return nil
+	}
+	clusterURL := httpsupport.RemoveTrailingSlashFromURL(*env.ClusterURL)
+	for id, other := range d.environments {
+		if id == *env.ID || other.NamespaceName == nil || *other.NamespaceName != *env.NamespaceName {
+			continue
+		}
+		if httpsupport.RemoveTrailingSlashFromURL(*other.ClusterURL) == clusterURL {
+			return errors.NewDataConflictError(fmt.Sprintf("namespace '%s' is already used on cluster '%s'",
+				*env.NamespaceName, *env.ClusterURL))
+		}
+	}
+	return nil
+}
+
+func notNullViolation(column string) error {
+	return errs.Errorf("null value in column \"%s\" violates not-null constraint", column)
+}
+
+func copyEnvironment(env *environment.Environment) *environment.Environment {
+	c := *env
+	return &c
+}
+
+// page returns the envs from offset, at most limit of them. A negative limit
+// returns all of them.
+func page(envs []*environment.Environment, offset, limit int) []*environment.Environment {
+	if offset >= len(envs) {
+		return envs[:0]
+	}
+	if offset > 0 {
+		envs = envs[offset:]
+	}
+	if limit >= 0 && limit < len(envs) {
+		envs = envs[:limit]
+	}
+	return envs
+}
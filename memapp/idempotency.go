@@ -0,0 +1,67 @@
+package memapp
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-env/idempotency"
+	uuid "github.com/satori/go.uuid"
+)
+
+type idempotencyRepository struct {
+	exec executor
+}
+
+func (r *idempotencyRepository) Load(ctx context.Context, spaceID uuid.UUID, key string, now time.Time) (*idempotency.Record, error) {
+	var res *idempotency.Record
+	err := r.exec.read(ctx, func(d *data) error {
+		rec, ok := d.idempotencyKeys[idempotencyKey{spaceID: spaceID, key: key}]
+		if !ok || !rec.ExpiresAt.After(now) {
+			return errors.NewNotFoundError("idempotency key", key)
+		}
+		c := *rec
+		res = &c
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Create stores the record, an expired record of the same key is replaced.
+func (r *idempotencyRepository) Create(ctx context.Context, rec *idempotency.Record, now time.Time) error {
+	return r.exec.write(ctx, func(d *data) error {
+		k := idempotencyKey{spaceID: rec.SpaceID, key: rec.Key}
+		if current, ok := d.idempotencyKeys[k]; ok && current.ExpiresAt.After(now) {
+			return errors.NewDataConflictError(fmt.Sprintf("idempotency key '%s' is already used", rec.Key))
+		}
+		row := *rec
+		row.CreatedAt = now
+		row.UpdatedAt = now
+		row.DeletedAt = nil
+		d.idempotencyKeys[k] = &row
+		return nil
+	})
+}
+
+// DeleteExpired removes the records which expired before the given time and
+// returns their number.
+func (r *idempotencyRepository) DeleteExpired(ctx context.Context, before time.Time) (int, error) {
+	count := 0
+	err := r.exec.write(ctx, func(d *data) error {
+		for k, rec := range d.idempotencyKeys {
+			if !rec.ExpiresAt.After(before) {
+				delete(d.idempotencyKeys, k)
+				count++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
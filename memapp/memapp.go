@@ -0,0 +1,254 @@
+// Package memapp implements the application in memory, for the tests which do
+// not need Postgres. The repositories behave like the Gorm ones, which is
+// checked by the conformance tests of the apptest package.
+package memapp
+
+import (
+	"context"
+	"sync"
+
+	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/audit"
+	"github.com/fabric8-services/fabric8-env/environment"
+	"github.com/fabric8-services/fabric8-env/envtemplate"
+	"github.com/fabric8-services/fabric8-env/idempotency"
+	"github.com/fabric8-services/fabric8-env/quota"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+var _ application.DB = &MemoryDB{}
+
+var _ application.Transaction = &MemoryTransaction{}
+
+// ErrTxDone is returned by the statements, Commit and Rollback of a transaction
+// which was already committed or rolled back.
+var ErrTxDone = errs.New("transaction has already been committed or rolled back")
+
+// data holds the rows of all the tables. The rows are never changed in place,
+// they are replaced, so that a copy of the maps is a snapshot.
+type data struct {
+	environments    map[uuid.UUID]*environment.Environment
+	templates       map[uuid.UUID]*envtemplate.Template
+	auditLogs       map[uuid.UUID][]*audit.Entry
+	quotas          map[uuid.UUID]*quota.SpaceQuota
+	idempotencyKeys map[idempotencyKey]*idempotency.Record
+}
+
+type idempotencyKey struct {
+	spaceID uuid.UUID
+	key     string
+}
+
+func newData() *data {
+	return &data{
+		environments:    map[uuid.UUID]*environment.Environment{},
+		templates:       map[uuid.UUID]*envtemplate.Template{},
+		auditLogs:       map[uuid.UUID][]*audit.Entry{},
+		quotas:          map[uuid.UUID]*quota.SpaceQuota{},
+		idempotencyKeys: map[idempotencyKey]*idempotency.Record{},
+	}
+}
+
+func (d *data) clone() *data {
+	c := newData()
+	for k, v := range d.environments {
+		c.environments[k] = v
+	}
+	for k, v := range d.templates {
+		c.templates[k] = v
+	}
+	for k, v := range d.auditLogs {
+		c.auditLogs[k] = append([]*audit.Entry(nil), v...)
+	}
+	for k, v := range d.quotas {
+		c.quotas[k] = v
+	}
+	for k, v := range d.idempotencyKeys {
+		c.idempotencyKeys[k] = v
+	}
+	return c
+}
+
+// executor runs the statements of the repositories.
+type executor interface {
+	// read runs fn with the data, which fn must not change.
+	read(ctx context.Context, fn func(d *data) error) error
+	// write runs fn with the data, which fn may change. fn must check the
+	// constraints before changing anything, so that a failed statement has no
+	// effect.
+	write(ctx context.Context, fn func(d *data) error) error
+}
+
+type MemoryBase struct {
+	exec executor
+}
+
+// MemoryDB is an application.DB holding its data in memory. The transactions
+// are serialized: a transaction begins once the previous one ended, and the
+// writes made outside of transactions wait for the transaction in progress.
+// The reads made outside of transactions see the committed data only.
+type MemoryDB struct {
+	MemoryBase
+	// lock is held by the transaction in progress and by the writes made
+	// outside of transactions.
+	lock chan struct{}
+
+	mu   sync.RWMutex
+	data *data
+}
+
+// MemoryTransaction is a transaction of a MemoryDB. It works on a copy of the
+// data, which replaces the data of the MemoryDB when it is committed.
+type MemoryTransaction struct {
+	MemoryBase
+	db   *MemoryDB
+	ctx  context.Context
+	done chan struct{}
+
+	mu   sync.Mutex
+	data *data
+}
+
+// NewMemoryDB returns an empty MemoryDB.
+func NewMemoryDB() *MemoryDB {
+	db := &MemoryDB{
+		lock: make(chan struct{}, 1),
+		data: newData(),
+	}
+	db.exec = db
+	return db
+}
+
+func (db *MemoryDB) acquire(ctx context.Context) error {
+	select {
+	case db.lock <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return errs.WithStack(ctx.Err())
+	}
+}
+
+func (db *MemoryDB) release() {
+	<-db.lock
+}
+
+func (db *MemoryDB) read(ctx context.Context, fn func(d *data) error) error {
+	if err := ctx.Err(); err != nil {
+		return errs.WithStack(err)
+	}
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	return fn(db.data)
+}
+
+func (db *MemoryDB) write(ctx context.Context, fn func(d *data) error) error {
+	if err := db.acquire(ctx); err != nil {
+		return err
+	}
+	defer db.release()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return fn(db.data)
+}
+
+// BeginTransaction waits for the transaction in progress to end and begins a
+// transaction, which is rolled back when ctx is done before it is committed.
+func (db *MemoryDB) BeginTransaction(ctx context.Context) (application.Transaction, error) {
+	if err := db.acquire(ctx); err != nil {
+		return nil, err
+	}
+	db.mu.RLock()
+	snapshot := db.data.clone()
+	db.mu.RUnlock()
+
+	tx := &MemoryTransaction{
+		db:   db,
+		ctx:  ctx,
+		done: make(chan struct{}),
+		data: snapshot,
+	}
+	tx.exec = tx
+	go func() {
+		select {
+		case <-ctx.Done():
+			tx.Rollback()
+		case <-tx.done:
+		}
+	}()
+	return tx, nil
+}
+
+func (tx *MemoryTransaction) read(ctx context.Context, fn func(d *data) error) error {
+	return tx.write(ctx, fn)
+}
+
+func (tx *MemoryTransaction) write(ctx context.Context, fn func(d *data) error) error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.data == nil {
+		return ErrTxDone
+	}
+	if err := tx.ctx.Err(); err != nil {
+		return errs.WithStack(err)
+	}
+	if err := ctx.Err(); err != nil {
+		return errs.WithStack(err)
+	}
+	return fn(tx.data)
+}
+
+func (tx *MemoryTransaction) Commit() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.data == nil {
+		return ErrTxDone
+	}
+	if tx.ctx.Err() != nil {
+		// like database/sql, a transaction is rolled back once its context is done
+		tx.end()
+		return ErrTxDone
+	}
+	tx.db.mu.Lock()
+	tx.db.data = tx.data
+	tx.db.mu.Unlock()
+	tx.end()
+	return nil
+}
+
+func (tx *MemoryTransaction) Rollback() error {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.data == nil {
+		return ErrTxDone
+	}
+	tx.end()
+	return nil
+}
+
+// end ends the transaction, tx.mu must be held.
+func (tx *MemoryTransaction) end() {
+	tx.data = nil
+	close(tx.done)
+	tx.db.release()
+}
+
+func (b *MemoryBase) Environments() environment.Repository {
+	return &environmentRepository{exec: b.exec}
+}
+
+func (b *MemoryBase) Templates() envtemplate.Repository {
+	return &templateRepository{exec: b.exec}
+}
+
+func (b *MemoryBase) AuditLogs() audit.Repository {
+	return &auditRepository{exec: b.exec}
+}
+
+func (b *MemoryBase) SpaceQuotas() quota.Repository {
+	return &quotaRepository{exec: b.exec}
+}
+
+func (b *MemoryBase) IdempotencyKeys() idempotency.Repository {
+	return &idempotencyRepository{exec: b.exec}
+}
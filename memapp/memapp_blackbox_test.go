@@ -0,0 +1,91 @@
+package memapp_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/application/apptest"
+	"github.com/fabric8-services/fabric8-env/environment"
+	"github.com/fabric8-services/fabric8-env/memapp"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type MemoryDBSuite struct {
+	testsuite.UnitTestSuite
+}
+
+func TestMemoryDB(t *testing.T) {
+	suite.Run(t, &MemoryDBSuite{})
+}
+
+func (s *MemoryDBSuite) TestConformance() {
+	apptest.RunConformanceTests(s.T(), func() application.DB {
+		return memapp.NewMemoryDB()
+	})
+}
+
+func newEnvironment(spaceID uuid.UUID) *environment.Environment {
+	name, envType, clusterURL := "osio-stage", "stage", "cluster1.com"
+	return &environment.Environment{
+		Name:       &name,
+		Type:       &envType,
+		SpaceID:    &spaceID,
+		ClusterURL: &clusterURL,
+	}
+}
+
+func (s *MemoryDBSuite) TestSerializedTransactions() {
+	db := memapp.NewMemoryDB()
+	tx, err := db.BeginTransaction(context.Background())
+	require.NoError(s.T(), err)
+
+	s.T().Run("transaction waits", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := db.BeginTransaction(ctx)
+		assert.Equal(t, context.DeadlineExceeded, errs.Cause(err))
+	})
+
+	s.T().Run("write waits", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		_, err := db.Environments().Create(ctx, newEnvironment(uuid.NewV4()))
+		assert.Equal(t, context.DeadlineExceeded, errs.Cause(err))
+	})
+
+	s.T().Run("read does not wait", func(t *testing.T) {
+		envs, err := db.Environments().List(context.Background(), uuid.NewV4())
+		require.NoError(t, err)
+		assert.Empty(t, envs)
+	})
+
+	require.NoError(s.T(), tx.Commit())
+	_, err = db.Environments().Create(context.Background(), newEnvironment(uuid.NewV4()))
+	require.NoError(s.T(), err)
+}
+
+func (s *MemoryDBSuite) TestContextDoneEndsTransaction() {
+	db := memapp.NewMemoryDB()
+	ctx, cancel := context.WithCancel(context.Background())
+	tx, err := db.BeginTransaction(ctx)
+	require.NoError(s.T(), err)
+	cancel()
+
+	// the transaction is rolled back without a call to Rollback
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), time.Second)
+	defer waitCancel()
+	next, err := db.BeginTransaction(waitCtx)
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), next.Rollback())
+
+	_, err = tx.Environments().List(context.Background(), uuid.NewV4())
+	assert.Equal(s.T(), memapp.ErrTxDone, err)
+	assert.Equal(s.T(), memapp.ErrTxDone, tx.Rollback())
+}
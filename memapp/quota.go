@@ -0,0 +1,58 @@
+package memapp
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-env/quota"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+type quotaRepository struct {
+	exec executor
+}
+
+func (r *quotaRepository) Load(ctx context.Context, spaceID uuid.UUID) (*quota.SpaceQuota, error) {
+	var res *quota.SpaceQuota
+	err := r.exec.read(ctx, func(d *data) error {
+		if q, ok := d.quotas[spaceID]; ok {
+			c := *q
+			res = &c
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r *quotaRepository) Save(ctx context.Context, q *quota.SpaceQuota) (*quota.SpaceQuota, error) {
+	err := r.exec.write(ctx, func(d *data) error {
+		if q.MaxEnvironments < 0 {
+			return errs.New("new row for relation \"space_quotas\" violates check constraint \"non_negative_max_environments\"")
+		}
+		now := time.Now()
+		row := quota.SpaceQuota{SpaceID: q.SpaceID, MaxEnvironments: q.MaxEnvironments}
+		row.CreatedAt = now
+		if current, ok := d.quotas[q.SpaceID]; ok {
+			row.CreatedAt = current.CreatedAt
+		}
+		row.UpdatedAt = now
+		d.quotas[q.SpaceID] = &row
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.Load(ctx, q.SpaceID)
+}
+
+// Delete removes the override, the space uses the default quota again.
+func (r *quotaRepository) Delete(ctx context.Context, spaceID uuid.UUID) error {
+	return r.exec.write(ctx, func(d *data) error {
+		delete(d.quotas, spaceID)
+		return nil
+	})
+}
@@ -0,0 +1,140 @@
+package memapp
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/errors"
+	"github.com/fabric8-services/fabric8-env/envtemplate"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+type templateRepository struct {
+	exec executor
+}
+
+func (r *templateRepository) Create(ctx context.Context, tmpl *envtemplate.Template) (*envtemplate.Template, error) {
+	err := r.exec.write(ctx, func(d *data) error {
+		if tmpl.ID == nil {
+			id := uuid.NewV4()
+			tmpl.ID = &id
+		} else if _, ok := d.templates[*tmpl.ID]; ok {
+			return errs.Errorf("duplicate key value violates unique constraint \"environment_templates_pkey\": %s", tmpl.ID)
+		}
+		if err := checkTemplateName(d, tmpl); err != nil {
+			return err
+		}
+		now := time.Now()
+		tmpl.CreatedAt = now
+		tmpl.UpdatedAt = now
+		d.templates[*tmpl.ID] = copyTemplate(tmpl)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func (r *templateRepository) Save(ctx context.Context, tmpl *envtemplate.Template) (*envtemplate.Template, error) {
+	var res *envtemplate.Template
+	err := r.exec.write(ctx, func(d *data) error {
+		current, ok := d.templates[*tmpl.ID]
+		if !ok {
+			return errors.NewNotFoundError("template", tmpl.ID.String())
+		}
+		if err := checkTemplateName(d, tmpl); err != nil {
+			return err
+		}
+		row := copyTemplate(current)
+		row.Name = tmpl.Name
+		row.Description = tmpl.Description
+		row.Environments = append(envtemplate.Items{}, tmpl.Environments...)
+		row.UpdatedAt = time.Now()
+		d.templates[*tmpl.ID] = row
+		res = copyTemplate(row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (r *templateRepository) Delete(ctx context.Context, tmplID uuid.UUID) error {
+	return r.exec.write(ctx, func(d *data) error {
+		if _, ok := d.templates[tmplID]; !ok {
+			return errors.NewNotFoundError("template", tmplID.String())
+		}
+		delete(d.templates, tmplID)
+		return nil
+	})
+}
+
+func (r *templateRepository) List(ctx context.Context) ([]*envtemplate.Template, error) {
+	res := []*envtemplate.Template{}
+	err := r.exec.read(ctx, func(d *data) error {
+		for _, tmpl := range d.templates {
+			res = append(res, copyTemplate(tmpl))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return *res[i].Name < *res[j].Name
+	})
+	return res, nil
+}
+
+func (r *templateRepository) Load(ctx context.Context, tmplID uuid.UUID) (*envtemplate.Template, error) {
+	return r.load(ctx, tmplID.String(), func(tmpl *envtemplate.Template) bool {
+		return *tmpl.ID == tmplID
+	})
+}
+
+func (r *templateRepository) LoadByName(ctx context.Context, name string) (*envtemplate.Template, error) {
+	return r.load(ctx, name, func(tmpl *envtemplate.Template) bool {
+		return tmpl.Name != nil && *tmpl.Name == name
+	})
+}
+
+func (r *templateRepository) load(ctx context.Context, key string, match func(tmpl *envtemplate.Template) bool) (*envtemplate.Template, error) {
+	var res *envtemplate.Template
+	err := r.exec.read(ctx, func(d *data) error {
+		for _, tmpl := range d.templates {
+			if match(tmpl) {
+				res = copyTemplate(tmpl)
+				return nil
+			}
+		}
+		return errors.NewNotFoundError("template", key)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// checkTemplateName enforces the unique index on the names of the templates.
+func checkTemplateName(d *data, tmpl *envtemplate.Template) error {
+	if tmpl.Name == nil {
+		return nil
+	}
+	for id, other := range d.templates {
+		if id != *tmpl.ID && other.Name != nil && *other.Name == *tmpl.Name {
+			return errors.NewDataConflictError(fmt.Sprintf("template with name '%s' already exists", *tmpl.Name))
+		}
+	}
+	return nil
+}
+
+func copyTemplate(tmpl *envtemplate.Template) *envtemplate.Template {
+	c := *tmpl
+	c.Environments = append(envtemplate.Items{}, tmpl.Environments...)
+	return &c
+}
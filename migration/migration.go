@@ -17,6 +17,14 @@ func Steps() Scripts {
 		{"000-bootstrap.sql"},
 		{"001-environments.sql"},
 		{"0002-alter-env-add-notnull.sql"},
+		{"0003-environment-templates.sql"},
+		{"0004-environment-audit-logs.sql"},
+		{"0005-environments-expires-at.sql"},
+		{"0006-environments-lock.sql"},
+		{"0007-space-quotas.sql"},
+		{"0008-idempotency-keys.sql"},
+		{"0009-environments-cluster-url-idx.sql"},
+		{"0010-environments-namespace-name-idx.sql"},
 	}
 }
 
@@ -84,6 +84,14 @@ func (s *MigrationTestSuite) TestMigrate() {
 
 	t.Run("checkMigration001", checkMigration001)
 	t.Run("checkMigration002", checkMigration002)
+	t.Run("checkMigration003", checkMigration003)
+	t.Run("checkMigration004", checkMigration004)
+	t.Run("checkMigration005", checkMigration005)
+	t.Run("checkMigration006", checkMigration006)
+	t.Run("checkMigration007", checkMigration007)
+	t.Run("checkMigration008", checkMigration008)
+	t.Run("checkMigration009", checkMigration009)
+	t.Run("checkMigration010", checkMigration010)
 }
 
 func checkMigration001(t *testing.T) {
@@ -123,3 +131,156 @@ func checkMigration002(t *testing.T) {
 		require.Error(t, err)
 	})
 }
+
+func checkMigration003(t *testing.T) {
+	err := migrationsupport.Migrate(sqlDB, databaseName, migration.Steps()[:4])
+	require.NoError(t, err)
+
+	t.Run("insert_ok", func(t *testing.T) {
+		_, err := sqlDB.Exec(`INSERT INTO environment_templates (id, name, environments)
+			VALUES (uuid_generate_v4(), 'standard-pipeline', '[{"name":"{space}-stage","type":"stage","cluster-url":"cluster1.com"}]')`)
+		require.NoError(t, err)
+	})
+
+	t.Run("insert_duplicate_name_failed", func(t *testing.T) {
+		_, err := sqlDB.Exec(`INSERT INTO environment_templates (id, name)
+			VALUES (uuid_generate_v4(), 'standard-pipeline')`)
+		require.Error(t, err)
+	})
+
+	t.Run("insert_null_name_failed", func(t *testing.T) {
+		_, err := sqlDB.Exec(`INSERT INTO environment_templates (id) VALUES (uuid_generate_v4())`)
+		require.Error(t, err)
+	})
+}
+
+func checkMigration004(t *testing.T) {
+	err := migrationsupport.Migrate(sqlDB, databaseName, migration.Steps()[:5])
+	require.NoError(t, err)
+
+	t.Run("insert_ok", func(t *testing.T) {
+		_, err := sqlDB.Exec(`INSERT INTO environment_audit_logs (id, environment_id, space_id, action, actor, details)
+			VALUES (uuid_generate_v4(), uuid_generate_v4(), uuid_generate_v4(), 'move_cluster', 'user1', '{"old-cluster-url":"cluster1.com"}')`)
+		require.NoError(t, err)
+	})
+
+	t.Run("insert_null_action_failed", func(t *testing.T) {
+		_, err := sqlDB.Exec(`INSERT INTO environment_audit_logs (id, environment_id, space_id, actor)
+			VALUES (uuid_generate_v4(), uuid_generate_v4(), uuid_generate_v4(), 'user1')`)
+		require.Error(t, err)
+	})
+}
+
+func checkMigration005(t *testing.T) {
+	err := migrationsupport.Migrate(sqlDB, databaseName, migration.Steps()[:6])
+	require.NoError(t, err)
+
+	t.Run("insert_ok", func(t *testing.T) {
+		_, err := sqlDB.Exec(`INSERT INTO environments (id, name, type, space_id, namespace_name, cluster_url, expires_at)
+			VALUES (uuid_generate_v4(), 'pr-42', 'dev', uuid_generate_v4(), 'pr-42', 'cluster1.com', now() + interval '1 day')`)
+		require.NoError(t, err)
+	})
+
+	t.Run("insert_without_expiry_ok", func(t *testing.T) {
+		_, err := sqlDB.Exec(`INSERT INTO environments (id, name, type, space_id, namespace_name, cluster_url)
+			VALUES (uuid_generate_v4(), 'osio-stage', 'stage', uuid_generate_v4(), '', 'cluster1.com')`)
+		require.NoError(t, err)
+	})
+}
+
+func checkMigration006(t *testing.T) {
+	_, err := sqlDB.Exec(`INSERT INTO environments (id, name, type, space_id, namespace_name, cluster_url)
+			VALUES ('5d3b9b4e-7a31-4e49-b0a6-6f2c1f9e8a11', 'osio-run', 'run', uuid_generate_v4(), '', 'cluster1.com')`)
+	require.NoError(t, err)
+
+	err = migrationsupport.Migrate(sqlDB, databaseName, migration.Steps()[:7])
+	require.NoError(t, err)
+
+	t.Run("run_protected", func(t *testing.T) {
+		var protected bool
+		err := sqlDB.QueryRow(`SELECT protected FROM environments WHERE id = '5d3b9b4e-7a31-4e49-b0a6-6f2c1f9e8a11'`).Scan(&protected)
+		require.NoError(t, err)
+		require.True(t, protected)
+	})
+
+	t.Run("insert_locked_ok", func(t *testing.T) {
+		_, err := sqlDB.Exec(`INSERT INTO environments (id, name, type, space_id, namespace_name, cluster_url, locked_at, locked_by, lock_reason)
+			VALUES (uuid_generate_v4(), 'osio-stage', 'stage', uuid_generate_v4(), '', 'cluster1.com', now(), 'user1', 'release freeze')`)
+		require.NoError(t, err)
+	})
+}
+
+func checkMigration007(t *testing.T) {
+	err := migrationsupport.Migrate(sqlDB, databaseName, migration.Steps()[:8])
+	require.NoError(t, err)
+
+	t.Run("insert_ok", func(t *testing.T) {
+		_, err := sqlDB.Exec(`INSERT INTO space_quotas (space_id, max_environments) VALUES (uuid_generate_v4(), 10)`)
+		require.NoError(t, err)
+	})
+
+	t.Run("insert_negative_failed", func(t *testing.T) {
+		_, err := sqlDB.Exec(`INSERT INTO space_quotas (space_id, max_environments) VALUES (uuid_generate_v4(), -1)`)
+		require.Error(t, err)
+	})
+}
+
+func checkMigration008(t *testing.T) {
+	err := migrationsupport.Migrate(sqlDB, databaseName, migration.Steps()[:9])
+	require.NoError(t, err)
+
+	t.Run("insert_ok", func(t *testing.T) {
+		_, err := sqlDB.Exec(`INSERT INTO idempotency_keys (space_id, key, request_hash, response_status, response_body, expires_at)
+			VALUES ('40bbdd3d-8b5d-4fd6-ac90-7236b669af04', 'key-1', 'hash', 201, '{}', now())`)
+		require.NoError(t, err)
+	})
+
+	t.Run("insert_duplicate_failed", func(t *testing.T) {
+		_, err := sqlDB.Exec(`INSERT INTO idempotency_keys (space_id, key, request_hash, response_status, response_body, expires_at)
+			VALUES ('40bbdd3d-8b5d-4fd6-ac90-7236b669af04', 'key-1', 'hash', 201, '{}', now())`)
+		require.Error(t, err)
+	})
+}
+
+func checkMigration009(t *testing.T) {
+	err := migrationsupport.Migrate(sqlDB, databaseName, migration.Steps()[:10])
+	require.NoError(t, err)
+
+	t.Run("expression_index", func(t *testing.T) {
+		var def string
+		err := sqlDB.QueryRow(`SELECT indexdef FROM pg_indexes WHERE indexname = 'environments_cluster_url_idx'`).Scan(&def)
+		require.NoError(t, err)
+		require.Contains(t, def, "rtrim(cluster_url")
+	})
+}
+
+func checkMigration010(t *testing.T) {
+	_, err := sqlDB.Exec(`INSERT INTO environments (id, created_at, name, type, space_id, namespace_name, cluster_url) VALUES
+		('3b1e0f3c-6c2d-4f1a-8e5b-0d9a7c4b2e61', now() - interval '1 hour', 'osio-stage', 'stage', '3b1e0f3c-6c2d-4f1a-8e5b-0d9a7c4b2e62', 'dup-stage', 'https://cluster.example.com'),
+		('3b1e0f3c-6c2d-4f1a-8e5b-0d9a7c4b2e63', now(), 'osio-stage', 'stage', '3b1e0f3c-6c2d-4f1a-8e5b-0d9a7c4b2e64', 'dup-stage', 'https://cluster.example.com/')`)
+	require.NoError(t, err)
+
+	t.Run("duplicates_reported", func(t *testing.T) {
+		err := migrationsupport.Migrate(sqlDB, databaseName, migration.Steps()[:11])
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "namespace dup-stage on cluster https://cluster.example.com used by environments "+
+			"3b1e0f3c-6c2d-4f1a-8e5b-0d9a7c4b2e61, 3b1e0f3c-6c2d-4f1a-8e5b-0d9a7c4b2e63")
+
+		var namespaceName string
+		err = sqlDB.QueryRow(`SELECT namespace_name FROM environments WHERE id = '3b1e0f3c-6c2d-4f1a-8e5b-0d9a7c4b2e63'`).Scan(&namespaceName)
+		require.NoError(t, err)
+		require.Equal(t, "dup-stage", namespaceName, "the environments are left unchanged")
+	})
+
+	_, err = sqlDB.Exec(`UPDATE environments SET namespace_name = 'dup-stage-1' WHERE id = '3b1e0f3c-6c2d-4f1a-8e5b-0d9a7c4b2e63'`)
+	require.NoError(t, err)
+	err = migrationsupport.Migrate(sqlDB, databaseName, migration.Steps()[:11])
+	require.NoError(t, err)
+
+	t.Run("unique_index", func(t *testing.T) {
+		_, err := sqlDB.Exec(`INSERT INTO environments (name, type, space_id, namespace_name, cluster_url) VALUES
+			('osio-stage', 'stage', '3b1e0f3c-6c2d-4f1a-8e5b-0d9a7c4b2e65', 'dup-stage', 'https://cluster.example.com/')`)
+		require.Error(t, err)
+		require.True(t, gormsupport.IsUniqueViolation(err, "environments_namespace_name_idx"))
+	})
+}
@@ -0,0 +1,12 @@
+CREATE TABLE environment_templates (
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    id uuid primary key DEFAULT uuid_generate_v4() NOT NULL,
+    name text NOT NULL,
+    description text,
+    -- the template environments, with the keys name, type, cluster-url and namespace-name
+    environments jsonb NOT NULL DEFAULT '[]'
+);
+
+CREATE UNIQUE INDEX environment_templates_name_idx ON environment_templates (name) WHERE deleted_at IS NULL;
@@ -0,0 +1,14 @@
+CREATE TABLE environment_audit_logs (
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    id uuid primary key DEFAULT uuid_generate_v4() NOT NULL,
+    environment_id uuid NOT NULL,
+    space_id uuid NOT NULL,
+    action text NOT NULL,
+    actor text NOT NULL,
+    details jsonb NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX environment_audit_logs_environment_id_idx ON environment_audit_logs USING BTREE (environment_id);
+CREATE INDEX environments_cluster_url_idx ON environments USING BTREE (cluster_url);
@@ -0,0 +1,3 @@
+ALTER TABLE environments ADD COLUMN expires_at timestamp with time zone;
+
+CREATE INDEX environments_expires_at_idx ON environments USING BTREE (expires_at) WHERE deleted_at IS NULL;
@@ -0,0 +1,7 @@
+ALTER TABLE environments ADD COLUMN protected boolean NOT NULL DEFAULT false;
+ALTER TABLE environments ADD COLUMN locked_at timestamp with time zone;
+ALTER TABLE environments ADD COLUMN locked_by text;
+ALTER TABLE environments ADD COLUMN lock_reason text;
+ALTER TABLE environments ADD COLUMN lock_expires_at timestamp with time zone;
+
+UPDATE environments SET protected = true WHERE type = 'run';
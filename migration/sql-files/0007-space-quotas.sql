@@ -0,0 +1,7 @@
+CREATE TABLE space_quotas (
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    space_id uuid primary key NOT NULL,
+    max_environments int NOT NULL CONSTRAINT non_negative_max_environments CHECK (max_environments >= 0)
+);
@@ -0,0 +1,14 @@
+CREATE TABLE idempotency_keys (
+    created_at timestamp with time zone,
+    updated_at timestamp with time zone,
+    deleted_at timestamp with time zone,
+    space_id uuid NOT NULL,
+    key text NOT NULL,
+    request_hash text NOT NULL,
+    response_status int NOT NULL,
+    response_body text NOT NULL,
+    expires_at timestamp with time zone NOT NULL,
+    PRIMARY KEY (space_id, key)
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys USING BTREE (expires_at);
@@ -0,0 +1,3 @@
+-- the environments are looked up by cluster URL without the trailing slash
+DROP INDEX environments_cluster_url_idx;
+CREATE INDEX environments_cluster_url_idx ON environments USING BTREE (rtrim(cluster_url, '/')) WHERE deleted_at IS NULL;
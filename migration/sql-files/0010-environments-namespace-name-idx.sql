@@ -0,0 +1,24 @@
+-- environments sharing a namespace of a cluster must be renamed or deleted by hand
+-- before the migration, which reports them and fails otherwise
+DO $$
+DECLARE
+    duplicates text;
+BEGIN
+    SELECT string_agg(format('namespace %s on cluster %s used by environments %s', namespace_name, cluster_url, ids), '; ')
+    INTO duplicates
+    FROM (
+        SELECT namespace_name, rtrim(cluster_url, '/') AS cluster_url, string_agg(id::text, ', ' ORDER BY created_at, id) AS ids
+        FROM environments
+        WHERE deleted_at IS NULL AND namespace_name <> ''
+        GROUP BY namespace_name, rtrim(cluster_url, '/')
+        HAVING count(*) > 1
+    ) d;
+    IF duplicates IS NOT NULL THEN
+        RAISE EXCEPTION 'duplicate namespace names: %', duplicates;
+    END IF;
+END
+$$;
+
+-- a namespace of a cluster is used by at most one environment, legacy empty names are not indexed
+CREATE UNIQUE INDEX environments_namespace_name_idx ON environments USING BTREE (rtrim(cluster_url, '/'), namespace_name)
+    WHERE deleted_at IS NULL AND namespace_name <> '';
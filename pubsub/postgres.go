@@ -0,0 +1,84 @@
+package pubsub
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/lib/pq"
+	errs "github.com/pkg/errors"
+)
+
+// Postgres delivers the messages with the LISTEN and NOTIFY commands of
+// Postgres, to all the instances connected to the same database. A topic is a
+// notification channel.
+type Postgres struct {
+	db            *sql.DB
+	listener      *pq.Listener
+	subscriptions *subscriptions
+}
+
+var _ PubSub = &Postgres{}
+
+// NewPostgres returns a Postgres publishing with db and listening on a
+// dedicated connection opened with dsn, which is reopened when it is lost.
+func NewPostgres(db *sql.DB, dsn string) *Postgres {
+	p := &Postgres{
+		db:            db,
+		subscriptions: newSubscriptions(),
+	}
+	p.listener = pq.NewListener(dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected, pq.ListenerEventConnectionAttemptFailed:
+			log.Warn(nil, map[string]interface{}{"err": err},
+				"the connection listening to the notifications is lost")
+		case pq.ListenerEventReconnected:
+			log.Info(nil, nil, "the connection listening to the notifications is restored")
+		}
+	})
+	go p.dispatch()
+	return p
+}
+
+// Publish notifies the topic, the message must be shorter than 8000 bytes.
+func (p *Postgres) Publish(topic, message string) error {
+	_, err := p.db.Exec("SELECT pg_notify($1, $2)", topic, message)
+	return errs.Wrapf(err, "unable to publish on %s", topic)
+}
+
+func (p *Postgres) Subscribe(ctx context.Context, topic string, handler Handler) error {
+	h := &handler
+	if p.subscriptions.add(topic, h) {
+		if err := p.listener.Listen(topic); err != nil && err != pq.ErrChannelAlreadyOpen {
+			p.subscriptions.remove(topic, h)
+			return errs.Wrapf(err, "unable to listen to %s", topic)
+		}
+	}
+	go func() {
+		<-ctx.Done()
+		if p.subscriptions.remove(topic, h) {
+			if err := p.listener.Unlisten(topic); err != nil {
+				log.Warn(nil, map[string]interface{}{"err": err, "topic": topic},
+					"unable to stop listening")
+			}
+		}
+	}()
+	return nil
+}
+
+// Close closes the connection listening to the notifications.
+func (p *Postgres) Close() error {
+	return errs.WithStack(p.listener.Close())
+}
+
+func (p *Postgres) dispatch() {
+	for n := range p.listener.Notify {
+		if n == nil {
+			// the notifications sent while the connection was lost are missed
+			p.subscriptions.lost()
+			continue
+		}
+		p.subscriptions.deliver(n.Channel, n.Extra)
+	}
+}
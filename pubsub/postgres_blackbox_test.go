@@ -0,0 +1,48 @@
+package pubsub_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/configuration"
+	"github.com/fabric8-services/fabric8-env/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type PostgresSuite struct {
+	testsuite.DBTestSuite
+	config *configuration.Registry
+}
+
+func TestPostgres(t *testing.T) {
+	config, err := configuration.New("")
+	require.NoError(t, err)
+	suite.Run(t, &PostgresSuite{DBTestSuite: testsuite.NewDBTestSuite(config), config: config})
+}
+
+func (s *PostgresSuite) TestPublish() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	publisher := pubsub.NewPostgres(s.DB.DB(), s.config.GetPostgresConfigString())
+	defer publisher.Close()
+	// another instance, listening on its own connection
+	subscriber := pubsub.NewPostgres(s.DB.DB(), s.config.GetPostgresConfigString())
+	defer subscriber.Close()
+
+	received := make(chan string, 1)
+	require.NoError(s.T(), subscriber.Subscribe(ctx, "pubsub_test", func(message string) {
+		received <- message
+	}))
+	require.NoError(s.T(), publisher.Publish("pubsub_test", "hello"))
+
+	select {
+	case message := <-received:
+		assert.Equal(s.T(), "hello", message)
+	case <-time.After(5 * time.Second):
+		assert.Fail(s.T(), "the message was not received")
+	}
+}
@@ -0,0 +1,119 @@
+// Package pubsub delivers messages to all the instances of the service.
+package pubsub
+
+import (
+	"context"
+	"sync"
+)
+
+// Handler is called with the messages published on a topic. It is called with
+// an empty message when messages may have been lost, e.g. after the connection
+// to the broker was lost.
+type Handler func(message string)
+
+// PubSub publishes messages to the subscribers of a topic.
+type PubSub interface {
+	// Publish sends the message to the subscribers of the topic in all the
+	// instances, including this one.
+	Publish(topic, message string) error
+	// Subscribe calls handler with the messages published on the topic until
+	// ctx is done.
+	Subscribe(ctx context.Context, topic string, handler Handler) error
+}
+
+// subscriptions holds the handlers of the topics.
+type subscriptions struct {
+	mu       sync.RWMutex
+	handlers map[string]map[*Handler]struct{}
+}
+
+func newSubscriptions() *subscriptions {
+	return &subscriptions{handlers: map[string]map[*Handler]struct{}{}}
+}
+
+// add registers the handler and returns true if it is the first one of the topic.
+func (s *subscriptions) add(topic string, handler *Handler) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	first := len(s.handlers[topic]) == 0
+	if first {
+		s.handlers[topic] = map[*Handler]struct{}{}
+	}
+	s.handlers[topic][handler] = struct{}{}
+	return first
+}
+
+// remove unregisters the handler and returns true if it was the last one of the topic.
+func (s *subscriptions) remove(topic string, handler *Handler) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.handlers[topic], handler)
+	if len(s.handlers[topic]) > 0 {
+		return false
+	}
+	delete(s.handlers, topic)
+	return true
+}
+
+// deliver calls the handlers of the topic with the message.
+func (s *subscriptions) deliver(topic, message string) {
+	for _, handler := range s.get(topic) {
+		(*handler)(message)
+	}
+}
+
+// lost calls all the handlers with an empty message.
+func (s *subscriptions) lost() {
+	for _, topic := range s.topics() {
+		s.deliver(topic, "")
+	}
+}
+
+func (s *subscriptions) get(topic string) []*Handler {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]*Handler, 0, len(s.handlers[topic]))
+	for handler := range s.handlers[topic] {
+		res = append(res, handler)
+	}
+	return res
+}
+
+func (s *subscriptions) topics() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	res := make([]string, 0, len(s.handlers))
+	for topic := range s.handlers {
+		res = append(res, topic)
+	}
+	return res
+}
+
+// Local delivers the messages within this instance only. It is meant for a
+// single instance and for the tests.
+type Local struct {
+	subscriptions *subscriptions
+}
+
+var _ PubSub = &Local{}
+
+// NewLocal returns a Local without subscribers.
+func NewLocal() *Local {
+	return &Local{subscriptions: newSubscriptions()}
+}
+
+// Publish calls the handlers of the topic before it returns.
+func (l *Local) Publish(topic, message string) error {
+	l.subscriptions.deliver(topic, message)
+	return nil
+}
+
+func (l *Local) Subscribe(ctx context.Context, topic string, handler Handler) error {
+	h := &handler
+	l.subscriptions.add(topic, h)
+	go func() {
+		<-ctx.Done()
+		l.subscriptions.remove(topic, h)
+	}()
+	return nil
+}
@@ -0,0 +1,35 @@
+package pubsub_test
+
+import (
+	"context"
+	"testing"
+
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/pubsub"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type LocalSuite struct {
+	testsuite.UnitTestSuite
+}
+
+func TestLocal(t *testing.T) {
+	suite.Run(t, &LocalSuite{})
+}
+
+func (s *LocalSuite) TestPublish() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ps := pubsub.NewLocal()
+	var first, second, other []string
+	require.NoError(s.T(), ps.Subscribe(ctx, "topic", func(message string) { first = append(first, message) }))
+	require.NoError(s.T(), ps.Subscribe(ctx, "topic", func(message string) { second = append(second, message) }))
+	require.NoError(s.T(), ps.Subscribe(ctx, "other", func(message string) { other = append(other, message) }))
+
+	require.NoError(s.T(), ps.Publish("topic", "hello"))
+	assert.Equal(s.T(), []string{"hello"}, first)
+	assert.Equal(s.T(), []string{"hello"}, second)
+	assert.Empty(s.T(), other)
+}
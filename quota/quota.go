@@ -0,0 +1,90 @@
+package quota
+
+import (
+	"context"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/gormsupport"
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/fabric8-services/fabric8-env/gormctx"
+	"github.com/goadesign/goa"
+	"github.com/jinzhu/gorm"
+	errs "github.com/pkg/errors"
+	uuid "github.com/satori/go.uuid"
+)
+
+// SpaceQuota overrides the default maximum number of environments of a space.
+type SpaceQuota struct {
+	gormsupport.Lifecycle
+	SpaceID         uuid.UUID `sql:"type:uuid" gorm:"primary_key"`
+	MaxEnvironments int
+}
+
+func (q SpaceQuota) TableName() string {
+	return "space_quotas"
+}
+
+type Repository interface {
+	// Load returns the quota of the given space, or nil if the space uses the default.
+	Load(ctx context.Context, spaceID uuid.UUID) (*SpaceQuota, error)
+	Save(ctx context.Context, q *SpaceQuota) (*SpaceQuota, error)
+	Delete(ctx context.Context, spaceID uuid.UUID) error
+}
+
+type GormRepository struct {
+	db *gorm.DB
+}
+
+func NewRepository(db *gorm.DB) *GormRepository {
+	return &GormRepository{
+		db: db,
+	}
+}
+
+func (r *GormRepository) bind(ctx context.Context) *gorm.DB {
+	return gormctx.Bind(ctx, r.db)
+}
+
+func (r *GormRepository) Load(ctx context.Context, spaceID uuid.UUID) (*SpaceQuota, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "quota", "load"}, time.Now())
+
+	q := SpaceQuota{}
+	tx := r.bind(ctx).Model(&SpaceQuota{}).Where("space_id = ?", spaceID).First(&q)
+	if tx.RecordNotFound() {
+		return nil, nil
+	}
+	if tx.Error != nil {
+		log.Error(ctx, map[string]interface{}{"err": tx.Error, "space_id": spaceID.String()},
+			"unable to load the space quota")
+		return nil, errs.WithStack(tx.Error)
+	}
+	return &q, nil
+}
+
+func (r *GormRepository) Save(ctx context.Context, q *SpaceQuota) (*SpaceQuota, error) {
+	defer goa.MeasureSince([]string{"goa", "db", "quota", "save"}, time.Now())
+
+	now := time.Now()
+	err := r.bind(ctx).Exec(`INSERT INTO space_quotas (created_at, updated_at, space_id, max_environments) VALUES (?, ?, ?, ?)
+		ON CONFLICT (space_id) DO UPDATE SET updated_at = EXCLUDED.updated_at, deleted_at = NULL, max_environments = EXCLUDED.max_environments`,
+		now, now, q.SpaceID, q.MaxEnvironments).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{"err": err, "space_id": q.SpaceID.String()},
+			"unable to save the space quota")
+		return nil, errs.WithStack(err)
+	}
+	return r.Load(ctx, q.SpaceID)
+}
+
+// Delete removes the override, the space uses the default quota again.
+func (r *GormRepository) Delete(ctx context.Context, spaceID uuid.UUID) error {
+	defer goa.MeasureSince([]string{"goa", "db", "quota", "delete"}, time.Now())
+
+	err := r.bind(ctx).Unscoped().Where("space_id = ?", spaceID).Delete(&SpaceQuota{}).Error
+	if err != nil {
+		log.Error(ctx, map[string]interface{}{"err": err, "space_id": spaceID.String()},
+			"unable to delete the space quota")
+		return errs.WithStack(err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package quota_test
+
+import (
+	"context"
+	"testing"
+
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/configuration"
+	"github.com/fabric8-services/fabric8-env/quota"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type QuotaRepositorySuite struct {
+	testsuite.DBTestSuite
+	repo *quota.GormRepository
+}
+
+func TestQuotaRepository(t *testing.T) {
+	config, err := configuration.New("")
+	require.NoError(t, err)
+	suite.Run(t, &QuotaRepositorySuite{DBTestSuite: testsuite.NewDBTestSuite(config)})
+}
+
+func (s *QuotaRepositorySuite) SetupSuite() {
+	s.DBTestSuite.SetupSuite()
+
+	s.repo = quota.NewRepository(s.DB)
+}
+
+func (s *QuotaRepositorySuite) TestSaveAndLoad() {
+	ctx := context.Background()
+	spaceID := uuid.NewV4()
+
+	s.T().Run("load_default", func(t *testing.T) {
+		q, err := s.repo.Load(ctx, spaceID)
+		require.NoError(t, err)
+		assert.Nil(t, q)
+	})
+
+	s.T().Run("save_ok", func(t *testing.T) {
+		q, err := s.repo.Save(ctx, &quota.SpaceQuota{SpaceID: spaceID, MaxEnvironments: 5})
+		require.NoError(t, err)
+		require.NotNil(t, q)
+		assert.Equal(t, 5, q.MaxEnvironments)
+
+		q, err = s.repo.Save(ctx, &quota.SpaceQuota{SpaceID: spaceID, MaxEnvironments: 7})
+		require.NoError(t, err)
+		assert.Equal(t, 7, q.MaxEnvironments)
+	})
+
+	s.T().Run("delete_ok", func(t *testing.T) {
+		err := s.repo.Delete(ctx, spaceID)
+		require.NoError(t, err)
+
+		q, err := s.repo.Load(ctx, spaceID)
+		require.NoError(t, err)
+		assert.Nil(t, q)
+	})
+}
@@ -0,0 +1,192 @@
+package reaper
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/fabric8-services/fabric8-env/application"
+	"github.com/fabric8-services/fabric8-env/audit"
+	errs "github.com/pkg/errors"
+)
+
+// Actor is recorded in the audit log for environments deleted by the reaper.
+const Actor = "reaper"
+
+// Reaper periodically soft-deletes environments whose expiry time has passed and,
+// on its own schedule, purges expired idempotency keys.
+type Reaper struct {
+	db            application.DB
+	interval      time.Duration
+	purgeInterval time.Duration
+	batchSize     int
+	now           func() time.Time
+
+	stop chan struct{}
+	done chan struct{}
+
+	mu      sync.Mutex
+	started bool
+	stopped bool
+}
+
+// Option configures a Reaper.
+type Option func(r *Reaper)
+
+// WithClock replaces the clock used to decide whether an environment expired.
+func WithClock(now func() time.Time) Option {
+	return func(r *Reaper) {
+		r.now = now
+	}
+}
+
+// WithPurgeInterval sets how often the expired idempotency keys are purged, a zero
+// interval disables the purge. It defaults to the interval of the reaper.
+func WithPurgeInterval(interval time.Duration) Option {
+	return func(r *Reaper) {
+		r.purgeInterval = interval
+	}
+}
+
+// WithBatchSize sets the maximum number of environments deleted in one transaction.
+func WithBatchSize(size int) Option {
+	return func(r *Reaper) {
+		r.batchSize = size
+	}
+}
+
+// New returns a reaper deleting the expired environments every interval, a zero
+// interval disables their deletion.
+func New(db application.DB, interval time.Duration, options ...Option) *Reaper {
+	r := &Reaper{
+		db:            db,
+		interval:      interval,
+		purgeInterval: interval,
+		batchSize:     100,
+		now:           time.Now,
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	for _, opt := range options {
+		opt(r)
+	}
+	return r
+}
+
+// Start runs the reaper in the background until Stop is called. It does nothing
+// if the reaper was already started or stopped.
+func (r *Reaper) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.started || r.stopped {
+		return
+	}
+	r.started = true
+	// a nil channel never fires, so a disabled task never runs
+	reapTicks, stopReap := ticks(r.interval)
+	purgeTicks, stopPurge := ticks(r.purgeInterval)
+	go func() {
+		defer close(r.done)
+		defer stopReap()
+		defer stopPurge()
+		for {
+			select {
+			case <-reapTicks:
+				ctx := context.Background()
+				count, err := r.ReapOnce(ctx)
+				if err != nil {
+					log.Error(ctx, map[string]interface{}{"err": err},
+						"failed to reap expired environments")
+				} else if count > 0 {
+					log.Info(ctx, map[string]interface{}{"count": count},
+						"reaped expired environments")
+				}
+			case <-purgeTicks:
+				ctx := context.Background()
+				count, err := r.PurgeOnce(ctx)
+				if err != nil {
+					log.Error(ctx, map[string]interface{}{"err": err},
+						"failed to purge expired idempotency keys")
+				} else if count > 0 {
+					log.Info(ctx, map[string]interface{}{"count": count},
+						"purged expired idempotency keys")
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+func ticks(interval time.Duration) (<-chan time.Time, func()) {
+	if interval <= 0 {
+		return nil, func() {}
+	}
+	ticker := time.NewTicker(interval)
+	return ticker.C, ticker.Stop
+}
+
+// Stop stops the background loop and waits for a running reap to finish. A
+// reaper which was not started yet will not start anymore.
+func (r *Reaper) Stop() {
+	r.mu.Lock()
+	if !r.stopped {
+		r.stopped = true
+		close(r.stop)
+	}
+	started := r.started
+	r.mu.Unlock()
+	if started {
+		<-r.done
+	}
+}
+
+// ReapOnce soft-deletes all the environments which expired and records the
+// reason in the audit log. It returns the number of deleted environments.
+func (r *Reaper) ReapOnce(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		count := 0
+		err := application.Transactional(ctx, r.db, func(appl application.Application) error {
+			now := r.now()
+			envs, err := appl.Environments().ListExpired(ctx, now, r.batchSize)
+			if err != nil {
+				return err
+			}
+			for _, env := range envs {
+				if err := appl.Environments().Delete(ctx, *env.ID); err != nil {
+					return errs.Wrapf(err, "failed to delete expired environment: %s", env.ID)
+				}
+				_, err := appl.AuditLogs().Create(ctx, &audit.Entry{
+					EnvironmentID: *env.ID,
+					SpaceID:       *env.SpaceID,
+					Action:        audit.ActionExpire,
+					Actor:         Actor,
+					Details: audit.Details{
+						"reason":     "expired",
+						"expires-at": env.ExpiresAt.UTC().Format(time.RFC3339),
+						"deleted-at": now.UTC().Format(time.RFC3339),
+					},
+				})
+				if err != nil {
+					return errs.Wrapf(err, "failed to audit expired environment: %s", env.ID)
+				}
+			}
+			count = len(envs)
+			return nil
+		})
+		if err != nil {
+			return total, err
+		}
+		total += count
+		if count < r.batchSize {
+			return total, nil
+		}
+	}
+}
+
+// PurgeOnce deletes the idempotency keys which expired and returns their number.
+func (r *Reaper) PurgeOnce(ctx context.Context) (int, error) {
+	return r.db.IdempotencyKeys().DeleteExpired(ctx, r.now())
+}
@@ -0,0 +1,167 @@
+package reaper_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/errors"
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/audit"
+	"github.com/fabric8-services/fabric8-env/configuration"
+	"github.com/fabric8-services/fabric8-env/environment"
+	"github.com/fabric8-services/fabric8-env/gormapp"
+	"github.com/fabric8-services/fabric8-env/idempotency"
+	"github.com/fabric8-services/fabric8-env/reaper"
+	uuid "github.com/satori/go.uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ReaperSuite struct {
+	testsuite.DBTestSuite
+	db *gormapp.GormDB
+}
+
+func TestReaper(t *testing.T) {
+	config, err := configuration.New("")
+	require.NoError(t, err)
+	suite.Run(t, &ReaperSuite{DBTestSuite: testsuite.NewDBTestSuite(config)})
+}
+
+func (s *ReaperSuite) SetupSuite() {
+	s.DBTestSuite.SetupSuite()
+
+	s.db = gormapp.NewGormDB(s.DB)
+}
+
+func (s *ReaperSuite) TestReapOnce() {
+	ctx := context.Background()
+	// use a clock far in the future so environments of other tests expire as well
+	now := time.Now().Add(100 * 365 * 24 * time.Hour)
+	expired := s.createEnvironment(now.Add(-time.Minute))
+	notExpired := s.createEnvironment(now.Add(time.Hour))
+	noExpiry := s.createEnvironment(time.Time{})
+
+	r := reaper.New(s.db, time.Minute, reaper.WithClock(func() time.Time { return now }), reaper.WithBatchSize(1))
+	count, err := r.ReapOnce(ctx)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), count >= 1)
+
+	_, err = s.db.Environments().Load(ctx, *expired.ID)
+	assert.IsType(s.T(), errors.NotFoundError{}, err)
+	entries, err := s.db.AuditLogs().List(ctx, *expired.ID)
+	require.NoError(s.T(), err)
+	require.Len(s.T(), entries, 1)
+	assert.Equal(s.T(), audit.ActionExpire, entries[0].Action)
+	assert.Equal(s.T(), reaper.Actor, entries[0].Actor)
+	assert.Equal(s.T(), "expired", entries[0].Details["reason"])
+
+	for _, env := range []*environment.Environment{notExpired, noExpiry} {
+		_, err = s.db.Environments().Load(ctx, *env.ID)
+		assert.NoError(s.T(), err)
+	}
+
+	count, err = r.ReapOnce(ctx)
+	require.NoError(s.T(), err)
+	assert.Equal(s.T(), 0, count)
+}
+
+func (s *ReaperSuite) TestStartStop() {
+	expired := s.createEnvironment(time.Now().Add(-time.Minute))
+
+	r := reaper.New(s.db, 10*time.Millisecond)
+	r.Start()
+	deleted := false
+	for deadline := time.Now().Add(5 * time.Second); !deleted && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		_, err := s.db.Environments().Load(context.Background(), *expired.ID)
+		deleted = err != nil
+	}
+	r.Stop()
+	assert.True(s.T(), deleted)
+	// stopping twice is harmless
+	r.Stop()
+}
+
+func (s *ReaperSuite) TestPurgeOnce() {
+	ctx := context.Background()
+	now := time.Now()
+	expired := s.createIdempotencyKey(now.Add(-time.Minute))
+	notExpired := s.createIdempotencyKey(now.Add(time.Hour))
+
+	r := reaper.New(s.db, time.Minute, reaper.WithClock(func() time.Time { return now }))
+	count, err := r.PurgeOnce(ctx)
+	require.NoError(s.T(), err)
+	assert.True(s.T(), count >= 1)
+	assert.False(s.T(), s.idempotencyKeyExists(expired))
+	assert.True(s.T(), s.idempotencyKeyExists(notExpired))
+}
+
+func (s *ReaperSuite) TestPurgeWithoutReaping() {
+	expiredKey := s.createIdempotencyKey(time.Now().Add(-time.Minute))
+	expiredEnv := s.createEnvironment(time.Now().Add(-time.Minute))
+
+	r := reaper.New(s.db, 0, reaper.WithPurgeInterval(10*time.Millisecond))
+	r.Start()
+	purged := false
+	for deadline := time.Now().Add(5 * time.Second); !purged && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		purged = !s.idempotencyKeyExists(expiredKey)
+	}
+	r.Stop()
+	assert.True(s.T(), purged)
+
+	_, err := s.db.Environments().Load(context.Background(), *expiredEnv.ID)
+	assert.NoError(s.T(), err, "the environments are not reaped")
+	require.NoError(s.T(), s.db.Environments().Delete(context.Background(), *expiredEnv.ID))
+}
+
+func (s *ReaperSuite) TestStopBeforeStart() {
+	r := reaper.New(s.db, 10*time.Millisecond)
+	// does not block
+	r.Stop()
+	// and the reaper does not start anymore
+	r.Start()
+	r.Stop()
+}
+
+func (s *ReaperSuite) createEnvironment(expiresAt time.Time) *environment.Environment {
+	name := "pr-env"
+	envType := "dev"
+	clusterURL := "cluster1.com"
+	spaceID := uuid.NewV4()
+	env := &environment.Environment{
+		Name:       &name,
+		Type:       &envType,
+		SpaceID:    &spaceID,
+		ClusterURL: &clusterURL,
+	}
+	if !expiresAt.IsZero() {
+		env.ExpiresAt = &expiresAt
+	}
+	env, err := s.db.Environments().Create(context.Background(), env)
+	require.NoError(s.T(), err)
+	return env
+}
+
+func (s *ReaperSuite) createIdempotencyKey(expiresAt time.Time) *idempotency.Record {
+	rec := &idempotency.Record{
+		SpaceID:        uuid.NewV4(),
+		Key:            uuid.NewV4().String(),
+		RequestHash:    "hash",
+		ResponseStatus: 201,
+		ResponseBody:   "{}",
+		ExpiresAt:      expiresAt,
+	}
+	require.NoError(s.T(), s.db.IdempotencyKeys().Create(context.Background(), rec, expiresAt.Add(-time.Hour)))
+	return rec
+}
+
+func (s *ReaperSuite) idempotencyKeyExists(rec *idempotency.Record) bool {
+	var count int
+	err := s.DB.Model(&idempotency.Record{}).Where("space_id = ? AND key = ?", rec.SpaceID, rec.Key).Count(&count).Error
+	require.NoError(s.T(), err)
+	return count > 0
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/log"
+	errs "github.com/pkg/errors"
+)
+
+// Certificates holds the certificate of the server and, for mutual TLS, the CA
+// bundle verifying the client certificates. They are reloaded when their files
+// change, so that rotated certificates are used without a restart.
+type Certificates struct {
+	certFile     string
+	keyFile      string
+	clientCAFile string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	versions  map[string]fileVersion
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// LoadCertificates loads the certificate and key pair of the server and, if
+// clientCAFile is not empty, the CA bundle which client certificates must be
+// signed by.
+func LoadCertificates(certFile, keyFile, clientCAFile string) (*Certificates, error) {
+	c := &Certificates{
+		certFile:     certFile,
+		keyFile:      keyFile,
+		clientCAFile: clientCAFile,
+	}
+	if _, err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// TLSConfig returns a server configuration which uses the current certificates
+// for every new connection. If a CA bundle is configured, the certificates the
+// clients present are verified, while RequireClientCert rejects the requests
+// made without one.
+func (c *Certificates) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			c.mu.RLock()
+			defer c.mu.RUnlock()
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*c.cert},
+			}
+			if c.clientCAs != nil {
+				config.ClientCAs = c.clientCAs
+				config.ClientAuth = tls.VerifyClientCertIfGiven
+			}
+			return config, nil
+		},
+	}
+}
+
+// RequireClientCert returns a handler rejecting the requests made without a
+// verified client certificate, apart from the ones to the exempt paths, such as
+// the probes, which the platform calls without a certificate.
+func RequireClientCert(next http.Handler, exemptPaths ...string) http.Handler {
+	exempt := make(map[string]bool, len(exemptPaths))
+	for _, path := range exemptPaths {
+		exempt[path] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !exempt[r.URL.Path] && (r.TLS == nil || len(r.TLS.VerifiedChains) == 0) {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Reload loads the files again if any of them changed since they were last
+// loaded and returns whether they were. The current certificates are kept if
+// the files cannot be loaded.
+func (c *Certificates) Reload() (bool, error) {
+	versions := make(map[string]fileVersion)
+	for _, file := range c.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return false, errs.Wrapf(err, "failed to read '%s'", file)
+		}
+		versions[file] = fileVersion{modTime: info.ModTime(), size: info.Size()}
+	}
+	if !c.changed(versions) {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return false, errs.Wrapf(err, "failed to load the certificate '%s' and key '%s'", c.certFile, c.keyFile)
+	}
+	var clientCAs *x509.CertPool
+	if c.clientCAFile != "" {
+		pem, err := ioutil.ReadFile(c.clientCAFile)
+		if err != nil {
+			return false, errs.Wrapf(err, "failed to read the client CA bundle '%s'", c.clientCAFile)
+		}
+		clientCAs = x509.NewCertPool()
+		if !clientCAs.AppendCertsFromPEM(pem) {
+			return false, errs.Errorf("no certificate found in the client CA bundle '%s'", c.clientCAFile)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cert = &cert
+	c.clientCAs = clientCAs
+	c.versions = versions
+	return true, nil
+}
+
+// Watch reloads the files every interval until ctx is done.
+func (c *Certificates) Watch(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				reloaded, err := c.Reload()
+				if err != nil {
+					log.Error(nil, map[string]interface{}{"err": err},
+						"failed to reload the TLS certificates, keeping the current ones")
+				} else if reloaded {
+					log.Info(nil, map[string]interface{}{"cert_file": c.certFile},
+						"reloaded the TLS certificates")
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (c *Certificates) files() []string {
+	files := []string{c.certFile, c.keyFile}
+	if c.clientCAFile != "" {
+		files = append(files, c.clientCAFile)
+	}
+	return files
+}
+
+func (c *Certificates) changed(versions map[string]fileVersion) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if len(c.versions) != len(versions) {
+		return true
+	}
+	for file, version := range versions {
+		current, ok := c.versions[file]
+		if !ok || !current.modTime.Equal(version.modTime) || current.size != version.size {
+			return true
+		}
+	}
+	return false
+}
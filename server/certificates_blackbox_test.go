@@ -0,0 +1,203 @@
+package server_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fabric8-services/fabric8-env/controller"
+	"github.com/fabric8-services/fabric8-env/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert   *x509.Certificate
+	key    *ecdsa.PrivateKey
+	pem    []byte
+	serial int64
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return &testCA{
+		cert:   cert,
+		key:    key,
+		pem:    pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		serial: 1,
+	}
+}
+
+// issue returns a PEM encoded certificate and key for 127.0.0.1 signed by the CA.
+func (ca *testCA) issue(t *testing.T, commonName string, usage x509.ExtKeyUsage) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(ca.serial),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes the file with a modification time in the future, so that
+// a rewrite within the resolution of the file system is noticed.
+func writeFile(t *testing.T, path string, content []byte, age int) {
+	require.NoError(t, ioutil.WriteFile(path, content, 0600))
+	modTime := time.Now().Add(time.Duration(age) * time.Minute)
+	require.NoError(t, os.Chtimes(path, modTime, modTime))
+}
+
+func okHandler(w http.ResponseWriter, r *http.Request) {}
+
+// serveTLS serves the handler over TLS and returns its URL and a function
+// stopping the server.
+func serveTLS(t *testing.T, certs *server.Certificates, handler http.Handler) (string, func()) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	ctx, shutdown := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, tls.NewListener(listener, certs.TLSConfig()), handler, controller.NewReadiness(), 0, time.Second)
+	}()
+	return "https://" + listener.Addr().String() + "/", func() {
+		shutdown()
+		<-served
+	}
+}
+
+func tlsClient(ca *testCA, clientCert *tls.Certificate) *http.Client {
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	config := &tls.Config{RootCAs: roots}
+	if clientCert != nil {
+		config.Certificates = []tls.Certificate{*clientCert}
+	}
+	return &http.Client{
+		Transport: &http.Transport{TLSClientConfig: config, DisableKeepAlives: true},
+	}
+}
+
+func serverName(t *testing.T, client *http.Client, url string) string {
+	resp, err := client.Get(url)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	return resp.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+func TestCertificates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "f8env-tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	caFile := filepath.Join(dir, "ca.crt")
+	ca := newTestCA(t)
+
+	t.Run("reload", func(t *testing.T) {
+		cert, key := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+		writeFile(t, certFile, cert, 0)
+		writeFile(t, keyFile, key, 0)
+		certs, err := server.LoadCertificates(certFile, keyFile, "")
+		require.NoError(t, err)
+		url, stop := serveTLS(t, certs, http.HandlerFunc(okHandler))
+		defer stop()
+		client := tlsClient(ca, nil)
+
+		assert.Equal(t, "server", serverName(t, client, url))
+
+		// unchanged files are not reloaded
+		reloaded, err := certs.Reload()
+		require.NoError(t, err)
+		assert.False(t, reloaded)
+
+		// rotated files are used for new connections
+		cert, key = ca.issue(t, "rotated", x509.ExtKeyUsageServerAuth)
+		writeFile(t, certFile, cert, 1)
+		writeFile(t, keyFile, key, 1)
+		reloaded, err = certs.Reload()
+		require.NoError(t, err)
+		assert.True(t, reloaded)
+		assert.Equal(t, "rotated", serverName(t, client, url))
+
+		// invalid files do not replace the current ones
+		writeFile(t, certFile, []byte("invalid"), 2)
+		_, err = certs.Reload()
+		require.Error(t, err)
+		assert.Equal(t, "rotated", serverName(t, client, url))
+	})
+
+	t.Run("client certificates", func(t *testing.T) {
+		cert, key := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+		writeFile(t, certFile, cert, 3)
+		writeFile(t, keyFile, key, 3)
+		writeFile(t, caFile, ca.pem, 3)
+		certs, err := server.LoadCertificates(certFile, keyFile, caFile)
+		require.NoError(t, err)
+		url, stop := serveTLS(t, certs, server.RequireClientCert(http.HandlerFunc(okHandler), "/api/status/live"))
+		defer stop()
+
+		resp, err := tlsClient(ca, nil).Get(url)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusUnauthorized, resp.StatusCode, "a client without certificate must be rejected")
+		assert.Equal(t, "server", serverName(t, tlsClient(ca, nil), url+"api/status/live"), "the probes do not require a certificate")
+
+		other := newTestCA(t)
+		otherCert, otherKey := other.issue(t, "client", x509.ExtKeyUsageClientAuth)
+		clientCert, err := tls.X509KeyPair(otherCert, otherKey)
+		require.NoError(t, err)
+		_, err = tlsClient(ca, &clientCert).Get(url)
+		assert.Error(t, err, "a client certificate signed by another CA must be rejected")
+
+		cert, key = ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+		clientCert, err = tls.X509KeyPair(cert, key)
+		require.NoError(t, err)
+		assert.Equal(t, "server", serverName(t, tlsClient(ca, &clientCert), url))
+	})
+
+	t.Run("missing files", func(t *testing.T) {
+		_, err := server.LoadCertificates(certFile, filepath.Join(dir, "missing.key"), "")
+		assert.Error(t, err)
+		_, err = server.LoadCertificates(certFile, keyFile, keyFile)
+		assert.Error(t, err, "a CA bundle without certificates is invalid")
+	})
+}
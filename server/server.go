@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/fabric8-services/fabric8-common/log"
+	"github.com/fabric8-services/fabric8-env/controller"
+	errs "github.com/pkg/errors"
+)
+
+// Serve serves the requests accepted by listener with handler until ctx is done.
+// Then it marks the instance as shutting down and keeps accepting connections
+// for drainDelay, so that the load balancer notices the failing readiness probe
+// before the connections are refused. Then it stops accepting connections and
+// waits for the in-flight requests to complete. The whole shutdown, drain delay
+// included, takes up to shutdownTimeout.
+func Serve(ctx context.Context, listener net.Listener, handler http.Handler, readiness *controller.Readiness, drainDelay, shutdownTimeout time.Duration) error {
+	srv := &http.Server{
+		Handler: handler,
+	}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		readiness.SetShuttingDown()
+		return errs.Wrap(err, "failed to serve requests")
+	case <-ctx.Done():
+	}
+
+	log.Info(nil, map[string]interface{}{"drain_delay": drainDelay.String(), "timeout": shutdownTimeout.String()},
+		"shutting down, draining the connections")
+	readiness.SetShuttingDown()
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if drainDelay > 0 {
+		timer := time.NewTimer(drainDelay)
+		select {
+		case <-timer.C:
+		case <-shutdownCtx.Done():
+			timer.Stop()
+		}
+	}
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return errs.Wrap(err, "failed to drain the connections")
+	}
+	if err := <-serveErr; err != http.ErrServerClosed {
+		return errs.Wrap(err, "failed to serve requests")
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package server_test
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	testsuite "github.com/fabric8-services/fabric8-common/test/suite"
+	"github.com/fabric8-services/fabric8-env/controller"
+	"github.com/fabric8-services/fabric8-env/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ServerSuite struct {
+	testsuite.UnitTestSuite
+}
+
+func TestServer(t *testing.T) {
+	suite.Run(t, &ServerSuite{})
+}
+
+type response struct {
+	body string
+	err  error
+}
+
+// slowHandler signals every request on started and completes it when release
+// is closed.
+func slowHandler(started chan<- struct{}, release <-chan struct{}) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.Write([]byte("done"))
+	})
+}
+
+func get(url string) <-chan response {
+	res := make(chan response, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			res <- response{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		res <- response{body: string(body), err: err}
+	}()
+	return res
+}
+
+func (s *ServerSuite) TestShutdownCompletesInFlightRequests() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(s.T(), err)
+	url := "http://" + listener.Addr().String() + "/"
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	readiness := controller.NewReadiness()
+	readiness.SetReady()
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, listener, slowHandler(started, release), readiness, 0, 5*time.Second)
+	}()
+
+	inFlight := get(url)
+	<-started
+	shutdown()
+
+	// the server waits for the in-flight request
+	select {
+	case err := <-served:
+		s.T().Fatalf("server stopped before the in-flight request completed: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+	assert.EqualError(s.T(), readiness.Check(), "instance is shutting down")
+	// and does not accept new connections
+	_, err = http.Get(url)
+	assert.Error(s.T(), err)
+
+	close(release)
+	res := <-inFlight
+	require.NoError(s.T(), res.err)
+	assert.Equal(s.T(), "done", res.body)
+	select {
+	case err := <-served:
+		assert.NoError(s.T(), err)
+	case <-time.After(5 * time.Second):
+		s.T().Fatal("server did not stop")
+	}
+}
+
+func (s *ServerSuite) TestShutdownTimeout() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(s.T(), err)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	defer close(release)
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, listener, slowHandler(started, release), controller.NewReadiness(), 0, 50*time.Millisecond)
+	}()
+
+	get("http://" + listener.Addr().String() + "/")
+	<-started
+	shutdown()
+
+	select {
+	case err := <-served:
+		require.Error(s.T(), err)
+		assert.Contains(s.T(), err.Error(), "failed to drain the connections")
+	case <-time.After(5 * time.Second):
+		s.T().Fatal("server did not stop after the shutdown timeout")
+	}
+}
+
+func (s *ServerSuite) TestShutdownDrainDelay() {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(s.T(), err)
+	url := "http://" + listener.Addr().String() + "/"
+	readiness := controller.NewReadiness()
+	readiness.SetReady()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("done"))
+	})
+
+	ctx, shutdown := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- server.Serve(ctx, listener, handler, readiness, 300*time.Millisecond, 5*time.Second)
+	}()
+	shutdown()
+	time.Sleep(50 * time.Millisecond)
+
+	// the instance is not ready but still accepts connections during the delay
+	assert.EqualError(s.T(), readiness.Check(), "instance is shutting down")
+	res := <-get(url)
+	require.NoError(s.T(), res.err)
+	assert.Equal(s.T(), "done", res.body)
+
+	select {
+	case err := <-served:
+		assert.NoError(s.T(), err)
+	case <-time.After(5 * time.Second):
+		s.T().Fatal("server did not stop after the drain delay")
+	}
+	_, err = http.Get(url)
+	assert.Error(s.T(), err)
+}